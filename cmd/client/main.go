@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/handler"
+	"tcpsocketv2/internal/socket"
+	"tcpsocketv2/internal/task"
+)
+
+func main() {
+	// 初始化配置
+	config.Init()
+	// 获取配置
+	cfg := config.Get()
+
+	client, cancel := socket.NewClientWithEndpoints(cfg.SrvInfo.EndpointList())
+	defer cancel()
+	defer logger.Sync()
+	l := logger.FromCtx(client.Ctx)
+	client.OnStateChange(func(transition socket.StateTransition) {
+		l.Info(fmt.Sprintf("客户端状态变更: %v -> %v, 原因: %v", transition.From, transition.To, transition.Reason))
+	})
+	client.RegisterHandler(handler.NewClientMsgHandler(client))
+	// 执行服务端下发的任务
+	task.NewExecutor(client)
+	// 收到退出信号时通知服务端后断开连接
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		l.Info(fmt.Sprintf("收到信号: %v，客户端退出", sig))
+		cancel()
+	}()
+	// 连接服务器并处理消息，断线后自动重连
+	client.Run()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
+	"tcpsocketv2/internal/handler"
+	"tcpsocketv2/internal/socket"
+	"tcpsocketv2/internal/task"
+)
+
+func main() {
+	// 初始化配置
+	config.Init()
+	// 获取配置
+	cfg := config.Get()
+
+	l := logger.Get()
+	defer logger.Sync()
+	// 创建 Server 实例
+	server := socket.NewServer(cfg.SrvInfo.Host, cfg.SrvInfo.Port)
+	// 设置握手认证器
+	authenticator, err := auth.New(cfg.Auth)
+	if err != nil {
+		l.Error(fmt.Sprintf("Create authenticator error: %v", err))
+		return
+	}
+	server.SetAuthenticator(authenticator)
+	// 注册消息处理器
+	server.RegisterHandler(handler.NewServerMsgHandler(server))
+	// 任务下发器：接收客户端回传的任务输出和结果，并按 task.schedules 定时下发任务
+	dispatcher := task.NewDispatcher(server)
+	l.Info("Server started, register the handler of message successfully!")
+	// 收到 SIGINT/SIGTERM 时优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := dispatcher.Schedule(ctx, cfg.Task.Schedules); err != nil {
+		l.Error(fmt.Sprintf("Start task schedules error: %v", err))
+		return
+	}
+	// 收到 SIGUSR2 时启动新进程并移交监听socket，实现无缝升级
+	server.UpgradeOnSignal(ctx)
+	if err := server.Serve(ctx); err != nil && !errors.Is(err, socket.ErrServerClosed) {
+		l.Error(fmt.Sprintf("Serve error: %v", err))
+		return
+	}
+}
@@ -9,3 +9,21 @@ const (
 	ClientStatusError
 	ClientStatusWaiting
 )
+
+// String 客户端状态名称
+func (s ClientStatusEM) String() string {
+	switch s {
+	case ClientStatusConnecting:
+		return "Connecting"
+	case ClientStatusConnected:
+		return "Connected"
+	case ClientStatusDisConnected:
+		return "DisConnected"
+	case ClientStatusError:
+		return "Error"
+	case ClientStatusWaiting:
+		return "Waiting"
+	default:
+		return "Unknown"
+	}
+}
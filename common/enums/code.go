@@ -3,6 +3,10 @@ package enums
 type ResponseCode int
 
 const (
-	ResponseCode_Success ResponseCode = 0 // 成功
-	ResponseCode_Fail    ResponseCode = 1 // 失败
+	ResponseCode_Success        ResponseCode = 0 // 成功
+	ResponseCode_Fail           ResponseCode = 1 // 失败
+	ResponseCode_AuthFail       ResponseCode = 2 // 认证失败
+	ResponseCode_Overload       ResponseCode = 3 // 连接数超过服务端限制
+	ResponseCode_UnknownCommand ResponseCode = 4 // 未知指令
+	ResponseCode_NotHandshaken  ResponseCode = 5 // 未完成握手
 )
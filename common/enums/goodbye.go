@@ -0,0 +1,11 @@
+package enums
+
+type GoodbyeCode int
+
+const (
+	GoodbyeCode_Normal   GoodbyeCode = 0 // 正常断开
+	GoodbyeCode_Shutdown GoodbyeCode = 1 // 服务端关闭
+	GoodbyeCode_Restart  GoodbyeCode = 2 // 服务端重启或升级
+	GoodbyeCode_Failback GoodbyeCode = 3 // 客户端切换服务端
+	GoodbyeCode_Kicked   GoodbyeCode = 4 // 被服务端断开
+)
@@ -0,0 +1,43 @@
+package enums
+
+type TaskStatus int32
+
+const (
+	TaskStatus_Dispatched TaskStatus = 0 // 已下发，等待客户端接受
+	TaskStatus_Running    TaskStatus = 1 // 客户端已接受，正在执行
+	TaskStatus_Succeeded  TaskStatus = 2 // 执行成功
+	TaskStatus_Failed     TaskStatus = 3 // 执行失败或退出码不为0
+	TaskStatus_TimedOut   TaskStatus = 4 // 执行超时
+	TaskStatus_Canceled   TaskStatus = 5 // 客户端取消执行，如连接断开或客户端退出
+	TaskStatus_Rejected   TaskStatus = 6 // 客户端拒绝执行或下发失败
+	TaskStatus_Lost       TaskStatus = 7 // 结果送达前连接已断开
+)
+
+// Finished 任务是否已结束，结束后状态不再变化
+func (s TaskStatus) Finished() bool {
+	return s != TaskStatus_Dispatched && s != TaskStatus_Running
+}
+
+// String 任务状态名称
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskStatus_Dispatched:
+		return "Dispatched"
+	case TaskStatus_Running:
+		return "Running"
+	case TaskStatus_Succeeded:
+		return "Succeeded"
+	case TaskStatus_Failed:
+		return "Failed"
+	case TaskStatus_TimedOut:
+		return "TimedOut"
+	case TaskStatus_Canceled:
+		return "Canceled"
+	case TaskStatus_Rejected:
+		return "Rejected"
+	case TaskStatus_Lost:
+		return "Lost"
+	default:
+		return "Unknown"
+	}
+}
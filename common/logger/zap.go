@@ -18,6 +18,9 @@ var once sync.Once
 
 var logger *zap.Logger
 
+// logFile 日志文件，按大小自动切割，也可以调用 Rotate 手动切割
+var logFile *lumberjack.Logger
+
 func Get() *zap.Logger {
 	once.Do(
 		func() {
@@ -25,13 +28,14 @@ func Get() *zap.Logger {
 			stdout := zapcore.AddSync(os.Stdout)
 
 			// 输出到文件
-			file := zapcore.AddSync(&lumberjack.Logger{
+			logFile = &lumberjack.Logger{
 				Filename:   "logs/server.log",
 				MaxSize:    5,
 				MaxBackups: 10,
 				MaxAge:     14,
 				Compress:   true,
-			})
+			}
+			file := zapcore.AddSync(logFile)
 
 			// 日志等级
 			// TODO: 这里后续改为INFO等级
@@ -119,3 +123,19 @@ func WithCtx(ctx context.Context, l *zap.Logger) context.Context {
 	// 将新的日志记录器注入上下文并返回
 	return context.WithValue(ctx, ctxKey{}, l)
 }
+
+// Sync 将缓冲中的日志写入输出，程序退出前调用
+func Sync() {
+	if logger != nil {
+		// 标准输出不支持 fsync，忽略其返回的错误
+		_ = logger.Sync()
+	}
+}
+
+// Rotate 立即切割日志文件，当前文件备份后重新创建
+func Rotate() error {
+	if logFile == nil {
+		return fmt.Errorf("日志尚未初始化")
+	}
+	return logFile.Rotate()
+}
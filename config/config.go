@@ -1,9 +1,11 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,11 +16,42 @@ import (
 var (
 	Cfg         *Config
 	configMutex = &sync.RWMutex{}
+	// reloadHooks 配置热重载成功后的回调
+	reloadHooks []reloadHook
+	// nextHookID 下一个注册的回调的编号
+	nextHookID uint64
 )
 
+// reloadHook 已注册的配置热重载回调
+type reloadHook struct {
+	id uint64
+	fn func(cfg *Config)
+}
+
 type ServerInfo struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host             string        `mapstructure:"host"`
+	Port             int           `mapstructure:"port"`
+	Endpoints        []Endpoint    `mapstructure:"endpoints"`         // 客户端可连接的服务端列表，为空时使用 host/port
+	FailbackInterval time.Duration `mapstructure:"failback_interval"` // 连接备用服务端时探测主服务端的间隔（秒），0 表示不回切
+	DialTimeout      time.Duration `mapstructure:"dial_timeout"`      // 客户端连接服务端的超时时间（秒），包含TLS握手，0 表示不限制
+	ShutdownTimeout  time.Duration `mapstructure:"shutdown_timeout"`  // 服务端优雅关闭时等待连接退出的最长时间（秒）
+	RestartSpread    time.Duration `mapstructure:"restart_spread"`    // 热升级时客户端重连间隔的随机范围（秒），避免集中重连新进程
+}
+
+// Endpoint 服务端地址，客户端按优先级依次尝试，同优先级内按权重随机排序（类似DNS SRV记录）
+type Endpoint struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Priority int    `mapstructure:"priority"` // 优先级，数值越小越优先
+	Weight   int    `mapstructure:"weight"`   // 同优先级内的权重，全部为0时保持配置顺序
+}
+
+// EndpointList 获取客户端可连接的服务端列表，未配置 endpoints 时使用 host/port
+func (s ServerInfo) EndpointList() []Endpoint {
+	if len(s.Endpoints) > 0 {
+		return s.Endpoints
+	}
+	return []Endpoint{{Host: s.Host, Port: s.Port}}
 }
 
 type Msg struct {
@@ -26,11 +59,198 @@ type Msg struct {
 	HeartbeatInterval  time.Duration `mapstructure:"heartbeat_interval"`
 	HeartbeatTimeout   int64         `mapstructure:"heartbeat_timeout"`
 	HeartbeatCheckTime time.Duration `mapstructure:"heartbeat_check_time"`
+	MaxFrameSize       int           `mapstructure:"max_frame_size"`     // 单帧最大长度（字节）
+	AllowLegacyFrame   bool          `mapstructure:"allow_legacy_frame"` // 是否兼容旧版帧格式
+	Checksum           bool          `mapstructure:"checksum"`           // 是否协商启用帧校验和
+	ChecksumPolicy     string        `mapstructure:"checksum_policy"`    // 校验失败的处理策略：drop 丢弃该帧，close 关闭连接
+	Compressions       []string      `mapstructure:"compressions"`       // 支持的压缩算法，按优先级排序，为空表示不压缩
+	CompressThreshold  int           `mapstructure:"compress_threshold"` // 消息体超过该长度（字节）才进行压缩
+	DrainTimeout       time.Duration `mapstructure:"drain_timeout"`      // 优雅断开时等待对端处理完剩余消息的时间（秒）
+	WriteQueueSize     int           `mapstructure:"write_queue_size"`   // 每个连接写队列的长度（消息数）
+	WriteQueuePolicy   string        `mapstructure:"write_queue_policy"` // 写队列满时的处理策略：block 阻塞，drop_oldest 丢弃最早的消息，disconnect 断开连接
+	WriteTimeout       time.Duration `mapstructure:"write_timeout"`      // 单条消息的写超时时间（秒），0 表示不限制
+	HandshakeTimeout   time.Duration `mapstructure:"handshake_timeout"`  // 建立连接后须在该时间（秒）内完成握手，0 表示不限制
+	IdleTimeout        time.Duration `mapstructure:"idle_timeout"`       // 连续未收到对端消息的最长时间（秒），0 表示与 heartbeat_timeout 相同，小于0表示不限制
+	CallTimeout        time.Duration `mapstructure:"call_timeout"`       // 同步调用未指定超时时间时等待回复的时间（秒），0 表示不限制
+}
+
+// IdleReadTimeout 空闲读超时，未配置时与心跳超时时间一致，返回0表示不限制；
+// 客户端在服务端同意回复心跳响应时使用同样的超时时间
+func (m Msg) IdleReadTimeout() time.Duration {
+	switch {
+	case m.IdleTimeout > 0:
+		return m.IdleTimeout * time.Second
+	case m.IdleTimeout < 0:
+		return 0
+	default:
+		return time.Duration(m.HeartbeatTimeout) * time.Second
+	}
+}
+
+// Limit 服务端连接准入限制，各项为0时表示不限制
+type Limit struct {
+	MaxConns      int     `mapstructure:"max_conns"`        // 最大并发连接数，超过时拒绝握手
+	MaxConnsPerIP int     `mapstructure:"max_conns_per_ip"` // 同一来源IP的最大并发连接数，超过时拒绝握手
+	MaxPending    int     `mapstructure:"max_pending"`      // 尚未完成握手的最大连接数，超过时直接关闭新连接
+	AcceptRate    float64 `mapstructure:"accept_rate"`      // 每秒最多接受的新连接数，超过时直接关闭新连接
+	AcceptBurst   int     `mapstructure:"accept_burst"`     // 允许突发接受的连接数，0 表示与 accept_rate 相同
+}
+
+// ACL 服务端来源IP访问控制，deny 优先于 allow，都不匹配时按默认策略处理
+type ACL struct {
+	Enable        bool     `mapstructure:"enable"`         // 是否启用访问控制
+	DefaultPolicy string   `mapstructure:"default_policy"` // 默认策略：allow 允许，deny 拒绝
+	Allow         []string `mapstructure:"allow"`          // 允许的IP或CIDR网段，支持IPv4和IPv6
+	Deny          []string `mapstructure:"deny"`           // 拒绝的IP或CIDR网段，支持IPv4和IPv6
+	KickDenied    bool     `mapstructure:"kick_denied"`    // 配置重新加载后是否断开已不被允许的连接
+}
+
+// Rules 解析允许和拒绝的网段，单个IP视为只包含该地址的网段
+func (a ACL) Rules() (allow []netip.Prefix, deny []netip.Prefix, err error) {
+	if allow, err = parsePrefixes(a.Allow); err != nil {
+		return nil, nil, fmt.Errorf("acl.allow 取值非法: %v", err)
+	}
+	if deny, err = parsePrefixes(a.Deny); err != nil {
+		return nil, nil, fmt.Errorf("acl.deny 取值非法: %v", err)
+	}
+	return allow, deny, nil
+}
+
+// parsePrefixes 解析IP或CIDR网段列表
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// TLS 传输层加密配置，服务端和客户端共用
+type TLS struct {
+	Enable            bool   `mapstructure:"enable"`              // 是否启用TLS
+	CertFile          string `mapstructure:"cert_file"`           // 本端证书（服务端证书或客户端证书）
+	KeyFile           string `mapstructure:"key_file"`            // 本端私钥
+	CAFile            string `mapstructure:"ca_file"`             // 用于校验对端证书的CA证书
+	RequireClientCert bool   `mapstructure:"require_client_cert"` // 服务端是否要求并校验客户端证书（mTLS）
+	MinVersion        string `mapstructure:"min_version"`         // 最低TLS版本：1.0、1.1、1.2、1.3
+	ServerName        string `mapstructure:"server_name"`         // 客户端校验服务端证书使用的主机名，为空时使用连接地址
+}
+
+// MinTLSVersion 解析最低TLS版本
+func (t TLS) MinTLSVersion() (uint16, error) {
+	switch t.MinVersion {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("不支持的TLS版本: %v", t.MinVersion)
+	}
+}
+
+// Auth 握手认证配置
+type Auth struct {
+	Enable        bool              `mapstructure:"enable"`         // 是否启用预共享密钥认证（未配置 mode 时生效）
+	Mode          string            `mapstructure:"mode"`           // 服务端认证方式：none、token、psk、mtls、command、webhook
+	FleetSecret   string            `mapstructure:"fleet_secret"`   // 全体设备共用的密钥
+	DeviceSecrets map[string]string `mapstructure:"device_secrets"` // 设备独立密钥（设备ID -> 密钥），优先于 fleet_secret
+	Token         string            `mapstructure:"token"`          // 客户端握手时提交的令牌
+	TokenFile     string            `mapstructure:"token_file"`     // 服务端令牌列表文件
+	Command       string            `mapstructure:"command"`        // 外部认证命令
+	WebhookURL    string            `mapstructure:"webhook_url"`    // 外部认证服务地址
+	Timeout       time.Duration     `mapstructure:"timeout"`        // 外部认证超时时间（秒）
+}
+
+// AuthMode 获取生效的认证方式
+func (a Auth) AuthMode() string {
+	if a.Mode != "" {
+		return a.Mode
+	}
+	if a.Enable {
+		return "psk"
+	}
+	return "none"
+}
+
+// SecretFor 查找设备的预共享密钥，设备独立密钥优先
+func (a Auth) SecretFor(deviceId string) (string, bool) {
+	if secret, ok := a.DeviceSecrets[deviceId]; ok {
+		return secret, true
+	}
+	// viper 会将 map 的键转为小写
+	if secret, ok := a.DeviceSecrets[strings.ToLower(deviceId)]; ok {
+		return secret, true
+	}
+	return a.FleetSecret, a.FleetSecret != ""
+}
+
+// Reconnect 客户端断线重连配置
+type Reconnect struct {
+	Enable           bool          `mapstructure:"enable"`            // 是否启用断线重连
+	InitialInterval  time.Duration `mapstructure:"initial_interval"`  // 首次重连等待时间（秒）
+	MaxInterval      time.Duration `mapstructure:"max_interval"`      // 重连等待时间上限（秒）
+	Multiplier       float64       `mapstructure:"multiplier"`        // 每次失败后等待时间的增长倍数
+	Jitter           float64       `mapstructure:"jitter"`            // 等待时间的随机抖动比例（0~1），避免大量客户端同时重连
+	MaxAttempts      int           `mapstructure:"max_attempts"`      // 最大连续重连次数，0 表示不限制
+	BreakerThreshold int           `mapstructure:"breaker_threshold"` // 连续失败达到该次数后熔断，0 表示不熔断
+	BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown"`  // 熔断后的冷却时间（秒）
+}
+
+// Task 远程任务配置，服务端和客户端共用
+type Task struct {
+	Timeout       time.Duration     `mapstructure:"timeout"`        // 任务默认的执行超时时间（秒）
+	MaxConcurrent int               `mapstructure:"max_concurrent"` // 客户端同时执行的最大任务数，超过时拒绝新任务，0 表示不限制
+	MaxOutput     int               `mapstructure:"max_output"`     // 服务端为每个任务保存的最大输出长度（字节），超出部分丢弃
+	MaxRecords    int               `mapstructure:"max_records"`    // 服务端保存的最大任务数，超过时淘汰最早结束的任务
+	Actions       map[string]string `mapstructure:"actions"`        // 客户端允许执行的本地操作（名称 -> 命令），未列出的操作一律拒绝
+	Schedules     []TaskSchedule    `mapstructure:"schedules"`      // 服务端定时向在线设备下发的任务，修改后需重启服务端
+}
+
+// TaskSchedule 服务端定时下发的任务
+type TaskSchedule struct {
+	Type      string            `mapstructure:"type"`       // 任务类型：diagnostics、inventory、rotate_log、action
+	Interval  time.Duration     `mapstructure:"interval"`   // 下发间隔（秒）
+	Timeout   time.Duration     `mapstructure:"timeout"`    // 执行超时时间（秒），0 表示使用 task.timeout
+	Args      map[string]string `mapstructure:"args"`       // 任务参数，viper 会将参数名转为小写
+	DeviceIds []string          `mapstructure:"device_ids"` // 下发的设备ID，为空时下发给所有在线设备
+}
+
+// ActionCommand 查找允许执行的本地操作对应的命令
+func (t Task) ActionCommand(name string) (string, bool) {
+	if command, ok := t.Actions[name]; ok {
+		return command, true
+	}
+	// viper 会将 map 的键转为小写
+	command, ok := t.Actions[strings.ToLower(name)]
+	return command, ok
 }
 
 type Config struct {
-	SrvInfo ServerInfo `mapstructure:"srvInfo"`
-	Msg     Msg        `mapstructure:"msg"`
+	SrvInfo   ServerInfo `mapstructure:"srvInfo"`
+	Msg       Msg        `mapstructure:"msg"`
+	TLS       TLS        `mapstructure:"tls"`
+	Auth      Auth       `mapstructure:"auth"`
+	Reconnect Reconnect  `mapstructure:"reconnect"`
+	Limit     Limit      `mapstructure:"limit"`
+	ACL       ACL        `mapstructure:"acl"`
+	Task      Task       `mapstructure:"task"`
 }
 
 func initBase(configPath string, setDefaultFunc func(v *viper.Viper)) *viper.Viper {
@@ -100,14 +320,153 @@ func Init() {
 func setDefault(v *viper.Viper) {
 	v.SetDefault("server.host", "127.0.0.1")
 	v.SetDefault("server.port", 8000)
+	v.SetDefault("srvInfo.failback_interval", 60)
+	v.SetDefault("srvInfo.dial_timeout", 10)
+	v.SetDefault("srvInfo.shutdown_timeout", 10)
+	v.SetDefault("srvInfo.restart_spread", 10)
 	v.SetDefault("msg.msg_expire_time", 60)
 	v.SetDefault("msg.heartbeat_interval", 5)
 	v.SetDefault("msg.heartbeat_timeout", 60)
 	v.SetDefault("msg.heartbeat_check_time", 15)
+	v.SetDefault("msg.max_frame_size", 4*1024*1024)
+	v.SetDefault("msg.allow_legacy_frame", true)
+	v.SetDefault("msg.checksum", true)
+	v.SetDefault("msg.checksum_policy", "drop")
+	v.SetDefault("msg.compressions", []string{"snappy", "gzip", "zlib", "flate"})
+	v.SetDefault("msg.compress_threshold", 1024)
+	v.SetDefault("msg.drain_timeout", 5)
+	v.SetDefault("msg.write_queue_size", 256)
+	v.SetDefault("msg.write_queue_policy", "block")
+	v.SetDefault("msg.write_timeout", 10)
+	v.SetDefault("msg.handshake_timeout", 10)
+	v.SetDefault("msg.idle_timeout", 0)
+	v.SetDefault("msg.call_timeout", 30)
+	v.SetDefault("tls.enable", false)
+	v.SetDefault("tls.min_version", "1.2")
+	v.SetDefault("auth.enable", false)
+	v.SetDefault("auth.timeout", 5)
+	v.SetDefault("reconnect.enable", true)
+	v.SetDefault("reconnect.initial_interval", 1)
+	v.SetDefault("reconnect.max_interval", 60)
+	v.SetDefault("reconnect.multiplier", 2.0)
+	v.SetDefault("reconnect.jitter", 0.2)
+	v.SetDefault("reconnect.max_attempts", 0)
+	v.SetDefault("reconnect.breaker_threshold", 10)
+	v.SetDefault("reconnect.breaker_cooldown", 300)
+	v.SetDefault("limit.max_conns", 10000)
+	v.SetDefault("limit.max_conns_per_ip", 0)
+	v.SetDefault("limit.max_pending", 1024)
+	v.SetDefault("limit.accept_rate", 0)
+	v.SetDefault("limit.accept_burst", 0)
+	v.SetDefault("acl.enable", false)
+	v.SetDefault("acl.default_policy", "allow")
+	v.SetDefault("acl.kick_denied", false)
+	v.SetDefault("task.timeout", 300)
+	v.SetDefault("task.max_concurrent", 4)
+	v.SetDefault("task.max_output", 1024*1024)
+	v.SetDefault("task.max_records", 1000)
 }
 
 // ValidateCfg 配置校验
 func validateCfg(cfg *Config) error {
+	switch cfg.Msg.ChecksumPolicy {
+	case "drop", "close":
+	default:
+		return fmt.Errorf("msg.checksum_policy 取值非法: %v", cfg.Msg.ChecksumPolicy)
+	}
+	switch cfg.Msg.WriteQueuePolicy {
+	case "block", "drop_oldest", "disconnect":
+	default:
+		return fmt.Errorf("msg.write_queue_policy 取值非法: %v", cfg.Msg.WriteQueuePolicy)
+	}
+	if cfg.Msg.HandshakeTimeout < 0 {
+		return fmt.Errorf("msg.handshake_timeout 不能小于0")
+	}
+	if cfg.Msg.CallTimeout < 0 {
+		return fmt.Errorf("msg.call_timeout 不能小于0")
+	}
+	// 空闲超时小于心跳间隔时，正常发送心跳的客户端也会被断开
+	if idle := cfg.Msg.IdleReadTimeout(); idle > 0 && idle <= cfg.Msg.HeartbeatInterval*time.Second {
+		return fmt.Errorf("msg.idle_timeout 必须大于 msg.heartbeat_interval")
+	}
+	if cfg.TLS.Enable {
+		if _, err := cfg.TLS.MinTLSVersion(); err != nil {
+			return err
+		}
+		if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+			return fmt.Errorf("tls.cert_file 和 tls.key_file 必须同时配置")
+		}
+		if cfg.TLS.RequireClientCert && cfg.TLS.CAFile == "" {
+			return fmt.Errorf("启用 tls.require_client_cert 时必须配置 tls.ca_file")
+		}
+	}
+	switch cfg.Auth.AuthMode() {
+	case "none", "psk", "mtls":
+	case "token":
+		if cfg.Auth.TokenFile == "" {
+			return fmt.Errorf("auth.mode 为 token 时必须配置 auth.token_file")
+		}
+	case "command":
+		if cfg.Auth.Command == "" {
+			return fmt.Errorf("auth.mode 为 command 时必须配置 auth.command")
+		}
+	case "webhook":
+		if cfg.Auth.WebhookURL == "" {
+			return fmt.Errorf("auth.mode 为 webhook 时必须配置 auth.webhook_url")
+		}
+	default:
+		return fmt.Errorf("auth.mode 取值非法: %v", cfg.Auth.Mode)
+	}
+	if cfg.SrvInfo.DialTimeout < 0 {
+		return fmt.Errorf("srvInfo.dial_timeout 不能小于0")
+	}
+	for i, endpoint := range cfg.SrvInfo.Endpoints {
+		if endpoint.Host == "" || endpoint.Port <= 0 {
+			return fmt.Errorf("srvInfo.endpoints[%d] 缺少 host 或 port", i)
+		}
+		if endpoint.Weight < 0 {
+			return fmt.Errorf("srvInfo.endpoints[%d].weight 不能小于0", i)
+		}
+	}
+	if cfg.Limit.MaxConns < 0 || cfg.Limit.MaxConnsPerIP < 0 || cfg.Limit.MaxPending < 0 ||
+		cfg.Limit.AcceptRate < 0 || cfg.Limit.AcceptBurst < 0 {
+		return fmt.Errorf("limit 各项取值不能小于0")
+	}
+	if cfg.ACL.Enable {
+		switch cfg.ACL.DefaultPolicy {
+		case "allow", "deny":
+		default:
+			return fmt.Errorf("acl.default_policy 取值非法: %v", cfg.ACL.DefaultPolicy)
+		}
+		if _, _, err := cfg.ACL.Rules(); err != nil {
+			return err
+		}
+	}
+	if cfg.Task.Timeout <= 0 {
+		return fmt.Errorf("task.timeout 必须大于0")
+	}
+	if cfg.Task.MaxConcurrent < 0 || cfg.Task.MaxOutput < 0 || cfg.Task.MaxRecords < 0 {
+		return fmt.Errorf("task.max_concurrent、task.max_output、task.max_records 不能小于0")
+	}
+	for i, schedule := range cfg.Task.Schedules {
+		if schedule.Type == "" {
+			return fmt.Errorf("task.schedules[%d].type 不能为空", i)
+		}
+		if schedule.Interval <= 0 {
+			return fmt.Errorf("task.schedules[%d].interval 必须大于0", i)
+		}
+		if schedule.Timeout < 0 {
+			return fmt.Errorf("task.schedules[%d].timeout 不能小于0", i)
+		}
+	}
+	if cfg.Reconnect.Enable {
+		if cfg.Reconnect.Multiplier < 1 {
+			return fmt.Errorf("reconnect.multiplier 不能小于1")
+		}
+		if cfg.Reconnect.Jitter < 0 || cfg.Reconnect.Jitter > 1 {
+			return fmt.Errorf("reconnect.jitter 取值范围为0~1")
+		}
+	}
 	return nil
 }
 
@@ -129,11 +488,38 @@ func enableReload(v *viper.Viper) {
 
 		configMutex.Lock()
 		Cfg = &newConfig
+		hooks := reloadHooks
 		configMutex.Unlock()
 		fmt.Println("Configuration reloaded successfully")
+
+		for _, hook := range hooks {
+			hook.fn(&newConfig)
+		}
 	})
 }
 
+// OnReload 注册配置热重载回调，回调在新配置生效后执行，返回的函数用于取消注册，
+// 生命周期短于进程的调用方（如服务端停止后）应取消注册，避免回调继续持有已释放的资源
+func OnReload(hook func(cfg *Config)) (unregister func()) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	nextHookID++
+	id := nextHookID
+	reloadHooks = append(reloadHooks, reloadHook{id: id, fn: hook})
+	return func() {
+		configMutex.Lock()
+		defer configMutex.Unlock()
+		// 重载时在锁外遍历回调列表的副本，这里创建新的切片而不是原地修改
+		hooks := make([]reloadHook, 0, len(reloadHooks))
+		for _, h := range reloadHooks {
+			if h.id != id {
+				hooks = append(hooks, h)
+			}
+		}
+		reloadHooks = hooks
+	}
+}
+
 // Get 获取全局配置
 func Get() *Config {
 	configMutex.RLock()
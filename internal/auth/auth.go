@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"tcpsocketv2/config"
+	"time"
+)
+
+// ErrUnauthenticated 认证失败
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Request 认证请求
+type Request struct {
+	Conn     net.Conn // 客户端连接
+	DeviceId string   // 客户端上报的设备ID
+	Version  string   // 客户端协议版本
+	Token    string   // 客户端提交的令牌
+	Nonce    []byte   // 服务端下发的质询随机数，未质询时为空
+	Proof    []byte   // 客户端对质询的应答，未质询时为空
+}
+
+// Result 认证结果，保存到会话中供后续鉴权使用
+type Result struct {
+	Identity string            // 认证后的身份
+	Roles    []string          // 角色
+	Labels   map[string]string // 标签
+}
+
+// Authenticator 握手认证器
+type Authenticator interface {
+	// NeedChallenge 是否需要先向客户端下发质询
+	NeedChallenge() bool
+	// Authenticate 认证客户端，失败时返回包装了 ErrUnauthenticated 的错误
+	Authenticate(ctx context.Context, req *Request) (*Result, error)
+}
+
+// New 根据配置创建认证器
+func New(cfg config.Auth) (Authenticator, error) {
+	timeout := cfg.Timeout * time.Second
+	switch cfg.AuthMode() {
+	case "none":
+		return NewNoneAuthenticator(), nil
+	case "token":
+		return NewTokenAuthenticator(cfg.TokenFile)
+	case "psk":
+		return NewPSKAuthenticator(func(deviceId string) (string, bool) {
+			return config.Get().Auth.SecretFor(deviceId)
+		}), nil
+	case "mtls":
+		return NewMTLSAuthenticator(), nil
+	case "command":
+		return NewCommandAuthenticator(cfg.Command, timeout), nil
+	case "webhook":
+		return NewWebhookAuthenticator(cfg.WebhookURL, timeout), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth mode: %v", cfg.Mode)
+	}
+}
+
+// unauthenticated 构造认证失败错误
+func unauthenticated(format string, args ...any) error {
+	return fmt.Errorf("%w: %v", ErrUnauthenticated, fmt.Sprintf(format, args...))
+}
+
+// NoneAuthenticator 不做认证，mTLS连接以证书身份作为认证身份
+type NoneAuthenticator struct{}
+
+// NewNoneAuthenticator 创建不做认证的认证器
+func NewNoneAuthenticator() *NoneAuthenticator {
+	return &NoneAuthenticator{}
+}
+
+func (a *NoneAuthenticator) NeedChallenge() bool {
+	return false
+}
+
+func (a *NoneAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	identity := req.DeviceId
+	if cert, ok := peerCertificate(req.Conn); ok {
+		identity = certIdentity(cert)
+	}
+	return &Result{Identity: identity}, nil
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxExternalResultSize 外部认证服务响应体的最大长度
+const maxExternalResultSize = 64 * 1024
+
+// externalRequest 发送给外部认证程序的请求
+type externalRequest struct {
+	DeviceId   string `json:"device_id"`
+	Version    string `json:"version"`
+	Token      string `json:"token"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// externalResult 外部认证程序返回的结果，身份为空时使用设备ID
+type externalResult struct {
+	Identity string            `json:"identity"`
+	Roles    []string          `json:"roles"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// newExternalRequest 构造外部认证请求
+func newExternalRequest(req *Request) externalRequest {
+	remoteAddr := ""
+	if req.Conn != nil {
+		remoteAddr = req.Conn.RemoteAddr().String()
+	}
+	return externalRequest{
+		DeviceId:   req.DeviceId,
+		Version:    req.Version,
+		Token:      req.Token,
+		RemoteAddr: remoteAddr,
+	}
+}
+
+// parseExternalResult 解析外部认证结果，输出为空时视为仅认证通过
+func parseExternalResult(output []byte, req *Request) (*Result, error) {
+	var ext externalResult
+	if len(bytes.TrimSpace(output)) > 0 {
+		if err := json.Unmarshal(output, &ext); err != nil {
+			return nil, fmt.Errorf("解析外部认证结果失败: %v", err)
+		}
+	}
+	if ext.Identity == "" {
+		ext.Identity = req.DeviceId
+	}
+	return &Result{Identity: ext.Identity, Roles: ext.Roles, Labels: ext.Labels}, nil
+}
+
+// CommandAuthenticator 调用外部命令认证
+//
+// 认证请求以 JSON 写入命令的标准输入，同时通过环境变量 TCPSOCKET_DEVICE_ID、
+// TCPSOCKET_TOKEN、TCPSOCKET_REMOTE_ADDR 传递。命令退出码为0表示认证通过，
+// 标准输出可以返回 JSON 格式的身份、角色和标签。
+type CommandAuthenticator struct {
+	command string
+	timeout time.Duration
+}
+
+// NewCommandAuthenticator 创建外部命令认证器
+func NewCommandAuthenticator(command string, timeout time.Duration) *CommandAuthenticator {
+	return &CommandAuthenticator{command: command, timeout: timeout}
+}
+
+func (a *CommandAuthenticator) NeedChallenge() bool {
+	return false
+}
+
+func (a *CommandAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	ext := newExternalRequest(req)
+	input, err := json.Marshal(ext)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(a.command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("外部认证命令为空")
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"TCPSOCKET_DEVICE_ID="+ext.DeviceId,
+		"TCPSOCKET_TOKEN="+ext.Token,
+		"TCPSOCKET_REMOTE_ADDR="+ext.RemoteAddr,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, unauthenticated("外部认证命令拒绝了设备: %v, err: %v", req.DeviceId, err)
+	}
+	return parseExternalResult(output, req)
+}
+
+// WebhookAuthenticator 调用外部HTTP服务认证
+//
+// 认证请求以 JSON 格式 POST 到配置的地址，返回 200 表示认证通过，
+// 响应体可以返回 JSON 格式的身份、角色和标签。
+type WebhookAuthenticator struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAuthenticator 创建外部HTTP服务认证器
+func NewWebhookAuthenticator(url string, timeout time.Duration) *WebhookAuthenticator {
+	return &WebhookAuthenticator{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (a *WebhookAuthenticator) NeedChallenge() bool {
+	return false
+}
+
+func (a *WebhookAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	body, err := json.Marshal(newExternalRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("调用外部认证服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 限制读取的长度，避免异常的认证服务返回过大的响应体
+	var output bytes.Buffer
+	if _, err := output.ReadFrom(io.LimitReader(resp.Body, maxExternalResultSize+1)); err != nil {
+		return nil, fmt.Errorf("读取外部认证结果失败: %v", err)
+	}
+	if output.Len() > maxExternalResultSize {
+		return nil, fmt.Errorf("外部认证结果超过 %v 字节", maxExternalResultSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, unauthenticated("外部认证服务拒绝了设备: %v, status: %v", req.DeviceId, resp.StatusCode)
+	}
+	return parseExternalResult(output.Bytes(), req)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript 写入外部认证脚本，返回认证命令
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.sh")
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return "sh " + path
+}
+
+// pipeConn 带有来源地址的连接
+func pipeConn(t *testing.T) net.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return server
+}
+
+func TestCommandAuthenticator(t *testing.T) {
+	// 令牌通过环境变量传递，请求 JSON 写入标准输入
+	command := writeScript(t, `input=$(cat)
+[ "$TCPSOCKET_TOKEN" = "good" ] || exit 1
+case "$input" in *'"device_id":"device-1"'*) ;; *) exit 2 ;; esac
+echo '{"identity":"cmd-'"$TCPSOCKET_DEVICE_ID"'","roles":["ops"],"labels":{"via":"command"}}'
+`)
+	a := NewCommandAuthenticator(command, 5*time.Second)
+	got, err := a.Authenticate(context.Background(), &Request{Conn: pipeConn(t), DeviceId: "device-1", Token: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Result{Identity: "cmd-device-1", Roles: []string{"ops"}, Labels: map[string]string{"via": "command"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	// 退出码非0表示认证失败
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "device-1", Token: "bad"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("err = %v, want %v", err, ErrUnauthenticated)
+	}
+}
+
+func TestCommandAuthenticatorOutput(t *testing.T) {
+	// 没有输出时仅认证通过，身份为设备ID
+	a := NewCommandAuthenticator(writeScript(t, "exit 0\n"), 5*time.Second)
+	got, err := a.Authenticate(context.Background(), &Request{DeviceId: "device-1"})
+	if err != nil || got.Identity != "device-1" {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	// 输出不是 JSON 时返回错误
+	a = NewCommandAuthenticator(writeScript(t, "echo not-json\n"), 5*time.Second)
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "device-1"}); err == nil {
+		t.Fatal("invalid output should fail")
+	}
+	if _, err = NewCommandAuthenticator("  ", time.Second).Authenticate(context.Background(), &Request{}); err == nil {
+		t.Fatal("empty command should fail")
+	}
+}
+
+func TestCommandAuthenticatorTimeout(t *testing.T) {
+	a := NewCommandAuthenticator(writeScript(t, "exec sleep 10\n"), 100*time.Millisecond)
+	start := time.Now()
+	if _, err := a.Authenticate(context.Background(), &Request{DeviceId: "device-1"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("err = %v, want %v", err, ErrUnauthenticated)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timeout took %v", elapsed)
+	}
+}
+
+func TestWebhookAuthenticator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req externalRequest
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Token {
+		case "good":
+			_, _ = w.Write([]byte(`{"identity":"hook-` + req.DeviceId + `","roles":["admin"]}`))
+		case "empty":
+		case "huge":
+			_, _ = w.Write([]byte(`{"identity":"` + strings.Repeat("x", maxExternalResultSize) + `"}`))
+		case "slow":
+			time.Sleep(time.Second)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	a := NewWebhookAuthenticator(server.URL, 200*time.Millisecond)
+	got, err := a.Authenticate(context.Background(), &Request{Conn: pipeConn(t), DeviceId: "device-1", Token: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Result{Identity: "hook-device-1", Roles: []string{"admin"}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	// 响应体为空时身份为设备ID
+	if got, err = a.Authenticate(context.Background(), &Request{DeviceId: "device-1", Token: "empty"}); err != nil || got.Identity != "device-1" {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	// 非200表示认证失败
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "device-1", Token: "bad"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("err = %v, want %v", err, ErrUnauthenticated)
+	}
+	// 响应体过大、超时都返回错误
+	for _, token := range []string{"huge", "slow"} {
+		if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "device-1", Token: token}); err == nil || errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("%v: err = %v, want service error", token, err)
+		}
+	}
+}
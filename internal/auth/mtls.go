@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+)
+
+// MTLSAuthenticator 以客户端证书认证，证书主题的CN作为身份，OU作为角色，O作为标签
+type MTLSAuthenticator struct{}
+
+// NewMTLSAuthenticator 创建mTLS认证器
+func NewMTLSAuthenticator() *MTLSAuthenticator {
+	return &MTLSAuthenticator{}
+}
+
+func (a *MTLSAuthenticator) NeedChallenge() bool {
+	return false
+}
+
+func (a *MTLSAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	cert, ok := peerCertificate(req.Conn)
+	if !ok {
+		return nil, unauthenticated("客户端未提供证书")
+	}
+	result := &Result{
+		Identity: certIdentity(cert),
+		Roles:    cert.Subject.OrganizationalUnit,
+	}
+	if len(cert.Subject.Organization) > 0 {
+		result.Labels = map[string]string{"organization": strings.Join(cert.Subject.Organization, ",")}
+	}
+	return result, nil
+}
+
+// PeerIdentity 获取mTLS连接中客户端证书的身份（证书主题的CN），非TLS连接或未提供证书时返回 false
+func PeerIdentity(conn net.Conn) (string, bool) {
+	cert, ok := peerCertificate(conn)
+	if !ok {
+		return "", false
+	}
+	return certIdentity(cert), true
+}
+
+// peerCertificate 获取TLS连接中已校验的客户端证书
+func peerCertificate(conn net.Conn) (*x509.Certificate, bool) {
+	tlsConn, ok := TLSConn(conn)
+	if !ok {
+		return nil, false
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, false
+	}
+	return certs[0], true
+}
+
+// certIdentity 证书主题的CN，为空时使用完整主题
+func certIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+// TLSConn 获取连接底层的TLS连接，连接可能被写队列等包装，包装类型通过 NetConn 返回被包装的连接
+func TLSConn(conn net.Conn) (*tls.Conn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
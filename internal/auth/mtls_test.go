@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// selfSigned 生成自签名证书
+func selfSigned(t *testing.T, subject pkix.Name) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsPipe 建立TLS连接，返回服务端连接；clientCert 为空时客户端不提供证书
+func tlsPipe(t *testing.T, clientCert *tls.Certificate) *tls.Conn {
+	t.Helper()
+	serverRaw, clientRaw := net.Pipe()
+	server := tls.Server(serverRaw, &tls.Config{
+		Certificates: []tls.Certificate{selfSigned(t, pkix.Name{CommonName: "server"})},
+		ClientAuth:   tls.RequestClientCert,
+	})
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	client := tls.Client(clientRaw, clientConfig)
+	// 直接关闭底层连接，TLS连接关闭时会阻塞等待对端读取关闭通知
+	t.Cleanup(func() {
+		serverRaw.Close()
+		clientRaw.Close()
+	})
+	errCh := make(chan error, 1)
+	go func() { errCh <- client.Handshake() }()
+	if err := server.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// wrappedConn 包装后的连接，模拟写队列
+type wrappedConn struct{ net.Conn }
+
+func (c wrappedConn) NetConn() net.Conn { return c.Conn }
+
+func TestMTLSAuthenticator(t *testing.T) {
+	cert := selfSigned(t, pkix.Name{CommonName: "device-cn", OrganizationalUnit: []string{"ops", "admin"}, Organization: []string{"acme"}})
+	conn := tlsPipe(t, &cert)
+	want := &Result{Identity: "device-cn", Roles: []string{"ops", "admin"}, Labels: map[string]string{"organization": "acme"}}
+	a := NewMTLSAuthenticator()
+	// 被包装的连接同样能取到客户端证书
+	for name, c := range map[string]net.Conn{"tls": conn, "wrapped": wrappedConn{conn}} {
+		got, err := a.Authenticate(context.Background(), &Request{Conn: c, DeviceId: "reported-id"})
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v: got %+v, want %+v", name, got, want)
+		}
+	}
+	if identity, ok := PeerIdentity(wrappedConn{conn}); !ok || identity != "device-cn" {
+		t.Fatalf("PeerIdentity = %v, %v", identity, ok)
+	}
+}
+
+func TestMTLSAuthenticatorWithoutCertificate(t *testing.T) {
+	plain, _ := net.Pipe()
+	defer plain.Close()
+	a := NewMTLSAuthenticator()
+	// 非TLS连接、TLS连接未提供客户端证书都认证失败
+	for name, c := range map[string]net.Conn{"plain": plain, "no client cert": tlsPipe(t, nil)} {
+		if _, err := a.Authenticate(context.Background(), &Request{Conn: c, DeviceId: "device-1"}); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("%v: err = %v, want %v", name, err, ErrUnauthenticated)
+		}
+	}
+}
+
+func TestCertIdentityFallsBackToSubject(t *testing.T) {
+	cert := selfSigned(t, pkix.Name{Organization: []string{"acme"}})
+	conn := tlsPipe(t, &cert)
+	// 没有CN时使用完整主题作为身份
+	if identity, ok := PeerIdentity(conn); !ok || identity != "O=acme" {
+		t.Fatalf("PeerIdentity = %v, %v", identity, ok)
+	}
+	// NoneAuthenticator 对 mTLS 连接同样使用证书身份
+	got, err := NewNoneAuthenticator().Authenticate(context.Background(), &Request{Conn: conn, DeviceId: "device-1"})
+	if err != nil || got.Identity != "O=acme" {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
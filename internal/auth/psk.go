@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// NonceSize 质询随机数长度
+const NonceSize = 32
+
+// NewNonce 生成质询随机数
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// Sign 计算质询应答：HMAC-SHA256(secret, nonce + deviceId)
+func Sign(secret string, nonce []byte, deviceId string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(nonce)
+	mac.Write([]byte(deviceId))
+	return mac.Sum(nil)
+}
+
+// Verify 校验质询应答，使用常量时间比较防止时序攻击
+func Verify(secret string, nonce []byte, deviceId string, proof []byte) bool {
+	return hmac.Equal(Sign(secret, nonce, deviceId), proof)
+}
+
+// SecretLookup 查找设备的预共享密钥
+type SecretLookup func(deviceId string) (string, bool)
+
+// PSKAuthenticator 预共享密钥质询认证
+type PSKAuthenticator struct {
+	lookup SecretLookup
+}
+
+// NewPSKAuthenticator 创建预共享密钥认证器
+func NewPSKAuthenticator(lookup SecretLookup) *PSKAuthenticator {
+	return &PSKAuthenticator{lookup: lookup}
+}
+
+func (a *PSKAuthenticator) NeedChallenge() bool {
+	return true
+}
+
+func (a *PSKAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	secret, ok := a.lookup(req.DeviceId)
+	if !ok {
+		return nil, unauthenticated("设备: %v 未配置认证密钥", req.DeviceId)
+	}
+	if len(req.Nonce) == 0 || !Verify(secret, req.Nonce, req.DeviceId, req.Proof) {
+		return nil, unauthenticated("设备: %v 质询应答校验失败", req.DeviceId)
+	}
+	return &Result{Identity: req.DeviceId}, nil
+}
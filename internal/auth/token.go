@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenAuthenticator 静态令牌列表认证，令牌文件修改后自动重新加载
+//
+// 令牌文件每行一条记录，字段以空白分隔，# 开头的行为注释：
+//
+//	<令牌> <身份> [角色1,角色2] [标签1=值1,标签2=值2]
+//
+// 身份为 * 时使用客户端上报的设备ID。
+type TokenAuthenticator struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	tokens  map[string]Result
+}
+
+// NewTokenAuthenticator 创建令牌认证器
+func NewTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	a := &TokenAuthenticator{path: path}
+	if err := a.reloadIfModified(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *TokenAuthenticator) NeedChallenge() bool {
+	return false
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx context.Context, req *Request) (*Result, error) {
+	if err := a.reloadIfModified(); err != nil {
+		return nil, err
+	}
+	if req.Token == "" {
+		return nil, unauthenticated("设备: %v 未提交令牌", req.DeviceId)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for token, result := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(req.Token)) == 1 {
+			matched := result
+			if matched.Identity == "*" {
+				matched.Identity = req.DeviceId
+			}
+			return &matched, nil
+		}
+	}
+	return nil, unauthenticated("设备: %v 提交的令牌无效", req.DeviceId)
+}
+
+// reloadIfModified 令牌文件修改后重新加载
+func (a *TokenAuthenticator) reloadIfModified() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return fmt.Errorf("读取令牌文件失败: %v", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tokens != nil && info.ModTime().Equal(a.modTime) {
+		return nil
+	}
+	tokens, err := parseTokenFile(a.path)
+	if err != nil {
+		return err
+	}
+	a.tokens = tokens
+	a.modTime = info.ModTime()
+	return nil
+}
+
+// parseTokenFile 解析令牌文件
+func parseTokenFile(path string) (map[string]Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌文件失败: %v", err)
+	}
+	defer file.Close()
+
+	tokens := make(map[string]Result)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("令牌文件第 %v 行格式错误", lineNo)
+		}
+		result := Result{Identity: fields[1]}
+		if len(fields) > 2 {
+			result.Roles = strings.Split(fields[2], ",")
+		}
+		if len(fields) > 3 {
+			result.Labels = make(map[string]string)
+			for _, pair := range strings.Split(fields[3], ",") {
+				key, value, _ := strings.Cut(pair, "=")
+				result.Labels[key] = value
+			}
+		}
+		tokens[fields[0]] = result
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取令牌文件失败: %v", err)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeTokenFile 写入令牌文件并设置修改时间
+func writeTokenFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	writeTokenFile(t, path, "# 注释\n\nsecret-1 gateway admin,ops env=prod,zone=a\nsecret-2 *\n", time.Now().Add(-time.Hour))
+	a, err := NewTokenAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  *Result
+	}{
+		{"身份、角色和标签", "secret-1", &Result{Identity: "gateway", Roles: []string{"admin", "ops"}, Labels: map[string]string{"env": "prod", "zone": "a"}}},
+		{"身份为*时使用设备ID", "secret-2", &Result{Identity: "device-1"}},
+		{"令牌无效", "secret-3", nil},
+		{"未提交令牌", "", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Authenticate(context.Background(), &Request{DeviceId: "device-1", Token: tt.token})
+			if tt.want == nil {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("err = %v, want %v", err, ErrUnauthenticated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenAuthenticatorReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	writeTokenFile(t, path, "old-token device\n", time.Now().Add(-time.Hour))
+	a, err := NewTokenAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 令牌文件修改后自动重新加载，旧令牌失效
+	writeTokenFile(t, path, "new-token device\n", time.Now())
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "d", Token: "old-token"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("old token err = %v, want %v", err, ErrUnauthenticated)
+	}
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "d", Token: "new-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改后的文件格式错误时返回错误，而不是认证失败
+	writeTokenFile(t, path, "only-token\n", time.Now().Add(time.Hour))
+	if _, err = a.Authenticate(context.Background(), &Request{DeviceId: "d", Token: "new-token"}); err == nil || errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("err = %v, want token file error", err)
+	}
+}
+
+func TestTokenFileErrors(t *testing.T) {
+	if _, err := NewTokenAuthenticator(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing token file should fail")
+	}
+	path := filepath.Join(t.TempDir(), "tokens")
+	writeTokenFile(t, path, "a b c d e\n", time.Now())
+	if _, err := NewTokenAuthenticator(path); err == nil {
+		t.Fatal("malformed token file should fail")
+	}
+}
@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+// 内置压缩算法名称
+const (
+	Gzip  = "gzip"  // 压缩率优先
+	Zlib  = "zlib"  // 与 gzip 压缩率相当，头部开销更小
+	Flate = "flate" // 速度优先，适合对延迟敏感的场景
+)
+
+func init() {
+	register(gzipCompressor{})
+	register(zlibCompressor{})
+	register(flateCompressor{})
+	register(snappyCompressor{})
+}
+
+// gzipCompressor gzip 压缩
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return Gzip }
+
+func (gzipCompressor) ID() uint8 { return 1 }
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	return compress(data, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	})
+}
+
+func (gzipCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(r, limit)
+}
+
+// zlibCompressor zlib 压缩
+type zlibCompressor struct{}
+
+func (zlibCompressor) Name() string { return Zlib }
+
+func (zlibCompressor) ID() uint8 { return 2 }
+
+func (zlibCompressor) Compress(data []byte) ([]byte, error) {
+	return compress(data, func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, zlib.DefaultCompression)
+	})
+}
+
+func (zlibCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(r, limit)
+}
+
+// flateCompressor 最快速度的 deflate 压缩
+type flateCompressor struct{}
+
+func (flateCompressor) Name() string { return Flate }
+
+func (flateCompressor) ID() uint8 { return 3 }
+
+func (flateCompressor) Compress(data []byte) ([]byte, error) {
+	return compress(data, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.BestSpeed)
+	})
+}
+
+func (flateCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	return decompress(flate.NewReader(bytes.NewReader(data)), limit)
+}
@@ -0,0 +1,75 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooLarge 解压后的数据超过限制，防止压缩炸弹
+var ErrTooLarge = errors.New("decompressed data too large")
+
+// Compressor 压缩算法
+type Compressor interface {
+	// Name 算法名称，握手时用于协商
+	Name() string
+	// ID 算法编号，写入帧标志位，取值范围 1~7
+	ID() uint8
+	// Compress 压缩数据
+	Compress(data []byte) ([]byte, error)
+	// Decompress 解压数据，解压后长度超过 limit 时返回 ErrTooLarge
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+var (
+	byName = make(map[string]Compressor)
+	byID   = make(map[uint8]Compressor)
+)
+
+// register 注册压缩算法
+func register(c Compressor) {
+	byName[c.Name()] = c
+	byID[c.ID()] = c
+}
+
+// Get 根据名称获取压缩算法
+func Get(name string) (Compressor, bool) {
+	c, ok := byName[name]
+	return c, ok
+}
+
+// ByID 根据编号获取压缩算法
+func ByID(id uint8) (Compressor, bool) {
+	c, ok := byID[id]
+	return c, ok
+}
+
+// compress 使用流式写入器压缩数据
+func compress(data []byte, newWriter func(w io.Writer) (io.WriteCloser, error)) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := newWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress 使用流式读取器解压数据，并限制解压后的长度
+func decompress(r io.ReadCloser, limit int) ([]byte, error) {
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompress failed: %w", err)
+	}
+	if len(out) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
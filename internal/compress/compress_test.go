@@ -0,0 +1,138 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("hello"),
+		"repetitive": bytes.Repeat([]byte("tcpsocket "), 10000),
+		"random":     randomBytes(100000),
+		"mixed":      append(append(randomBytes(70000), bytes.Repeat([]byte{'a'}, 70000)...), randomBytes(300)...),
+	}
+	for _, name := range []string{Gzip, Zlib, Flate, Snappy} {
+		compressor, ok := Get(name)
+		if !ok {
+			t.Fatalf("compressor %v not registered", name)
+		}
+		if byId, ok := ByID(compressor.ID()); !ok || byId.Name() != name {
+			t.Fatalf("ByID(%v) = %v, %v", compressor.ID(), byId, ok)
+		}
+		for inputName, input := range inputs {
+			t.Run(name+"/"+inputName, func(t *testing.T) {
+				compressed, err := compressor.Compress(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := compressor.Decompress(compressed, len(input))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out, input) {
+					t.Fatalf("round trip mismatch: got %d bytes, want %d", len(out), len(input))
+				}
+			})
+		}
+	}
+}
+
+func TestDecompressBomb(t *testing.T) {
+	// 1MB 的零字节压缩后只有几KB，解压限制为64KB时必须拒绝
+	bomb := make([]byte, 1024*1024)
+	for _, name := range []string{Gzip, Zlib, Flate, Snappy} {
+		t.Run(name, func(t *testing.T) {
+			compressor, _ := Get(name)
+			compressed, err := compressor.Compress(bomb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = compressor.Decompress(compressed, 64*1024); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("err = %v, want %v", err, ErrTooLarge)
+			}
+			// 恰好等于限制时允许解压
+			if out, err := compressor.Decompress(compressed, len(bomb)); err != nil || len(out) != len(bomb) {
+				t.Fatalf("decompress at limit: %d bytes, %v", len(out), err)
+			}
+		})
+	}
+}
+
+func TestUnknownCompression(t *testing.T) {
+	// 编号0表示未压缩，标志位只有3位，超出范围的编号同样不存在
+	for _, id := range []uint8{0, 5, 8, 255} {
+		if c, ok := ByID(id); ok {
+			t.Fatalf("ByID(%v) = %v, want not found", id, c.Name())
+		}
+	}
+	if _, ok := Get("brotli"); ok {
+		t.Fatal("Get(brotli) should not be found")
+	}
+}
+
+func TestDecompressCorrupted(t *testing.T) {
+	for _, name := range []string{Gzip, Zlib, Flate, Snappy} {
+		compressor, _ := Get(name)
+		if _, err := compressor.Decompress([]byte(strings.Repeat("x", 32)), 1024); err == nil {
+			t.Fatalf("%v: decompress garbage should fail", name)
+		}
+	}
+}
+
+func TestSnappyFormat(t *testing.T) {
+	compressor, _ := Get(Snappy)
+	// 与 snappy 块格式一致：未压缩长度 + 字面量元素
+	for _, tt := range []struct {
+		input string
+		want  []byte
+	}{
+		{"", []byte{0x00}},
+		{"a", []byte{0x01, 0x00, 'a'}},
+		// 重叠的回溯复制：字面量 "abcd" 之后复制偏移4、长度8
+		{"abcdabcdabcd", []byte{0x0c, 0x0c, 'a', 'b', 'c', 'd', 0x11, 0x04}},
+	} {
+		got, err := compressor.Compress([]byte(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Fatalf("Compress(%q) = %x, want %x", tt.input, got, tt.want)
+		}
+	}
+	// 偏移小于复制长度时逐字节复制
+	out, err := compressor.Decompress([]byte{0x09, 0x00, 'x', 0x11, 0x01}, 16)
+	if err != nil || string(out) != "xxxxxxxxx" {
+		t.Fatalf("overlapping copy = %q, %v", out, err)
+	}
+}
+
+func TestSnappyCorrupted(t *testing.T) {
+	compressor, _ := Get(Snappy)
+	for name, data := range map[string][]byte{
+		"empty":            {},
+		"bad varint":       {0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		"short literal":    {0x05, 0x10, 'a', 'b'},
+		"literal overflow": {0x01, 0x04, 'a', 'b'},
+		"offset zero":      {0x05, 0x00, 'a', 0x01, 0x00},
+		"offset too far":   {0x05, 0x00, 'a', 0x01, 0x02},
+		"copy overflow":    {0x03, 0x00, 'a', 0x01, 0x01},
+		"length mismatch":  {0x05, 0x00, 'a'},
+		"truncated copy":   {0x05, 0x00, 'a', 0x02, 0x01},
+	} {
+		if _, err := compressor.Decompress(data, 1024); err == nil {
+			t.Fatalf("%v: decompress should fail", name)
+		}
+	}
+}
+
+// randomBytes 固定种子的随机数据，几乎无法压缩
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
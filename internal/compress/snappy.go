@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Snappy 速度优先的压缩算法，只做 LZ77 匹配不做熵编码，CPU 开销远低于 deflate 系列
+const Snappy = "snappy"
+
+// errCorrupt 压缩数据格式错误
+var errCorrupt = errors.New("snappy: corrupt input")
+
+// snappy 块格式中的元素类型，取标签字节的低2位
+const (
+	tagLiteral = 0x00 // 字面量
+	tagCopy1   = 0x01 // 回溯复制，1字节偏移
+	tagCopy2   = 0x02 // 回溯复制，2字节偏移
+	tagCopy4   = 0x03 // 回溯复制，4字节偏移
+)
+
+const (
+	minMatch      = 4       // 最短匹配长度
+	maxOffset     = 1 << 16 // 编码时只使用2字节偏移
+	hashTableBits = 14      // 匹配查找表大小
+)
+
+// snappyCompressor snappy 块格式的压缩：未压缩长度（varint）+ 字面量和回溯复制组成的元素序列
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string { return Snappy }
+
+func (snappyCompressor) ID() uint8 { return 4 }
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	dst := binary.AppendUvarint(make([]byte, 0, len(data)/2+16), uint64(len(data)))
+	if len(data) < minMatch {
+		return emitLiteral(dst, data), nil
+	}
+	var table [1 << hashTableBits]int32
+	literalStart := 0
+	for i := 0; i+minMatch <= len(data); {
+		h := hash4(binary.LittleEndian.Uint32(data[i:]))
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate >= maxOffset ||
+			binary.LittleEndian.Uint32(data[candidate:]) != binary.LittleEndian.Uint32(data[i:]) {
+			i++
+			continue
+		}
+		// 向后延长匹配
+		length := minMatch
+		for i+length < len(data) && data[candidate+length] == data[i+length] {
+			length++
+		}
+		dst = emitLiteral(dst, data[literalStart:i])
+		dst = emitCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+	return emitLiteral(dst, data[literalStart:]), nil
+}
+
+func (snappyCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+	// 解压前即可根据声明的长度拒绝压缩炸弹
+	if length > uint64(limit) {
+		return nil, ErrTooLarge
+	}
+	dst := make([]byte, 0, length)
+	src := data[n:]
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case tagLiteral:
+			size := int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				// 长度不小于61时，后续 size-59 个字节为小端序的长度减1
+				extra := size - 59
+				if len(src) < extra {
+					return nil, errCorrupt
+				}
+				size = 0
+				for j := extra - 1; j >= 0; j-- {
+					size = size<<8 | int(src[j])
+				}
+				src = src[extra:]
+			}
+			size++
+			if size > len(src) || uint64(len(dst)+size) > length {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case tagCopy1:
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			size, offset := int(tag>>2&0x07)+4, int(tag>>5)<<8|int(src[1])
+			dst, src = appendCopy(dst, offset, size), src[2:]
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			size, offset := int(tag>>2)+1, int(binary.LittleEndian.Uint16(src[1:]))
+			dst, src = appendCopy(dst, offset, size), src[3:]
+		case tagCopy4:
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			size, offset := int(tag>>2)+1, int(binary.LittleEndian.Uint32(src[1:]))
+			dst, src = appendCopy(dst, offset, size), src[5:]
+		}
+		if dst == nil || uint64(len(dst)) > length {
+			return nil, errCorrupt
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, fmt.Errorf("%w: decoded %d bytes, want %d", errCorrupt, len(dst), length)
+	}
+	return dst, nil
+}
+
+// hash4 计算4字节的哈希值
+func hash4(u uint32) uint32 {
+	return u * 0x1e35a7bd >> (32 - hashTableBits)
+}
+
+// emitLiteral 写入字面量元素
+func emitLiteral(dst, literal []byte) []byte {
+	for len(literal) > 0 {
+		// 单个元素最多携带 1<<32 字节，这里按 1<<16 拆分，长度字段最多2字节
+		chunk := literal
+		if len(chunk) > 1<<16 {
+			chunk = chunk[:1<<16]
+		}
+		size := len(chunk) - 1
+		switch {
+		case size < 60:
+			dst = append(dst, byte(size)<<2|tagLiteral)
+		case size < 1<<8:
+			dst = append(dst, 60<<2|tagLiteral, byte(size))
+		default:
+			dst = append(dst, 61<<2|tagLiteral, byte(size), byte(size>>8))
+		}
+		dst = append(dst, chunk...)
+		literal = literal[len(chunk):]
+	}
+	return dst
+}
+
+// emitCopy 写入回溯复制元素，长匹配拆分为多个元素
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		// 剩余长度不足 minMatch 时无法单独编码，前一个元素少复制一些
+		chunk := min(length, 64)
+		if rest := length - chunk; rest > 0 && rest < minMatch {
+			chunk -= minMatch - rest
+		}
+		if chunk <= 11 && chunk >= minMatch && offset < 1<<11 {
+			dst = append(dst, byte(offset>>8)<<5|byte(chunk-4)<<2|tagCopy1, byte(offset))
+		} else {
+			dst = append(dst, byte(chunk-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+		}
+		length -= chunk
+	}
+	return dst
+}
+
+// appendCopy 从已解压的数据中回溯复制，偏移非法时返回 nil；源和目标可能重叠，需逐字节复制
+func appendCopy(dst []byte, offset, length int) []byte {
+	if offset <= 0 || offset > len(dst) {
+		return nil
+	}
+	start := len(dst) - offset
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[start+i])
+	}
+	return dst
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+func TestReloadKicksDeniedSessions(t *testing.T) {
+	dir := initConfig(t, "reconnect:\n  enable: false\n")
+	server, port := startServer(t, nil)
+	allowed := dialFrom(t, "127.0.0.1", port)
+	if code := allowed.handshake(t, "device-acl-allowed"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	denied := dialFrom(t, "127.0.0.2", port)
+	if code := denied.handshake(t, "device-acl-denied"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	waitSession(t, server, "device-acl-allowed")
+	waitSession(t, server, "device-acl-denied")
+
+	// 重新加载后拒绝 127.0.0.2，已建立的会话收到断开通知
+	reloaded := make(chan struct{}, 1)
+	unregister := config.OnReload(func(newCfg *config.Config) {
+		// 写入过程中可能先读到不完整的文件，只关心写入完成后的那次重载
+		if !newCfg.ACL.KickDenied {
+			return
+		}
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+	defer unregister()
+	content := "reconnect:\n  enable: false\nacl:\n  enable: true\n  deny:\n    - 127.0.0.2/32\n  kick_denied: true\n"
+	if err := os.WriteFile(filepath.Join(dir, "config", "test.config.yaml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded")
+	}
+	if goodbye := denied.readGoodbye(t); goodbye.GetCode() != int32(enums.GoodbyeCode_Kicked) {
+		t.Fatalf("goodbye = %v, want kicked", goodbye)
+	}
+	_ = denied.conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, ok := server.Sessions.GetByDevice("device-acl-denied"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("denied session not removed")
+		}
+	}
+	if kicked := server.Metrics.KickedByACL.Load(); kicked != 1 {
+		t.Fatalf("kicked by acl = %v, want 1", kicked)
+	}
+
+	// 允许的会话不受影响，被拒绝的IP无法再建立连接
+	if _, ok := server.Sessions.GetByDevice("device-acl-allowed"); !ok {
+		t.Fatal("allowed session removed")
+	}
+	dialFrom(t, "127.0.0.2", port).expectClosed(t)
+	waitMetric(t, "rejected by acl", server.Metrics.RejectedByACL.Load, 1)
+	if code := dialFrom(t, "127.0.0.1", port).handshake(t, "device-acl-new"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+}
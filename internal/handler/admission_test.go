@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"tcpsocketv2/common/enums"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// dialFrom 从指定的本地IP连接服务端，不进行握手
+func dialFrom(t *testing.T, localIP string, port int) *device {
+	t.Helper()
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)}, Timeout: 5 * time.Second}
+	conn, err := dialer.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return newDevice(conn)
+}
+
+// handshake 发送握手请求并返回服务端的握手响应码
+func (d *device) handshake(t *testing.T, deviceId string) int32 {
+	t.Helper()
+	d.send(t, message.CommandType_CommandType_HandShakeReq, handshakeReq(deviceId))
+	command, payload := d.read(t)
+	if command != message.CommandType_CommandType_HandShakeResp {
+		t.Fatalf("got %v, want handshake response", command)
+	}
+	return payload.(*message.MSG_HANDSHAKE_RESP).GetCode()
+}
+
+// expectClosed 服务端应关闭连接且不发送任何消息
+func (d *device) expectClosed(t *testing.T) {
+	t.Helper()
+	_ = d.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b, err := d.reader.ReadByte()
+	var netErr net.Error
+	if err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatalf("read = %v, %v, want closed connection", b, err)
+	}
+}
+
+// expectOverload 握手应因连接数超过限制被拒绝，之后服务端关闭连接
+func (d *device) expectOverload(t *testing.T, deviceId string) {
+	t.Helper()
+	if code := d.handshake(t, deviceId); code != int32(enums.ResponseCode_Overload) {
+		t.Fatalf("handshake code = %v, want overload", code)
+	}
+	d.expectClosed(t)
+}
+
+// waitMetric 等待指标达到期望值
+func waitMetric(t *testing.T, name string, metric func() int64, want int64) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); metric() != want; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v = %v, want %v", name, metric(), want)
+		}
+	}
+}
+
+func TestAdmissionMaxPending(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nlimit:\n  max_pending: 2\nmsg:\n  handshake_timeout: 30\n")
+	server, port := startServer(t, nil)
+	first := dialFrom(t, "127.0.0.1", port)
+	second := dialFrom(t, "127.0.0.1", port)
+
+	// 两个连接都未握手，第三个连接被直接关闭
+	third := dialFrom(t, "127.0.0.1", port)
+	third.expectClosed(t)
+	waitMetric(t, "rejected by pending", server.Metrics.RejectedByPending.Load, 1)
+
+	// 完成握手后不再计入未握手连接数，可以接受新连接
+	if code := first.handshake(t, "device-pending-1"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	if code := second.handshake(t, "device-pending-2"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	if code := dialFrom(t, "127.0.0.1", port).handshake(t, "device-pending-3"); code != 0 {
+		t.Fatalf("handshake code = %v after others finished handshake, want 0", code)
+	}
+	if rejected := server.Metrics.RejectedByPending.Load(); rejected != 1 {
+		t.Fatalf("rejected by pending = %v, want 1", rejected)
+	}
+}
+
+func TestAdmissionMaxConns(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nlimit:\n  max_conns: 2\n")
+	server, port := startServer(t, nil)
+	first := dialDevice(t, server, port, "device-limit-1")
+	dialDevice(t, server, port, "device-limit-2")
+
+	// 超过并发连接数的连接会收到握手失败的回复
+	dialFrom(t, "127.0.0.1", port).expectOverload(t, "device-limit-3")
+	if rejected := server.Metrics.RejectedByLimit.Load(); rejected != 1 {
+		t.Fatalf("rejected by limit = %v, want 1", rejected)
+	}
+	if server.Sessions.Len() != 2 {
+		t.Fatalf("sessions = %v, want 2", server.Sessions.Len())
+	}
+
+	// 断开一个连接释放名额后可以再次握手，名额在连接处理结束后才释放，需要重试
+	_ = first.conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if code := dialFrom(t, "127.0.0.1", port).handshake(t, "device-limit-4"); code == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slot not released after client closed")
+		}
+	}
+}
+
+func TestAdmissionMaxConnsPerIP(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nlimit:\n  max_conns_per_ip: 1\n")
+	server, port := startServer(t, nil)
+	if code := dialFrom(t, "127.0.0.1", port).handshake(t, "device-ip-1"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+
+	// 同一IP的第二个连接被拒绝，其他IP不受影响
+	dialFrom(t, "127.0.0.1", port).expectOverload(t, "device-ip-2")
+	if code := dialFrom(t, "127.0.0.2", port).handshake(t, "device-ip-3"); code != 0 {
+		t.Fatalf("handshake from another ip = %v, want 0", code)
+	}
+	if rejected := server.Metrics.RejectedByIPLimit.Load(); rejected != 1 {
+		t.Fatalf("rejected by ip limit = %v, want 1", rejected)
+	}
+	if rejected := server.Metrics.RejectedByLimit.Load(); rejected != 0 {
+		t.Fatalf("rejected by limit = %v, want 0", rejected)
+	}
+}
+
+func TestAdmissionAcceptRate(t *testing.T) {
+	// 每100秒补充一个令牌，测试期间只能接受桶容量内的连接
+	initConfig(t, "reconnect:\n  enable: false\nlimit:\n  accept_rate: 0.01\n  accept_burst: 2\n")
+	server, port := startServer(t, nil)
+	first := dialFrom(t, "127.0.0.1", port)
+	second := dialFrom(t, "127.0.0.1", port)
+	third := dialFrom(t, "127.0.0.1", port)
+
+	// 超过接受速率的连接直接关闭，不回复握手
+	third.expectClosed(t)
+	waitMetric(t, "rejected by rate", server.Metrics.RejectedByRate.Load, 1)
+	if code := first.handshake(t, "device-rate-1"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	if code := second.handshake(t, "device-rate-2"); code != 0 {
+		t.Fatalf("handshake code = %v, want 0", code)
+	}
+	if rejected := server.Metrics.Snapshot(); rejected.RejectedByPending != 0 || rejected.RejectedByLimit != 0 {
+		t.Fatalf("unexpected rejections: %+v", rejected)
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
+	"tcpsocketv2/internal/serializer"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"tcpsocketv2/pkg/utils"
+)
+
+// authChallengeTimeout 质询有效期（秒），超时未应答的质询会被清理
+const authChallengeTimeout = 30
+
+const (
+	authFailureWindow = 600   // 认证失败的统计窗口（秒），超过窗口未再失败的来源IP重新计数
+	maxAuthFailures   = 10000 // 最多记录的来源IP数，超过时淘汰最久未失败的记录
+)
+
+// authFailure 来源IP的认证失败记录
+type authFailure struct {
+	count  int64 // 统计窗口内的失败次数
+	lastAt int64 // 最近一次失败的时间
+}
+
+// pendingAuth 等待认证应答的握手
+type pendingAuth struct {
+	req       *message.MSG_HANDSHAKE_REQ // 原始握手请求
+	nonce     []byte                     // 下发的随机数
+	createdAt int64                      // 质询下发时间
+}
+
+// authenticator 获取服务端配置的认证器，未配置时不做认证
+func (h *ServerMsgHandler) authenticator() auth.Authenticator {
+	if h.Server.Authenticator == nil {
+		return auth.NewNoneAuthenticator()
+	}
+	return h.Server.Authenticator
+}
+
+// authenticate 调用认证器认证客户端，通过后完成握手
+func (h *ServerMsgHandler) authenticate(conn net.Conn, payload *message.MSG_HANDSHAKE_REQ, nonce, proof []byte, ctx context.Context) error {
+	l := logger.FromCtx(ctx)
+	result, err := h.authenticator().Authenticate(ctx, &auth.Request{
+		Conn:     conn,
+		DeviceId: payload.GetDeviceId(),
+		Version:  payload.GetVersion(),
+		Token:    payload.GetToken(),
+		Nonce:    nonce,
+		Proof:    proof,
+	})
+	if err != nil {
+		return h.rejectAuth(conn, err, ctx)
+	}
+	l.Info(fmt.Sprintf("设备: %v 认证成功, 身份: %v, 角色: %v, Client: %v", payload.GetDeviceId(), result.Identity, result.Roles, conn.RemoteAddr()))
+	return h.acceptHandshake(conn, payload, result, ctx)
+}
+
+// sendAuthChallenge 下发认证质询
+func (h *ServerMsgHandler) sendAuthChallenge(conn net.Conn, payload *message.MSG_HANDSHAKE_REQ, ctx context.Context) error {
+	l := logger.FromCtx(ctx)
+	nonce, err := auth.NewNonce()
+	if err != nil {
+		return fmt.Errorf("Server, 生成质询随机数失败: %v", err)
+	}
+
+	now := utils.GetCurrentTimestamp()
+	h.authMu.Lock()
+	// 清理超时未应答的质询，避免客户端中途断开导致的泄漏
+	for c, pending := range h.pendingAuth {
+		if now-pending.createdAt > authChallengeTimeout {
+			delete(h.pendingAuth, c)
+		}
+	}
+	h.pendingAuth[conn] = pendingAuth{req: payload, nonce: nonce, createdAt: now}
+	h.authMu.Unlock()
+
+	pkg, serializeErr := serializer.CodecFromCtx(ctx).SerializeMessage(
+		message.CommandType_CommandType_AuthChallenge,
+		&message.MSG_AUTH_CHALLENGE{Nonce: nonce},
+	)
+	if serializeErr != nil {
+		return fmt.Errorf("Server, 序列化消息异常: %v\n", serializeErr)
+	}
+	if _, writeErr := conn.Write(pkg); writeErr != nil {
+		return fmt.Errorf("Server, 发送认证质询失败，关闭连接：%v\n", conn.RemoteAddr())
+	}
+	l.Debug(fmt.Sprintf("Server, 发送认证质询成功, Client: %v", conn.RemoteAddr()))
+	return nil
+}
+
+// HandleAuthResp 处理认证应答
+func (h *ServerMsgHandler) HandleAuthResp(ctx context.Context, _session *socket.Session, payload *message.MSG_AUTH_RESP) error {
+	conn := _session.Conn
+	h.authMu.Lock()
+	pending, ok := h.pendingAuth[conn]
+	delete(h.pendingAuth, conn)
+	h.authMu.Unlock()
+	if !ok || utils.GetCurrentTimestamp()-pending.createdAt > authChallengeTimeout {
+		return h.rejectAuth(conn, fmt.Errorf("%w: 认证质询不存在或已过期", auth.ErrUnauthenticated), ctx)
+	}
+	return h.authenticate(conn, pending.req, pending.nonce, payload.GetProof(), ctx)
+}
+
+// rejectAuth 认证失败，记录来源IP的失败次数并拒绝握手，失败原因只记录日志不返回给客户端
+func (h *ServerMsgHandler) rejectAuth(conn net.Conn, reason error, ctx context.Context) error {
+	l := logger.FromCtx(ctx)
+	ip := socket.RemoteIP(conn)
+	failures := h.recordAuthFailure(ip, utils.GetCurrentTimestamp())
+	l.Warn(fmt.Sprintf("客户端认证失败: %v, 来源IP: %v, 累计失败次数: %v", reason, ip, failures))
+	return h.rejectHandshake(conn, enums.ResponseCode_AuthFail, "认证失败", ctx)
+}
+
+// recordAuthFailure 记录来源IP的认证失败，返回统计窗口内的失败次数；
+// 记录数达到上限时先清理过期的记录，仍然超过上限时淘汰最久未失败的来源IP
+func (h *ServerMsgHandler) recordAuthFailure(ip string, now int64) int64 {
+	h.authMu.Lock()
+	defer h.authMu.Unlock()
+	failure, ok := h.authFailures[ip]
+	if ok && now-failure.lastAt > authFailureWindow {
+		failure = authFailure{}
+	}
+	if !ok && len(h.authFailures) >= maxAuthFailures {
+		oldestIp, oldestAt := "", int64(0)
+		for other, record := range h.authFailures {
+			if now-record.lastAt > authFailureWindow {
+				delete(h.authFailures, other)
+			} else if oldestIp == "" || record.lastAt < oldestAt {
+				oldestIp, oldestAt = other, record.lastAt
+			}
+		}
+		if len(h.authFailures) >= maxAuthFailures {
+			delete(h.authFailures, oldestIp)
+		}
+	}
+	failure.count++
+	failure.lastAt = now
+	h.authFailures[ip] = failure
+	return failure.count
+}
+
+// AuthFailures 获取指定来源IP在统计窗口内的认证失败次数
+func (h *ServerMsgHandler) AuthFailures(ip string) int64 {
+	h.authMu.Lock()
+	defer h.authMu.Unlock()
+	failure, ok := h.authFailures[ip]
+	if !ok || utils.GetCurrentTimestamp()-failure.lastAt > authFailureWindow {
+		return 0
+	}
+	return failure.count
+}
+
+// HandleAuthChallenge 处理服务端下发的认证质询
+func (h *ClientMsgHandler) HandleAuthChallenge(ctx context.Context, _session *socket.Session, payload *message.MSG_AUTH_CHALLENGE) error {
+	l := logger.FromCtx(ctx)
+	secret, ok := config.Get().Auth.SecretFor(h.deviceId)
+	if !ok {
+		return fmt.Errorf("服务端要求认证，但设备: %v 未配置认证密钥", h.deviceId)
+	}
+	pkg, serializeErr := serializer.CodecFromCtx(ctx).SerializeMessage(
+		message.CommandType_CommandType_AuthResp,
+		&message.MSG_AUTH_RESP{Proof: auth.Sign(secret, payload.GetNonce(), h.deviceId)},
+	)
+	if serializeErr != nil {
+		return fmt.Errorf("客户端序列化消息异常: %v\n", serializeErr)
+	}
+	if _, writeErr := _session.Conn.Write(pkg); writeErr != nil {
+		return fmt.Errorf("发送认证应答失败: %v\n", writeErr)
+	}
+	l.Debug("发送认证应答成功")
+	return nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRecordAuthFailure(t *testing.T) {
+	h := &ServerMsgHandler{authFailures: make(map[string]authFailure)}
+	now := int64(1_000_000)
+	for i := 1; i <= 3; i++ {
+		if count := h.recordAuthFailure("10.0.0.1", now); count != int64(i) {
+			t.Fatalf("count = %v, want %v", count, i)
+		}
+	}
+	// 超过统计窗口后重新计数
+	if count := h.recordAuthFailure("10.0.0.1", now+authFailureWindow+1); count != 1 {
+		t.Fatalf("count after window = %v, want 1", count)
+	}
+}
+
+func TestRecordAuthFailureCapacity(t *testing.T) {
+	h := &ServerMsgHandler{authFailures: make(map[string]authFailure)}
+	now := int64(1_000_000)
+	h.recordAuthFailure("old-0", now)
+	for i := 1; i < maxAuthFailures; i++ {
+		h.recordAuthFailure(fmt.Sprintf("old-%d", i), now+1+int64(i%10))
+	}
+	// 记录数达到上限时淘汰最久未失败的来源IP
+	h.recordAuthFailure("new-1", now+11)
+	if len(h.authFailures) != maxAuthFailures {
+		t.Fatalf("records = %v, want %v", len(h.authFailures), maxAuthFailures)
+	}
+	if _, ok := h.authFailures["old-0"]; ok {
+		t.Fatal("oldest record not evicted")
+	}
+	if h.authFailures["new-1"].count != 1 {
+		t.Fatal("new record missing")
+	}
+
+	// 超过统计窗口后，过期的记录全部清理
+	h.recordAuthFailure("new-2", now+11+authFailureWindow)
+	if len(h.authFailures) != 2 {
+		t.Fatalf("records = %v, want 2", len(h.authFailures))
+	}
+	if h.authFailures["new-1"].count != 1 || h.authFailures["new-2"].count != 1 {
+		t.Fatalf("records = %v", h.authFailures)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"strconv"
+	"tcpsocketv2/internal/protocol"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+func TestCorruptedFramesCountedPerSession(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  checksum: true\n  checksum_policy: drop\n")
+	server, port := startServer(t, nil)
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 握手时协商启用校验和
+	codec := serializer.NewCodec()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_HandShakeReq, &message.MSG_HANDSHAKE_REQ{
+		Version:  proto.String("1.0"),
+		DeviceId: proto.String("device-crc"),
+		Features: []string{protocol.FeatureChecksum},
+		Token:    proto.String(""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	command, payload, err := codec.DeserializeMessage(bufio.NewReader(conn), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != message.CommandType_CommandType_HandShakeResp || payload.(*message.MSG_HANDSHAKE_RESP).GetCode() != 0 {
+		t.Fatalf("got %v %v, want accepted handshake", command, payload)
+	}
+	codec.EnableChecksum()
+
+	heartbeat := func(os string) []byte {
+		frame, serializeErr := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, &message.MSG_HEARTBEAT{
+			Os:  proto.String(os),
+			Cpu: proto.Float64(1),
+			Mem: proto.Float64(1),
+		})
+		if serializeErr != nil {
+			t.Fatal(serializeErr)
+		}
+		return frame
+	}
+	// 消息体被破坏的帧、校验和标志位被清除的帧，之后是一个完好的帧
+	corrupted := heartbeat("corrupted")
+	corrupted[len(corrupted)-8] ^= 0xFF
+	flagCleared := heartbeat("flag cleared")
+	flagCleared[len(protocol.Magic)+1] &^= byte(protocol.FlagChecksum)
+	for _, frame := range [][]byte{corrupted, flagCleared, heartbeat("intact")} {
+		if _, err = conn.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 损坏的帧被丢弃，连接保持可用，计数记在会话和服务端指标上
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _session, ok := server.Sessions.GetByDevice("device-crc"); ok && _session.ClientSpec.Os == "intact" {
+			if n := _session.CorruptedFrames(); n != 2 {
+				t.Fatalf("session corrupted frames = %v, want 2", n)
+			}
+			if n := server.Metrics.CorruptedFrames.Load(); n != 2 {
+				t.Fatalf("server corrupted frames = %v, want 2", n)
+			}
+			return
+		}
+	}
+	t.Fatal("intact heartbeat after corrupted frames not handled")
+}
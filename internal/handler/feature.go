@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"slices"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/compress"
+	"tcpsocketv2/internal/protocol"
+	"tcpsocketv2/internal/serializer"
+)
+
+// featureHeartbeatAck 服务端收到心跳后回复心跳响应，客户端据此设置空闲超时以发现半开连接
+const featureHeartbeatAck = "heartbeat_ack"
+
+// localFeatures 本端支持并愿意启用的协议特性
+func localFeatures() []string {
+	cfg := config.Get()
+	var features []string
+	if cfg.Msg.Checksum {
+		features = append(features, protocol.FeatureChecksum)
+	}
+	return append(features, featureHeartbeatAck)
+}
+
+// localCompressions 本端支持的压缩算法，按优先级排序，忽略未知的算法
+func localCompressions() []string {
+	cfg := config.Get()
+	var compressions []string
+	for _, name := range cfg.Msg.Compressions {
+		if _, ok := compress.Get(name); ok {
+			compressions = append(compressions, name)
+		}
+	}
+	return compressions
+}
+
+// negotiateFeatures 服务端协商协议特性，取双方都支持的特性
+func negotiateFeatures(remote []string) []string {
+	var features []string
+	for _, feature := range localFeatures() {
+		if slices.Contains(remote, feature) {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// negotiateCompression 服务端按自身优先级选择双方都支持的压缩算法，为空表示不压缩
+func negotiateCompression(remote []string) string {
+	for _, name := range localCompressions() {
+		if slices.Contains(remote, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// applyFeatures 将协商结果应用到连接的编解码器
+func applyFeatures(codec *serializer.Codec, features []string, compression string) error {
+	if slices.Contains(features, protocol.FeatureChecksum) {
+		codec.EnableChecksum()
+	}
+	if compression != "" {
+		return codec.SetCompression(compression)
+	}
+	return nil
+}
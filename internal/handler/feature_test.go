@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"slices"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/compress"
+	"tcpsocketv2/internal/protocol"
+	"tcpsocketv2/internal/serializer"
+	"testing"
+)
+
+// setupFeatures 测试使用的本端配置
+func setupFeatures(t *testing.T, checksum bool, compressions ...string) {
+	t.Helper()
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{Checksum: checksum, Compressions: compressions}}
+	t.Cleanup(func() { config.Cfg = old })
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name            string
+		checksum        bool
+		local           []string
+		remoteFeatures  []string
+		remoteCompress  []string
+		wantFeatures    []string
+		wantCompression string
+	}{
+		{
+			name:            "双方都支持",
+			checksum:        true,
+			local:           []string{compress.Zlib, compress.Gzip},
+			remoteFeatures:  []string{protocol.FeatureChecksum},
+			remoteCompress:  []string{compress.Gzip, compress.Zlib},
+			wantFeatures:    []string{protocol.FeatureChecksum},
+			wantCompression: compress.Zlib,
+		},
+		{
+			name:            "按服务端优先级选择压缩算法",
+			checksum:        true,
+			local:           []string{compress.Flate, compress.Gzip},
+			remoteFeatures:  []string{"unknown", protocol.FeatureChecksum},
+			remoteCompress:  []string{compress.Gzip, compress.Flate},
+			wantFeatures:    []string{protocol.FeatureChecksum},
+			wantCompression: compress.Flate,
+		},
+		{
+			name:            "心跳响应",
+			checksum:        false,
+			remoteFeatures:  []string{featureHeartbeatAck, protocol.FeatureChecksum},
+			wantFeatures:    []string{featureHeartbeatAck},
+			wantCompression: "",
+		},
+		{
+			name:            "没有共同支持的特性和算法",
+			checksum:        true,
+			local:           []string{compress.Gzip},
+			remoteFeatures:  []string{"unknown"},
+			remoteCompress:  []string{compress.Zlib, "brotli"},
+			wantFeatures:    nil,
+			wantCompression: "",
+		},
+		{
+			name:            "本端未启用",
+			checksum:        false,
+			local:           nil,
+			remoteFeatures:  []string{protocol.FeatureChecksum},
+			remoteCompress:  []string{compress.Gzip},
+			wantFeatures:    nil,
+			wantCompression: "",
+		},
+		{
+			name:            "本端配置了未知的算法",
+			checksum:        true,
+			local:           []string{"brotli", compress.Gzip},
+			remoteCompress:  []string{"brotli", compress.Gzip},
+			wantFeatures:    nil,
+			wantCompression: compress.Gzip,
+		},
+		{
+			// 旧版客户端的握手请求不携带特性和压缩算法字段
+			name:            "旧版客户端",
+			checksum:        true,
+			local:           []string{compress.Gzip},
+			wantFeatures:    nil,
+			wantCompression: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupFeatures(t, tt.checksum, tt.local...)
+			if features := negotiateFeatures(tt.remoteFeatures); !slices.Equal(features, tt.wantFeatures) {
+				t.Fatalf("features = %v, want %v", features, tt.wantFeatures)
+			}
+			if compression := negotiateCompression(tt.remoteCompress); compression != tt.wantCompression {
+				t.Fatalf("compression = %q, want %q", compression, tt.wantCompression)
+			}
+		})
+	}
+}
+
+func TestLocalCompressionsSkipsUnknown(t *testing.T) {
+	setupFeatures(t, false, "brotli", compress.Gzip, "", compress.Zlib)
+	if got, want := localCompressions(), []string{compress.Gzip, compress.Zlib}; !slices.Equal(got, want) {
+		t.Fatalf("localCompressions = %v, want %v", got, want)
+	}
+	// 未启用校验和时只协商心跳响应
+	if got, want := localFeatures(), []string{featureHeartbeatAck}; !slices.Equal(got, want) {
+		t.Fatalf("localFeatures = %v, want %v", got, want)
+	}
+}
+
+func TestApplyFeatures(t *testing.T) {
+	setupFeatures(t, true, compress.Gzip)
+	codec := serializer.NewCodec()
+	if err := applyFeatures(codec, []string{protocol.FeatureChecksum}, compress.Gzip); err != nil {
+		t.Fatal(err)
+	}
+	if !codec.ChecksumEnabled() {
+		t.Fatal("checksum not enabled")
+	}
+	if c, ok := codec.Compression(); !ok || c.Name() != compress.Gzip {
+		t.Fatalf("compression = %v, %v", c, ok)
+	}
+
+	// 旧版服务端的握手响应不携带协商结果，编解码器保持不变
+	codec = serializer.NewCodec()
+	if err := applyFeatures(codec, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if codec.ChecksumEnabled() {
+		t.Fatal("checksum enabled without negotiation")
+	}
+	if _, ok := codec.Compression(); ok {
+		t.Fatal("compression enabled without negotiation")
+	}
+
+	if err := applyFeatures(serializer.NewCodec(), nil, "brotli"); err == nil {
+		t.Fatal("unknown compression should fail")
+	}
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/internal/serializer"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// device 直接读写连接的模拟客户端
+type device struct {
+	conn   net.Conn
+	codec  *serializer.Codec
+	reader *bufio.Reader
+}
+
+// newDevice 使用已建立的连接创建模拟客户端
+func newDevice(conn net.Conn) *device {
+	return &device{conn: conn, codec: serializer.NewCodec(), reader: bufio.NewReader(conn)}
+}
+
+// handshakeReq 不携带令牌和协议特性的握手请求
+func handshakeReq(deviceId string) *message.MSG_HANDSHAKE_REQ {
+	return &message.MSG_HANDSHAKE_REQ{
+		Version:  proto.String("1.0"),
+		DeviceId: proto.String(deviceId),
+		Token:    proto.String(""),
+	}
+}
+
+// dialDevice 连接服务端并完成握手
+func dialDevice(t *testing.T, server *socket.Server, port int, deviceId string) *device {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	d := newDevice(conn)
+	d.send(t, message.CommandType_CommandType_HandShakeReq, handshakeReq(deviceId))
+	if command, payload := d.read(t); command != message.CommandType_CommandType_HandShakeResp ||
+		payload.(*message.MSG_HANDSHAKE_RESP).GetCode() != 0 {
+		t.Fatalf("got %v %v, want accepted handshake", command, payload)
+	}
+	waitSession(t, server, deviceId)
+	return d
+}
+
+// send 发送一条消息
+func (d *device) send(t *testing.T, command message.CommandType, payload proto.Message) {
+	t.Helper()
+	data, err := d.codec.SerializeMessage(command, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read 读取一条消息
+func (d *device) read(t *testing.T) (message.CommandType, proto.Message) {
+	t.Helper()
+	_ = d.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	command, payload, err := d.codec.DeserializeMessage(d.reader, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return command, payload
+}
+
+// readGoodbye 读取服务端的优雅断开消息
+func (d *device) readGoodbye(t *testing.T) *message.MSG_GOODBYE {
+	t.Helper()
+	command, payload := d.read(t)
+	if command != message.CommandType_CommandType_Goodbye {
+		t.Fatalf("got %v, want goodbye", command)
+	}
+	return payload.(*message.MSG_GOODBYE)
+}
+
+// shutdownAsync 在后台关闭服务端，返回关闭结果和耗时
+func shutdownAsync(server *socket.Server, timeout time.Duration) <-chan shutdownResult {
+	result := make(chan shutdownResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		start := time.Now()
+		err := server.Shutdown(ctx)
+		result <- shutdownResult{err: err, elapsed: time.Since(start)}
+	}()
+	return result
+}
+
+// shutdownResult 关闭服务端的结果
+type shutdownResult struct {
+	err     error
+	elapsed time.Duration
+}
+
+// waitShutdown 等待服务端关闭完成
+func waitShutdown(t *testing.T, results <-chan shutdownResult) shutdownResult {
+	t.Helper()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(30 * time.Second):
+		t.Fatal("shutdown did not return")
+		return shutdownResult{}
+	}
+}
+
+func TestShutdownNotifiesClient(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  drain_timeout: 5\n")
+	server, port := startServer(t, nil)
+	client := startClient(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 客户端收到通知后主动断开，服务端无需等到排空超时
+	result := waitShutdown(t, shutdownAsync(server, 10*time.Second))
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.elapsed >= 5*time.Second {
+		t.Fatalf("shutdown took %v, want less than drain timeout", result.elapsed)
+	}
+	if err := client.WaitFor(enums.ClientStatusDisConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	notified := false
+	for _, transition := range client.StateHistory() {
+		if strings.Contains(transition.Reason, "服务端关闭") {
+			notified = true
+		}
+	}
+	if !notified {
+		t.Fatalf("client not told about shutdown: %+v", client.StateHistory())
+	}
+	if server.Sessions.Len() != 0 {
+		t.Fatalf("sessions = %v after shutdown", server.Sessions.Len())
+	}
+}
+
+func TestClientGoodbye(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  drain_timeout: 5\n")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, cancel := socket.NewClient("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	NewClientMsgHandler(client)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.Run()
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fakeHandshake(t, conn)
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	if err = client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 客户端取消时先发送优雅断开消息再关闭写方向
+	start := time.Now()
+	cancel()
+	codec := serializer.NewCodec()
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		command, payload, readErr := codec.DeserializeMessage(reader, context.Background())
+		if readErr != nil {
+			t.Fatalf("goodbye not received: %v", readErr)
+		}
+		if command == message.CommandType_CommandType_Goodbye {
+			if code := payload.(*message.MSG_GOODBYE).GetCode(); code != int32(enums.GoodbyeCode_Normal) {
+				t.Fatalf("goodbye code = %v, want normal", code)
+			}
+			break
+		}
+	}
+	if _, _, err = codec.DeserializeMessage(reader, context.Background()); !errors.Is(err, io.EOF) {
+		t.Fatalf("read after goodbye = %v, want EOF", err)
+	}
+	// 服务端关闭连接后客户端立即退出，不必等到排空超时
+	_ = conn.Close()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not stop after goodbye")
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Fatalf("client stopped after %v, want less than drain timeout", elapsed)
+	}
+}
+
+func TestShutdownDrainsPendingMessages(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  drain_timeout: 5\n")
+	server, port := startServer(t, nil)
+	d := dialDevice(t, server, port, "device-drain")
+	results := shutdownAsync(server, 10*time.Second)
+	goodbye := d.readGoodbye(t)
+	if goodbye.GetCode() != int32(enums.GoodbyeCode_Shutdown) || goodbye.GetReconnectAfter() != 0 {
+		t.Fatalf("goodbye = %v, want shutdown", goodbye)
+	}
+
+	// 收到通知后客户端发出的消息仍会被处理
+	d.send(t, message.CommandType_CommandType_Heartbeat, &message.MSG_HEARTBEAT{
+		Os:  proto.String("after goodbye"),
+		Cpu: proto.Float64(1),
+		Mem: proto.Float64(1),
+	})
+	handled := false
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && !handled; time.Sleep(10 * time.Millisecond) {
+		_session, ok := server.Sessions.GetByDevice("device-drain")
+		handled = ok && _session.ClientSpec.Os == "after goodbye"
+	}
+	if !handled {
+		t.Fatal("message sent after goodbye not handled")
+	}
+	select {
+	case result := <-results:
+		t.Fatalf("shutdown returned before client closed: %v", result.err)
+	default:
+	}
+
+	// 客户端关闭连接后服务端立即完成关闭
+	_ = d.conn.Close()
+	result := waitShutdown(t, results)
+	if result.err != nil || result.elapsed >= 5*time.Second {
+		t.Fatalf("shutdown = %v after %v, want nil before drain timeout", result.err, result.elapsed)
+	}
+}
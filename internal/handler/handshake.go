@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
 	"tcpsocketv2/common/enums"
 	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
 	"tcpsocketv2/internal/serializer"
 	"tcpsocketv2/internal/socket"
 	message "tcpsocketv2/pb"
@@ -15,17 +18,21 @@ import (
 // handshakeSuccess 握手成功
 func (h *ClientMsgHandler) handshakeSuccess() (err error) {
 	// 更新客户端状态
-	h.Client.Status = enums.ClientStatusConnected
+	if err = h.Client.Transition(enums.ClientStatusConnected, "握手成功"); err != nil {
+		return err
+	}
 	l := logger.FromCtx(h.Client.Ctx)
-	l.Info(fmt.Sprintf("握手成功，开始发送心跳请求，当前客户端状态：%v", h.Client.Status))
+	l.Info(fmt.Sprintf("握手成功，开始发送心跳请求，当前客户端状态：%v", h.Client.Status()))
 	err = h.Client.StartHeartbeat()
 	return err
 }
 
-// handshakeFail 握手失败
-func (h *ClientMsgHandler) handshakeFail() (err error) {
+// handshakeFail 握手失败，服务端随后会关闭连接
+func (h *ClientMsgHandler) handshakeFail(code int32, reason string) (err error) {
 	// 更新客户端状态
-	h.Client.Status = enums.ClientStatusDisConnected
+	if err = h.Client.Transition(enums.ClientStatusError, fmt.Sprintf("握手被拒绝，返回码: %v, 原因: %v", code, reason)); err != nil {
+		return err
+	}
 	return fmt.Errorf("握手失败，客户端断开连接")
 }
 
@@ -37,13 +44,19 @@ func (h *ClientMsgHandler) HandshakeReq() error {
 	if err != nil {
 		return fmt.Errorf("Get FQDN Error: %v\n", err)
 	}
+	// 记录上报的设备ID，认证应答时使用
+	h.deviceId = deviceId
 	version := "1.0"
+	token := config.Get().Auth.Token
 	// 序列化握手消息
-	pkg, serializeErr := serializer.SerializeMessage(
+	pkg, serializeErr := serializer.CodecFromCtx(h.Client.Ctx).SerializeMessage(
 		message.CommandType_CommandType_HandShakeReq,
 		&message.MSG_HANDSHAKE_REQ{
-			Version:  &version,
-			DeviceId: &deviceId,
+			Version:      &version,
+			DeviceId:     &deviceId,
+			Features:     localFeatures(),
+			Compressions: localCompressions(),
+			Token:        &token,
 		},
 	)
 	if serializeErr != nil {
@@ -57,37 +70,102 @@ func (h *ClientMsgHandler) HandshakeReq() error {
 	return nil
 }
 
-func (h *ClientMsgHandler) HandleHandshakeResp(payload *message.MSG_HANDSHAKE_RESP) (err error) {
-	l := logger.FromCtx(h.Client.Ctx)
-	l.Debug(fmt.Sprintf("握手响应回调函数执行, 返回码: %v, 消息内容: %v", *payload.Code, *payload.Message))
-	if *payload.Code == 0 {
+// HandleHandshakeResp 处理握手响应
+func (h *ClientMsgHandler) HandleHandshakeResp(ctx context.Context, _session *socket.Session, payload *message.MSG_HANDSHAKE_RESP) (err error) {
+	l := logger.FromCtx(ctx)
+	l.Debug(fmt.Sprintf("握手响应回调函数执行, 返回码: %v, 消息内容: %v", payload.GetCode(), payload.GetMessage()))
+	if payload.GetCode() == 0 {
+		err = applyFeatures(serializer.CodecFromCtx(ctx), payload.GetFeatures(), payload.GetCompression())
+		if err != nil {
+			return fmt.Errorf("应用握手协商结果失败: %v", err)
+		}
+		// 服务端会回复心跳响应时，长时间收不到任何消息说明连接已半开
+		if slices.Contains(payload.GetFeatures(), featureHeartbeatAck) {
+			socket.SetIdleTimeout(ctx, config.Get().Msg.IdleReadTimeout())
+		}
 		err = h.handshakeSuccess()
 	} else {
-		err = h.handshakeFail()
+		err = h.handshakeFail(payload.GetCode(), payload.GetMessage())
 	}
 	return err
 }
 
-// HandleHandshakeReq 处理握手包
-func (h *ServerMsgHandler) HandleHandshakeReq(conn net.Conn, payload *message.MSG_HANDSHAKE_REQ, ctx context.Context) error {
+// HandleHandshakeReq 处理握手包，认证通过后才会创建会话
+func (h *ServerMsgHandler) HandleHandshakeReq(ctx context.Context, _session *socket.Session, payload *message.MSG_HANDSHAKE_REQ) error {
+	conn := _session.Conn
+	// 连接数超过服务端限制时直接拒绝握手，客户端退避后重连
+	if rejected := socket.AdmissionFromCtx(ctx); rejected != nil {
+		return h.rejectHandshake(conn, enums.ResponseCode_Overload, rejected.Error(), ctx)
+	}
+	// 认证器需要质询时先下发质询，收到应答后再认证
+	if h.authenticator().NeedChallenge() {
+		return h.sendAuthChallenge(conn, payload, ctx)
+	}
+	return h.authenticate(conn, payload, nil, nil, ctx)
+}
+
+// acceptHandshake 握手成功，创建会话并回复握手响应
+func (h *ServerMsgHandler) acceptHandshake(conn net.Conn, payload *message.MSG_HANDSHAKE_REQ, result *auth.Result, ctx context.Context) error {
 	l := logger.FromCtx(ctx)
-	// 将客户端加入SessionMap
-	h.Server.SessionMap[conn] = socket.Session{
-		DiverId:       payload.GetDeviceId(),
+	// 会话的设备ID使用认证后的身份，mTLS连接以客户端证书主题为准，不信任客户端上报的设备ID
+	deviceId := result.Identity
+	if identity, ok := auth.PeerIdentity(conn); ok {
+		deviceId = identity
+	}
+	if deviceId == "" {
+		return h.rejectAuth(conn, fmt.Errorf("%w: 认证身份为空", auth.ErrUnauthenticated), ctx)
+	}
+	if claimed := payload.GetDeviceId(); claimed != deviceId {
+		l.Warn(fmt.Sprintf("客户端上报的设备ID: %v 与认证身份: %v 不一致，以认证身份为准", claimed, deviceId))
+	}
+	features := negotiateFeatures(payload.GetFeatures())
+	compression := negotiateCompression(payload.GetCompressions())
+	// 将客户端加入会话管理器
+	h.Server.Sessions.Add(conn, socket.Session{
+		DiverId:       deviceId,
 		LastAliveTime: utils.GetCurrentTimestamp(),
 		Ctx:           ctx,
-	}
-	l.Debug(fmt.Sprintf("Server当前会话: %v", h.Server.SessionMap))
+		Identity:      result.Identity,
+		Roles:         result.Roles,
+		Labels:        result.Labels,
+		Features:      features,
+	})
+	l.Debug(fmt.Sprintf("Server当前会话数: %v", h.Server.Sessions.Len()))
 	// 开始心跳检查
 	h.Server.StartHeartbeatChecker(conn)
 
-	code := int32(0)
+	code := int32(enums.ResponseCode_Success)
 	respMsg := "success"
+	respPayload := &message.MSG_HANDSHAKE_RESP{
+		Code:        &code,
+		Message:     &respMsg,
+		Features:    features,
+		Compression: &compression,
+	}
+	if err := h.writeHandshakeResp(conn, respPayload, ctx); err != nil {
+		return err
+	}
+	// 握手响应发出后，后续消息按协商结果编码
+	return applyFeatures(serializer.CodecFromCtx(ctx), features, compression)
+}
+
+// rejectHandshake 握手失败，回复非0响应码，返回的错误会使服务端关闭连接
+func (h *ServerMsgHandler) rejectHandshake(conn net.Conn, responseCode enums.ResponseCode, reason string, ctx context.Context) error {
+	code := int32(responseCode)
 	respPayload := &message.MSG_HANDSHAKE_RESP{
 		Code:    &code,
-		Message: &respMsg,
+		Message: &reason,
+	}
+	if err := h.writeHandshakeResp(conn, respPayload, ctx); err != nil {
+		return err
 	}
-	pkg, serializeErr := serializer.SerializeMessage(
+	return fmt.Errorf("Server, 拒绝客户端握手: %v, Client: %v", reason, conn.RemoteAddr())
+}
+
+// writeHandshakeResp 发送握手响应
+func (h *ServerMsgHandler) writeHandshakeResp(conn net.Conn, respPayload *message.MSG_HANDSHAKE_RESP, ctx context.Context) error {
+	l := logger.FromCtx(ctx)
+	pkg, serializeErr := serializer.CodecFromCtx(ctx).SerializeMessage(
 		message.CommandType_CommandType_HandShakeResp,
 		respPayload,
 	)
@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
+	"tcpsocketv2/internal/serializer"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"tcpsocketv2/pkg/utils"
+	"testing"
+	"time"
+)
+
+// initConfig 从临时目录加载测试配置，未配置的项使用默认值，返回配置所在的目录
+func initConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config", "test.config.yaml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TCPSOCKET_ENV", "test")
+	old := config.Cfg
+	t.Cleanup(func() { config.Cfg = old })
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(pwd) }()
+	config.Init()
+	return dir
+}
+
+// startServer 在本地随机端口启动服务端，测试结束时关闭
+func startServer(t *testing.T, authenticator auth.Authenticator) (*socket.Server, int) {
+	t.Helper()
+	server := socket.NewServer("127.0.0.1", 0)
+	NewServerMsgHandler(server)
+	if authenticator != nil {
+		server.SetAuthenticator(authenticator)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		_ = server.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+	// 不建立探测连接，避免占用连接数和接受速率的限制
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if addr := server.Addr(); addr != nil {
+			return server, addr.(*net.TCPAddr).Port
+		}
+	}
+	t.Fatal("server not listening")
+	return nil, 0
+}
+
+// startClient 启动客户端，测试结束时停止
+func startClient(t *testing.T, port int) *socket.Client {
+	t.Helper()
+	client, cancel := socket.NewClient("127.0.0.1", port)
+	NewClientMsgHandler(client)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.Run()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return client
+}
+
+// waitSession 等待服务端创建指定设备的会话
+func waitSession(t *testing.T, server *socket.Server, deviceId string) socket.Session {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _session, ok := server.Sessions.GetByDevice(deviceId); ok {
+			return _session
+		}
+	}
+	t.Fatalf("session of %v not created", deviceId)
+	return socket.Session{}
+}
+
+func TestHandshakeUsesAuthenticatedIdentity(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nauth:\n  token: secret-token\n")
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokenFile, []byte("secret-token device-a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.NewTokenAuthenticator(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, port := startServer(t, authenticator)
+	client := startClient(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话以令牌对应的身份作为设备ID，而不是客户端上报的设备ID
+	_session := waitSession(t, server, "device-a")
+	if _session.Identity != "device-a" {
+		t.Fatalf("identity = %v, want device-a", _session.Identity)
+	}
+	claimed, err := utils.GetFQDN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed != "device-a" {
+		if _, ok := server.Sessions.GetByDevice(claimed); ok {
+			t.Fatalf("session indexed by claimed device id %v", claimed)
+		}
+	}
+}
+
+func TestClientConnectedAfterHandshake(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client := startClient(t, listener.Addr().(*net.TCPAddr).Port)
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先于停止客户端关闭连接
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// 收到握手请求但尚未响应时，客户端仍处于连接中
+	codec := serializer.NewCodec()
+	command, payload, err := codec.DeserializeMessage(bufio.NewReader(conn), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != message.CommandType_CommandType_HandShakeReq || payload.(*message.MSG_HANDSHAKE_REQ).GetDeviceId() == "" {
+		t.Fatalf("got %v %v, want handshake request", command, payload)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if status := client.Status(); status != enums.ClientStatusConnecting {
+		t.Fatalf("status before handshake response = %v, want connecting", status)
+	}
+
+	resp, err := codec.SerializeMessage(message.CommandType_CommandType_HandShakeResp, &message.MSG_HANDSHAKE_RESP{
+		Code:    proto.Int32(int32(enums.ResponseCode_Success)),
+		Message: proto.String("success"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(resp); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	history := client.StateHistory()
+	last := history[len(history)-1]
+	if last.From != enums.ClientStatusConnecting || last.To != enums.ClientStatusConnected {
+		t.Fatalf("last transition = %v -> %v", last.From, last.To)
+	}
+}
+
+func TestClientHandshakeRejected(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nauth:\n  token: wrong-token\n")
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokenFile, []byte("secret-token device-a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.NewTokenAuthenticator(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, port := startServer(t, authenticator)
+	client := startClient(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = client.WaitFor(enums.ClientStatusError, ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 握手被拒绝的客户端从未进入已连接状态，服务端也没有创建会话
+	for _, transition := range client.StateHistory() {
+		if transition.To == enums.ClientStatusConnected {
+			t.Fatalf("client connected before handshake was accepted: %v", client.StateHistory())
+		}
+	}
+	if server.Sessions.Len() != 0 {
+		t.Fatalf("sessions = %v, want 0", server.Sessions.Len())
+	}
+}
+
+// fakeHandshake 模拟服务端：读取握手请求并回复启用了指定特性的握手响应
+func fakeHandshake(t *testing.T, conn net.Conn, features ...string) {
+	t.Helper()
+	codec := serializer.NewCodec()
+	if _, _, err := codec.DeserializeMessage(bufio.NewReader(conn), context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := codec.SerializeMessage(message.CommandType_CommandType_HandShakeResp, &message.MSG_HANDSHAKE_RESP{
+		Code:     proto.Int32(int32(enums.ResponseCode_Success)),
+		Message:  proto.String("success"),
+		Features: features,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientDetectsHalfOpenConnection(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  heartbeat_interval: 1\n  idle_timeout: 3\n")
+	for _, tt := range []struct {
+		name     string
+		features []string
+		idle     bool
+	}{
+		// 服务端同意回复心跳响应后不再发送任何消息，客户端在空闲超时后断开
+		{"heartbeat ack negotiated", []string{featureHeartbeatAck}, true},
+		// 旧版服务端不回复心跳响应，客户端不设置空闲超时
+		{"legacy server", nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			client := startClient(t, listener.Addr().(*net.TCPAddr).Port)
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			fakeHandshake(t, conn, tt.features...)
+			// 持续读取客户端的心跳但从不回复
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					if _, readErr := conn.Read(buf); readErr != nil {
+						return
+					}
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err = client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+				t.Fatal(err)
+			}
+			err = client.WaitFor(enums.ClientStatusDisConnected, ctx)
+			if tt.idle {
+				if err != nil {
+					t.Fatalf("client still connected to a silent server: %v", err)
+				}
+				if client.Metrics.IdleTimeouts.Load() != 1 {
+					t.Fatalf("idle timeouts = %v, want 1", client.Metrics.IdleTimeouts.Load())
+				}
+				return
+			}
+			if err == nil || client.Metrics.IdleTimeouts.Load() != 0 {
+				t.Fatalf("client disconnected from legacy server: %v", client.StateHistory())
+			}
+		})
+	}
+}
+
+func TestHeartbeatAckKeepsClientConnected(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  heartbeat_interval: 1\n  idle_timeout: 3\n")
+	server, port := startServer(t, nil)
+	client := startClient(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 超过空闲超时后，收到心跳响应的客户端仍保持连接；采集性能数据需要约1秒，实际心跳间隔约为2秒
+	time.Sleep(4500 * time.Millisecond)
+	if status := client.Status(); status != enums.ClientStatusConnected {
+		t.Fatalf("status = %v, history = %v", status, client.StateHistory())
+	}
+	if client.Metrics.IdleTimeouts.Load() != 0 || server.Metrics.IdleTimeouts.Load() != 0 {
+		t.Fatalf("idle timeouts: client = %v, server = %v", client.Metrics.IdleTimeouts.Load(), server.Metrics.IdleTimeouts.Load())
+	}
+}
+
+func TestCommandBeforeHandshakeRejected(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	server, port := startServer(t, nil)
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 未握手就发送心跳，服务端回复错误后关闭连接
+	codec := serializer.NewCodec()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, &message.MSG_HEARTBEAT{
+		Os:  proto.String("linux"),
+		Cpu: proto.Float64(1),
+		Mem: proto.Float64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	command, payload, err := codec.DeserializeMessage(reader, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != message.CommandType_CommandType_Error {
+		t.Fatalf("got %v %v, want error", command, payload)
+	}
+	if reply := payload.(*message.MSG_ERROR); reply.GetCode() != int32(enums.ResponseCode_NotHandshaken) || reply.GetCommand() != message.CommandType_CommandType_Heartbeat {
+		t.Fatalf("error reply = %v", reply)
+	}
+	if _, _, err = codec.DeserializeMessage(reader, context.Background()); err != io.EOF {
+		t.Fatalf("err = %v, want connection closed", err)
+	}
+	if server.Sessions.Len() != 0 {
+		t.Fatalf("sessions = %v, want 0", server.Sessions.Len())
+	}
+}
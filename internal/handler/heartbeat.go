@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"context"
 	"fmt"
-	"net"
+	"google.golang.org/protobuf/proto"
+	"slices"
 	"tcpsocketv2/common/logger"
 	"tcpsocketv2/internal/serializer"
 	"tcpsocketv2/internal/socket"
@@ -22,7 +24,7 @@ func (h *ClientMsgHandler) HeartbeatReq() error {
 		Mem: &men,
 	}
 	// 序列化心跳包
-	pkg, err := serializer.SerializeMessage(
+	pkg, err := serializer.CodecFromCtx(h.Client.Ctx).SerializeMessage(
 		message.CommandType_CommandType_Heartbeat,
 		heartbeat,
 	)
@@ -39,21 +41,39 @@ func (h *ClientMsgHandler) HeartbeatReq() error {
 }
 
 // HandleHeartbeatReq 处理心跳包
-func (h *ServerMsgHandler) HandleHeartbeatReq(conn net.Conn, payload *message.MSG_HEARTBEAT) error {
-	_session, ok := h.Server.GetSession(conn)
+func (h *ServerMsgHandler) HandleHeartbeatReq(ctx context.Context, _session *socket.Session, payload *message.MSG_HEARTBEAT) error {
+	conn := _session.Conn
+	// 在会话管理器的锁内修改会话，避免与心跳检测并发修改时相互覆盖
+	updated, ok := h.Server.Sessions.Modify(conn, func(_session *socket.Session) {
+		_session.ClientSpec = socket.Spec{
+			Os:  payload.GetOs(),
+			Cpu: payload.GetCpu(),
+			Mem: payload.GetMem(),
+		}
+		_session.LastAliveTime = utils.GetCurrentTimestamp()
+	})
 	if !ok {
 		return fmt.Errorf("未找到对应的会话")
 	}
-
-	// 修改会话信息
-	_session.ClientSpec = socket.Spec{
-		Os:  *payload.Os,
-		Cpu: *payload.Cpu,
-		Mem: *payload.Mem,
+	// 客户端依靠心跳响应判断连接是否可用，旧版客户端未协商该特性，不回复
+	if !slices.Contains(updated.Features, featureHeartbeatAck) {
+		return nil
+	}
+	pkg, err := serializer.CodecFromCtx(ctx).SerializeMessage(
+		message.CommandType_CommandType_HeartbeatAck,
+		&message.MSG_HEARTBEAT_ACK{Timestamp: proto.Int64(updated.LastAliveTime)},
+	)
+	if err != nil {
+		return fmt.Errorf("序列化心跳响应异常: %v", err)
 	}
-	_session.LastAliveTime = utils.GetCurrentTimestamp()
-	// 更新会话
-	h.Server.UpdateSession(conn, _session)
+	if _, err = conn.Write(pkg); err != nil {
+		return fmt.Errorf("发送心跳响应失败: %v", err)
+	}
+	return nil
+}
 
+// HandleHeartbeatAck 处理心跳响应，收到消息时已延后空闲超时，这里只记录日志
+func (h *ClientMsgHandler) HandleHeartbeatAck(ctx context.Context, _session *socket.Session, payload *message.MSG_HEARTBEAT_ACK) error {
+	logger.FromCtx(ctx).Debug(fmt.Sprintf("收到心跳响应, 服务端时间: %v", payload.GetTimestamp()))
 	return nil
 }
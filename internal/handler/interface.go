@@ -1,33 +1,57 @@
 package handler
 
 import (
+	"net"
+	"sync"
 	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
 )
 
 // ServerMsgHandler 服务端消息处理
 type ServerMsgHandler struct {
-	Server socket.Server
+	Server *socket.Server // 与调用方共享同一个服务端实例
+
+	authMu       sync.Mutex
+	pendingAuth  map[net.Conn]pendingAuth // 已下发质询、等待应答的握手
+	authFailures map[string]authFailure   // 各来源IP的认证失败记录，过期的记录会被清理
 }
 
 // NewServerMsgHandler 创建服务端消息处理
 func NewServerMsgHandler(server *socket.Server) *ServerMsgHandler {
 	_handler := &ServerMsgHandler{
-		Server: *server,
+		Server:       server,
+		pendingAuth:  make(map[net.Conn]pendingAuth),
+		authFailures: make(map[string]authFailure),
 	}
-	_handler.Server.Handler = _handler
+	_handler.Server.RegisterHandler(_handler)
 	return _handler
 }
 
+// RegisterCommands 注册服务端处理的指令
+func (h *ServerMsgHandler) RegisterCommands(registry *socket.Registry) {
+	socket.Register(registry, message.CommandType_CommandType_HandShakeReq, h.HandleHandshakeReq)
+	socket.Register(registry, message.CommandType_CommandType_Heartbeat, h.HandleHeartbeatReq)
+	socket.Register(registry, message.CommandType_CommandType_AuthResp, h.HandleAuthResp)
+}
+
 // ClientMsgHandler 客户端消息处理
 type ClientMsgHandler struct {
-	Client socket.Client
+	Client   *socket.Client // 与调用方共享同一个客户端实例，状态变更对所有协程可见
+	deviceId string         // 握手时上报的设备ID
 }
 
 // NewClientMsgHandler 创建客户端消息处理
 func NewClientMsgHandler(client *socket.Client) *ClientMsgHandler {
 	_handler := &ClientMsgHandler{
-		Client: *client,
+		Client: client,
 	}
-	_handler.Client.Handler = _handler
+	_handler.Client.RegisterHandler(_handler)
 	return _handler
 }
+
+// RegisterCommands 注册客户端处理的指令
+func (h *ClientMsgHandler) RegisterCommands(registry *socket.Registry) {
+	socket.Register(registry, message.CommandType_CommandType_HandShakeResp, h.HandleHandshakeResp)
+	socket.Register(registry, message.CommandType_CommandType_AuthChallenge, h.HandleAuthChallenge)
+	socket.Register(registry, message.CommandType_CommandType_HeartbeatAck, h.HandleHeartbeatAck)
+}
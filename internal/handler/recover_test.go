@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+func TestHandlerPanicClosesOnlyItsConnection(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	server, port := startServer(t, nil)
+	// 消息体缺少字段时解引用空指针
+	socket.Register(server.Commands, message.CommandType_CommandType_TaskOutput, func(ctx context.Context, session *socket.Session, payload *message.MSG_TASK_OUTPUT) error {
+		var missing *message.MSG_HEARTBEAT
+		_ = *missing.Os
+		return nil
+	})
+	faulty := dialDevice(t, server, port, "device-panic")
+	healthy := dialDevice(t, server, port, "device-healthy")
+
+	// 发生 panic 的连接被关闭，服务端进程不受影响
+	faulty.send(t, message.CommandType_CommandType_TaskOutput, &message.MSG_TASK_OUTPUT{
+		TaskId: proto.String("task-panic"),
+		Seq:    proto.Int64(1),
+		Data:   []byte("output"),
+	})
+	faulty.expectClosed(t)
+	waitMetric(t, "panics", server.Metrics.Panics.Load, 1)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, ok := server.Sessions.GetByDevice("device-panic"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session of panicked connection not removed")
+		}
+	}
+
+	// 其他连接的消息仍由各自的处理函数处理
+	healthy.send(t, message.CommandType_CommandType_Heartbeat, &message.MSG_HEARTBEAT{
+		Os:  proto.String("after panic"),
+		Cpu: proto.Float64(1),
+		Mem: proto.Float64(1),
+	})
+	handled := false
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && !handled; time.Sleep(10 * time.Millisecond) {
+		_session, ok := server.Sessions.GetByDevice("device-healthy")
+		handled = ok && _session.ClientSpec.Os == "after panic"
+	}
+	if !handled {
+		t.Fatal("heartbeat on healthy connection not handled after panic")
+	}
+	// 之后的新连接可以正常握手
+	dialDevice(t, server, port, "device-after-panic")
+	if panics := server.Metrics.Panics.Load(); panics != 1 {
+		t.Fatalf("panics = %v, want 1", panics)
+	}
+}
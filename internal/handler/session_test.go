@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"tcpsocketv2/internal/serializer"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// runDevice 模拟一个设备：握手后发送心跳，直到服务端记录了最后一次心跳
+func runDevice(server *socket.Server, port int, deviceId string, heartbeats int) (net.Conn, error) {
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	codec := serializer.NewCodec()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_HandShakeReq, &message.MSG_HANDSHAKE_REQ{
+		Version:  proto.String("1.0"),
+		DeviceId: proto.String(deviceId),
+		Token:    proto.String(""),
+	})
+	if err != nil {
+		return conn, err
+	}
+	if _, err = conn.Write(data); err != nil {
+		return conn, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, payload, err := codec.DeserializeMessage(bufio.NewReader(conn), context.Background())
+	if err != nil {
+		return conn, err
+	}
+	if code := payload.(*message.MSG_HANDSHAKE_RESP).GetCode(); code != 0 {
+		return conn, fmt.Errorf("%v: handshake code %v", deviceId, code)
+	}
+	last := ""
+	for i := 0; i < heartbeats; i++ {
+		last = fmt.Sprintf("%v-%v", deviceId, i)
+		data, err = codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, &message.MSG_HEARTBEAT{
+			Os:  proto.String(last),
+			Cpu: proto.Float64(1),
+			Mem: proto.Float64(1),
+		})
+		if err != nil {
+			return conn, err
+		}
+		if _, err = conn.Write(data); err != nil {
+			return conn, err
+		}
+	}
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _session, ok := server.Sessions.GetByDevice(deviceId); ok && _session.ClientSpec.Os == last {
+			return conn, nil
+		}
+	}
+	return conn, fmt.Errorf("%v: heartbeat %v not handled", deviceId, last)
+}
+
+func TestManyConcurrentClients(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	server, port := startServer(t, nil)
+	var added, removed atomic.Int64
+	server.Sessions.OnEvent(func(event socket.SessionEvent, _session socket.Session) {
+		switch event {
+		case socket.SessionAdded:
+			added.Add(1)
+		case socket.SessionRemoved:
+			removed.Add(1)
+		}
+	})
+
+	// 客户端读写会话的同时，并发地遍历和查询会话
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, _session := range server.Sessions.Snapshot() {
+					server.Sessions.GetByAddr(_session.RemoteAddr)
+					server.Sessions.GetByDevice(_session.DiverId)
+				}
+				server.Sessions.Range(func(socket.Session) bool { return true })
+				server.Sessions.Len()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	const clients = 50
+	conns := make([]net.Conn, clients)
+	errs := make(chan error, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := runDevice(server, port, fmt.Sprintf("device-%v", i), 5)
+			conns[i] = conn
+			if err != nil {
+				errs <- err
+				return
+			}
+			// 一半的客户端断开连接
+			if i%2 == 1 {
+				_ = conn.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		close(done)
+		readers.Wait()
+		return
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); server.Sessions.Len() != clients/2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(done)
+	readers.Wait()
+	if n := server.Sessions.Len(); n != clients/2 {
+		t.Fatalf("sessions = %v, want %v", n, clients/2)
+	}
+	if added.Load() != clients || removed.Load() != clients/2 {
+		t.Fatalf("added = %v, removed = %v, want %v, %v", added.Load(), removed.Load(), clients, clients/2)
+	}
+	// 剩余会话的各个索引保持一致
+	for i := 0; i < clients; i += 2 {
+		deviceId := fmt.Sprintf("device-%v", i)
+		_session, ok := server.Sessions.GetByDevice(deviceId)
+		if !ok {
+			t.Fatalf("session of %v missing", deviceId)
+		}
+		if _session.ClientSpec.Os != deviceId+"-4" {
+			t.Fatalf("%v: os = %v, want last heartbeat", deviceId, _session.ClientSpec.Os)
+		}
+		byAddr, ok := server.Sessions.GetByAddr(conns[i].LocalAddr().String())
+		if !ok || byAddr.DiverId != deviceId {
+			t.Fatalf("GetByAddr(%v) = %v, %v", conns[i].LocalAddr(), byAddr.DiverId, ok)
+		}
+	}
+}
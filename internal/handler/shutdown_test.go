@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownWithinDrainTimeout(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  drain_timeout: 1\n")
+	server, port := startServer(t, nil)
+	d := dialDevice(t, server, port, "device-silent")
+
+	// 客户端收到通知后既不发送消息也不关闭连接，排空超时后服务端关闭连接
+	result := shutdownAsync(server, 10*time.Second)
+	d.readGoodbye(t)
+	shutdown := waitShutdown(t, result)
+	if shutdown.err != nil {
+		t.Fatal(shutdown.err)
+	}
+	if shutdown.elapsed < time.Second || shutdown.elapsed >= 5*time.Second {
+		t.Fatalf("shutdown took %v, want about the drain timeout", shutdown.elapsed)
+	}
+}
+
+func TestShutdownForceClose(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\nmsg:\n  drain_timeout: 30\n")
+	server, port := startServer(t, nil)
+	d := dialDevice(t, server, port, "device-stuck")
+
+	// 排空时间超过关闭期限时强制关闭剩余连接
+	result := shutdownAsync(server, 500*time.Millisecond)
+	d.readGoodbye(t)
+	shutdown := waitShutdown(t, result)
+	if !errors.Is(shutdown.err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown err = %v, want %v", shutdown.err, context.DeadlineExceeded)
+	}
+	if shutdown.elapsed >= 5*time.Second {
+		t.Fatalf("shutdown took %v, want about the shutdown deadline", shutdown.elapsed)
+	}
+	if server.Sessions.Len() != 0 {
+		t.Fatalf("sessions = %v after force close", server.Sessions.Len())
+	}
+}
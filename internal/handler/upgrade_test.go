@@ -0,0 +1,86 @@
+//go:build !windows
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// envUpgradeConfigDir 热升级测试中新进程读取配置的目录
+const envUpgradeConfigDir = "TCPSOCKET_TEST_UPGRADE_DIR"
+
+func TestMain(m *testing.M) {
+	// 热升级测试重新执行测试程序，新进程只作为服务端运行
+	if os.Getenv("TCPSOCKET_LISTENER_FD") != "" {
+		os.Exit(runUpgradedServer())
+	}
+	os.Exit(m.Run())
+}
+
+// runUpgradedServer 热升级后的新进程：使用继承的监听socket提供服务，测试连接断开后退出
+func runUpgradedServer() int {
+	if err := os.Chdir(os.Getenv(envUpgradeConfigDir)); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	config.Init()
+	server := socket.NewServer("127.0.0.1", 0)
+	NewServerMsgHandler(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Sessions.OnEvent(func(event socket.SessionEvent, _ socket.Session) {
+		if event == socket.SessionRemoved {
+			cancel()
+		}
+	})
+	if err := server.Serve(ctx); err != nil && !errors.Is(err, socket.ErrServerClosed) {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func TestUpgradeHandsOverListener(t *testing.T) {
+	dir := initConfig(t, "reconnect:\n  enable: false\nsrvInfo:\n  restart_spread: 2\nmsg:\n  drain_timeout: 5\n")
+	t.Setenv(envUpgradeConfigDir, dir)
+	server, port := startServer(t, nil)
+	d := dialDevice(t, server, port, "device-before-upgrade")
+
+	// 新进程开始监听后 Upgrade 才返回
+	if err := server.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	// 旧进程通知已连接的客户端分散重连，而不是保持连接
+	goodbye := d.readGoodbye(t)
+	if goodbye.GetCode() != int32(enums.GoodbyeCode_Restart) || goodbye.GetReconnectAfter() < 0 || goodbye.GetReconnectAfter() >= 2 {
+		t.Fatalf("goodbye = %v, want restart within spread", goodbye)
+	}
+	_ = d.conn.Close()
+
+	// 旧进程已停止接受连接，同一端口由新进程继续应答
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("port not answering after upgrade: %v", err)
+	}
+	defer conn.Close()
+	after := newDevice(conn)
+	after.send(t, message.CommandType_CommandType_HandShakeReq, handshakeReq("device-after-upgrade"))
+	if command, payload := after.read(t); command != message.CommandType_CommandType_HandShakeResp ||
+		payload.(*message.MSG_HANDSHAKE_RESP).GetCode() != 0 {
+		t.Fatalf("got %v %v, want accepted handshake from new process", command, payload)
+	}
+	if _, ok := server.Sessions.GetByDevice("device-after-upgrade"); ok {
+		t.Fatal("old process accepted a connection after upgrade")
+	}
+}
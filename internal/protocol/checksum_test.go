@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeChecksum(t *testing.T) {
+	payload := []byte("hello frame")
+	runDecodeCases(t, []decodeCase{
+		{
+			name:        "新版帧带校验和",
+			data:        mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: payload}),
+			opts:        DecodeOptions{},
+			wantPayload: payload,
+			wantVersion: HeaderVersion,
+		},
+		{
+			name:        "要求校验和",
+			data:        mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: payload}),
+			opts:        DecodeOptions{RequireChecksum: true},
+			wantPayload: payload,
+			wantVersion: HeaderVersion,
+		},
+		{
+			name:    "要求校验和时缺少标志位",
+			data:    append(mustEncode(t, &Frame{Version: HeaderVersion, Payload: payload}), 0, 0, 0, 0),
+			opts:    DecodeOptions{RequireChecksum: true},
+			wantErr: ErrChecksum,
+		},
+		{
+			name:    "要求校验和时收到旧版帧",
+			data:    legacyFrame(int32(len(payload)), payload),
+			opts:    DecodeOptions{AllowLegacy: true, RequireChecksum: true},
+			wantErr: ErrBadMagic,
+		},
+	})
+}
+
+func TestDecodeFrameChecksumMismatch(t *testing.T) {
+	data := mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: []byte("payload")})
+	data[headerLength] ^= 0xFF
+	next := mustEncode(t, &Frame{Version: HeaderVersion, Payload: []byte("next")})
+	reader := bufio.NewReader(bytes.NewReader(append(data, next...)))
+	if _, err := DecodeFrame(reader, DecodeOptions{}); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("err = %v, want %v", err, ErrChecksum)
+	}
+	// 校验失败的帧已被完整读出，下一帧仍能正常解析
+	frame, err := DecodeFrame(reader, DecodeOptions{})
+	if err != nil || string(frame.Payload) != "next" {
+		t.Fatalf("next frame = %v, %v", frame, err)
+	}
+}
+
+func TestDecodeChecksumFlagCleared(t *testing.T) {
+	// 传输中校验和标志位被清除，帧尾仍被读出，数据流保持同步
+	data := mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: []byte("payload")})
+	data[len(Magic)+1] &^= byte(FlagChecksum)
+	next := mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: []byte("next")})
+	reader := bufio.NewReader(bytes.NewReader(append(data, next...)))
+	opts := DecodeOptions{RequireChecksum: true}
+	if _, err := DecodeFrame(reader, opts); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("err = %v, want %v", err, ErrChecksum)
+	}
+	frame, err := DecodeFrame(reader, opts)
+	if err != nil || string(frame.Payload) != "next" {
+		t.Fatalf("next frame = %v, %v", frame, err)
+	}
+
+	// 未要求校验和时，同样的帧被当作不带校验和的帧接受，帧尾混入数据流
+	reader = bufio.NewReader(bytes.NewReader(append(data, next...)))
+	if _, err = DecodeFrame(reader, DecodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecodeFrame(reader, DecodeOptions{}); err == nil {
+		t.Fatal("stream still in sync after skipping the trailer")
+	}
+}
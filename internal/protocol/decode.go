@@ -4,31 +4,100 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"hash/crc32"
+	"io"
 )
 
-// Decode 自定义协议消息解码
-func Decode(reader *bufio.Reader) ([]byte, error) {
-	// 1. 读取头部信息，获取数据长度
-	lengthByte, err := reader.Peek(4)
+// Decode 自定义协议消息解码，阻塞直到读取到完整的一帧数据，同时兼容新旧两种帧格式
+// maxFrameSize 为单帧允许的最大长度，小于等于0时使用 DefaultMaxFrameSize
+func Decode(reader *bufio.Reader, maxFrameSize int) ([]byte, error) {
+	frame, err := DecodeFrame(reader, DecodeOptions{MaxFrameSize: maxFrameSize, AllowLegacy: true})
 	if err != nil {
 		return nil, err
 	}
-	lengthBuffer := bytes.NewBuffer(lengthByte)
-	var length int32
-	err = binary.Read(lengthBuffer, binary.LittleEndian, &length)
+	return frame.Payload, nil
+}
+
+// DecodeFrame 解码一帧数据，根据魔数判断帧格式
+func DecodeFrame(reader *bufio.Reader, opts DecodeOptions) (*Frame, error) {
+	maxFrameSize := opts.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	frame := &Frame{Version: LegacyVersion, Flags: FlagNone}
+
+	// 1. 读取头部信息，根据魔数区分新旧帧格式
+	prefix, err := reader.Peek(len(Magic))
 	if err != nil {
+		// 连接在帧边界处关闭
+		if err == io.EOF && len(prefix) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
-	// 2. Buffered 返回缓冲区中现有的可读字节数，如果获取的字节数小于消息的长度则说明数据包有误
-	if int32(reader.Buffered()) < length+4 {
-		return nil, err
+	var header []byte
+	if bytes.Equal(prefix, Magic[:]) {
+		header = make([]byte, headerLength)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, unexpected(err)
+		}
+		frame.Version = header[len(Magic)]
+		frame.Flags = Flag(header[len(Magic)+1])
+		if frame.Version == LegacyVersion || frame.Version > HeaderVersion {
+			return nil, ErrUnsupportedVersion
+		}
+		// 未知的标志位可能改变帧结构，无法安全地继续解析
+		if frame.Flags&^knownFlags != 0 {
+			return nil, ErrUnsupportedFlags
+		}
+	} else {
+		// 已协商校验和的对端不会再发送旧版帧，魔数不匹配说明数据流已经错乱
+		if !opts.AllowLegacy || opts.RequireChecksum {
+			return nil, ErrBadMagic
+		}
+		header = make([]byte, legacyHeaderLength)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, unexpected(err)
+		}
 	}
+	length := int32(binary.LittleEndian.Uint32(header[len(header)-4:]))
 
-	// 3. 读取消息内容
-	pack := make([]byte, int(4+length))
-	_, err = reader.Read(pack)
-	if err != nil {
-		return nil, err
+	// 2. 校验数据长度，非法长度说明数据流已经错乱，无法继续解析
+	if length < 0 {
+		return nil, ErrInvalidLength
+	}
+	if int64(length) > int64(maxFrameSize) {
+		return nil, ErrMsgTooLong
+	}
+
+	// 3. 读取消息内容，数据包被拆分时会一直阻塞到完整读取
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(reader, frame.Payload); err != nil {
+		return nil, unexpected(err)
+	}
+
+	// 4. 校验帧尾的校验和，校验失败时整帧已被读出，数据流仍然可以继续解析；
+	// 要求校验和而帧缺少标志位时，标志位已被破坏，同样读出帧尾以保持数据流同步
+	if frame.Flags.Has(FlagChecksum) || opts.RequireChecksum {
+		trailer := make([]byte, checksumLength)
+		if _, err := io.ReadFull(reader, trailer); err != nil {
+			return nil, unexpected(err)
+		}
+		if !frame.Flags.Has(FlagChecksum) {
+			return nil, ErrChecksum
+		}
+		checksum := crc32.Update(crc32.Checksum(header, crc32cTable), crc32cTable, frame.Payload)
+		if checksum != binary.LittleEndian.Uint32(trailer) {
+			return nil, ErrChecksum
+		}
+	}
+	return frame, nil
+}
+
+// unexpected 帧读取到一半时遇到EOF，说明数据不完整
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
 	}
-	return pack[4:], nil
+	return err
 }
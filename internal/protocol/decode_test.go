@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// legacyFrame 构造旧版帧：4字节长度 + 消息内容
+func legacyFrame(length int32, payload []byte) []byte {
+	buf := make([]byte, 4, 4+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(length))
+	return append(buf, payload...)
+}
+
+// mustEncode 编码测试帧
+func mustEncode(t *testing.T, frame *Frame) []byte {
+	t.Helper()
+	data, err := EncodeFrame(frame)
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+	return data
+}
+
+// decodeCase 帧解码的测试用例
+type decodeCase struct {
+	name        string
+	data        []byte
+	opts        DecodeOptions
+	wantPayload []byte
+	wantVersion uint8
+	wantErr     error
+}
+
+// runDecodeCases 分别以整帧和逐字节读取的方式解码每个用例
+func runDecodeCases(t *testing.T, tests []decodeCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每次只读出1个字节，模拟帧被拆分到多次读取中
+			readers := map[string]io.Reader{
+				"整帧": bytes.NewReader(tt.data),
+				"拆包": iotest.OneByteReader(bytes.NewReader(tt.data)),
+			}
+			for mode, r := range readers {
+				frame, err := DecodeFrame(bufio.NewReaderSize(r, 16), tt.opts)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("%v: err = %v, want %v", mode, err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%v: unexpected err: %v", mode, err)
+				}
+				if !bytes.Equal(frame.Payload, tt.wantPayload) {
+					t.Fatalf("%v: payload = %q, want %q", mode, frame.Payload, tt.wantPayload)
+				}
+				if frame.Version != tt.wantVersion {
+					t.Fatalf("%v: version = %v, want %v", mode, frame.Version, tt.wantVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	payload := []byte("hello frame")
+	runDecodeCases(t, []decodeCase{
+		{
+			name:        "旧版帧",
+			data:        legacyFrame(int32(len(payload)), payload),
+			opts:        DecodeOptions{AllowLegacy: true},
+			wantPayload: payload,
+			wantVersion: LegacyVersion,
+		},
+		{
+			name:        "旧版帧长度为0",
+			data:        legacyFrame(0, nil),
+			opts:        DecodeOptions{AllowLegacy: true},
+			wantPayload: []byte{},
+			wantVersion: LegacyVersion,
+		},
+		{
+			name:    "旧版帧长度为负数",
+			data:    legacyFrame(-5, nil),
+			opts:    DecodeOptions{AllowLegacy: true},
+			wantErr: ErrInvalidLength,
+		},
+		{
+			name:    "旧版帧超过最大长度",
+			data:    legacyFrame(17, make([]byte, 17)),
+			opts:    DecodeOptions{AllowLegacy: true, MaxFrameSize: 16},
+			wantErr: ErrMsgTooLong,
+		},
+		{
+			name:    "消息内容不完整",
+			data:    legacyFrame(10, []byte("abc")),
+			opts:    DecodeOptions{AllowLegacy: true},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "空数据流",
+			data:    nil,
+			opts:    DecodeOptions{AllowLegacy: true},
+			wantErr: io.EOF,
+		},
+	})
+}
+
+func TestDecodeConsecutiveFrames(t *testing.T) {
+	var stream []byte
+	want := []string{"first", "", "third"}
+	stream = append(stream, mustEncode(t, &Frame{Version: HeaderVersion, Payload: []byte(want[0])})...)
+	stream = append(stream, legacyFrame(0, nil)...)
+	stream = append(stream, mustEncode(t, &Frame{Version: HeaderVersion, Flags: FlagChecksum, Payload: []byte(want[2])})...)
+	reader := bufio.NewReader(iotest.HalfReader(bytes.NewReader(stream)))
+	for i, w := range want {
+		payload, err := Decode(reader, 0)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if string(payload) != w {
+			t.Fatalf("frame %d: payload = %q, want %q", i, payload, w)
+		}
+	}
+	if _, err := Decode(reader, 0); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+}
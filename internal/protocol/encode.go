@@ -3,16 +3,44 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
+	"hash/crc32"
+	"math"
 )
 
-// Encode 自定义协议消息编码
+// Encode 自定义协议消息编码，使用新版帧格式且不带任何标志位
 func Encode(data []byte) ([]byte, error) {
+	return EncodeFrame(&Frame{Version: HeaderVersion, Flags: FlagNone, Payload: data})
+}
+
+// EncodeLegacy 使用旧版帧格式编码，用于回复仍在使用旧版协议的对端
+func EncodeLegacy(data []byte) ([]byte, error) {
+	return EncodeFrame(&Frame{Version: LegacyVersion, Payload: data})
+}
+
+// EncodeFrame 按帧的版本号编码协议帧
+func EncodeFrame(frame *Frame) ([]byte, error) {
+	data := frame.Payload
+	if len(data) > math.MaxInt32 {
+		return nil, ErrMsgTooLong
+	}
+	if frame.Version > HeaderVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if frame.IsLegacy() && frame.Flags != FlagNone {
+		return nil, ErrUnsupportedFlags
+	}
 	// 1. 消息头：消息长度（4字节）
 	length := int32(len(data))
 	// 向系统为具有读写方法的字节大小可变的缓冲区申请内存
 	pkg := new(bytes.Buffer)
+	pkg.Grow(headerLength + len(data) + checksumLength)
 
-	// 2. 写入消息头
+	// 2. 写入消息头，新版格式先写入魔数、版本号和标志位
+	if !frame.IsLegacy() {
+		pkg.Write(Magic[:])
+		pkg.WriteByte(frame.Version)
+		pkg.WriteByte(byte(frame.Flags))
+	}
 	err := binary.Write(pkg, binary.LittleEndian, length)
 
 	if err != nil {
@@ -24,6 +52,14 @@ func Encode(data []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	// 4.返回封包完毕的缓冲区中数据
+	// 4. 写入校验和，覆盖帧头和消息体
+	if frame.Flags.Has(FlagChecksum) {
+		checksum := crc32.Checksum(pkg.Bytes(), crc32cTable)
+		err = binary.Write(pkg, binary.LittleEndian, checksum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 5.返回封包完毕的缓冲区中数据
 	return pkg.Bytes(), nil
 }
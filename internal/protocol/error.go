@@ -1,5 +1,29 @@
 package protocol
 
-import "errors"
+import (
+	"errors"
+	"io"
+)
 
 var ErrMsgTooLong = errors.New("message too long")
+
+var ErrInvalidLength = errors.New("invalid message length")
+
+var ErrBadMagic = errors.New("bad frame magic")
+
+var ErrUnsupportedVersion = errors.New("unsupported frame version")
+
+var ErrUnsupportedFlags = errors.New("unsupported frame flags")
+
+// ErrChecksum 帧校验和不匹配，数据在传输过程中被破坏
+var ErrChecksum = errors.New("frame checksum mismatch")
+
+// IsStreamBroken 判断解码错误是否导致数据流错乱，出现此类错误时只能关闭连接
+func IsStreamBroken(err error) bool {
+	return errors.Is(err, ErrMsgTooLong) ||
+		errors.Is(err, ErrInvalidLength) ||
+		errors.Is(err, ErrBadMagic) ||
+		errors.Is(err, ErrUnsupportedVersion) ||
+		errors.Is(err, ErrUnsupportedFlags) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
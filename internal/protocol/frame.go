@@ -0,0 +1,90 @@
+package protocol
+
+import "hash/crc32"
+
+// 帧格式说明
+//
+// 新版帧格式（HeaderVersion >= 1）:
+//
+//	| magic(4) | version(1) | flags(1) | length(4) | payload(length) | [crc32c(4)] |
+//
+// 设置 FlagChecksum 时帧尾追加4字节 CRC32C 校验和，覆盖帧头和消息内容。
+//
+// 旧版帧格式（LegacyVersion）:
+//
+//	| length(4) | payload(length) |
+//
+// 所有整数均为小端序。魔数最后一个字节的最高位为1，按旧版格式解析时长度为负数，
+// 因此两种格式可以无歧义地区分。
+
+// Magic 新版帧头魔数
+var Magic = [4]byte{0x54, 0x43, 0x50, 0xFA}
+
+const (
+	LegacyVersion uint8 = 0 // 旧版帧格式（仅包含长度）
+	HeaderVersion uint8 = 1 // 当前帧头版本号
+)
+
+const (
+	legacyHeaderLength = 4  // 旧版消息头长度
+	headerLength       = 10 // 新版消息头长度
+	checksumLength     = 4  // 校验和长度
+)
+
+// DefaultMaxFrameSize 默认单帧最大长度（4MB）
+const DefaultMaxFrameSize = 4 * 1024 * 1024
+
+// Flag 帧标志位
+type Flag uint8
+
+const (
+	FlagNone         Flag = 0
+	FlagChecksum     Flag = 1 << 0 // 帧尾携带 CRC32C 校验和
+	FlagCompressMask Flag = 7 << 1 // 消息内容使用的压缩算法编号，0 表示未压缩
+)
+
+// compressShift 压缩算法编号在标志位中的偏移
+const compressShift = 1
+
+// knownFlags 当前版本能够识别的标志位
+const knownFlags = FlagChecksum | FlagCompressMask
+
+// FeatureChecksum 握手时协商的校验和特性名称
+const FeatureChecksum = "crc32c"
+
+// crc32cTable CRC32C（Castagnoli）校验表
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Has 判断是否包含指定标志位
+func (f Flag) Has(flag Flag) bool {
+	return f&flag == flag
+}
+
+// Compression 获取压缩算法编号
+func (f Flag) Compression() uint8 {
+	return uint8(f&FlagCompressMask) >> compressShift
+}
+
+// WithCompression 设置压缩算法编号
+func (f Flag) WithCompression(id uint8) Flag {
+	return f&^FlagCompressMask | Flag(id<<compressShift)&FlagCompressMask
+}
+
+// Frame 协议帧
+type Frame struct {
+	Version uint8  // 帧头版本号
+	Flags   Flag   // 标志位
+	Payload []byte // 消息内容
+}
+
+// IsLegacy 是否为旧版帧格式
+func (f *Frame) IsLegacy() bool {
+	return f.Version == LegacyVersion
+}
+
+// DecodeOptions 解码参数
+type DecodeOptions struct {
+	MaxFrameSize    int  // 单帧最大长度，小于等于0时使用 DefaultMaxFrameSize
+	AllowLegacy     bool // 是否接受旧版帧格式
+	RequireChecksum bool // 已协商启用校验和，标志位可能被破坏，没有携带校验和的帧按损坏处理
+}
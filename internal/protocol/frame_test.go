@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// headerFrame 构造新版帧头，version/flags/length 可以任意指定
+func headerFrame(version uint8, flags Flag, length int32, payload []byte) []byte {
+	buf := append([]byte(nil), Magic[:]...)
+	buf = append(buf, version, byte(flags))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(length))
+	return append(buf, payload...)
+}
+
+func TestDecodeHeader(t *testing.T) {
+	payload := []byte("hello frame")
+	runDecodeCases(t, []decodeCase{
+		{
+			name:        "新版帧",
+			data:        mustEncode(t, &Frame{Version: HeaderVersion, Payload: payload}),
+			opts:        DecodeOptions{AllowLegacy: true},
+			wantPayload: payload,
+			wantVersion: HeaderVersion,
+		},
+		{
+			name:    "不接受旧版帧",
+			data:    legacyFrame(int32(len(payload)), payload),
+			opts:    DecodeOptions{AllowLegacy: false},
+			wantErr: ErrBadMagic,
+		},
+		{
+			name:        "新版帧长度为0",
+			data:        headerFrame(HeaderVersion, FlagNone, 0, nil),
+			opts:        DecodeOptions{},
+			wantPayload: []byte{},
+			wantVersion: HeaderVersion,
+		},
+		{
+			name:    "新版帧长度为负数",
+			data:    headerFrame(HeaderVersion, FlagNone, -1, nil),
+			opts:    DecodeOptions{},
+			wantErr: ErrInvalidLength,
+		},
+		{
+			name:    "新版帧超过最大长度",
+			data:    headerFrame(HeaderVersion, FlagNone, 17, make([]byte, 17)),
+			opts:    DecodeOptions{MaxFrameSize: 16},
+			wantErr: ErrMsgTooLong,
+		},
+		{
+			name:    "不支持的版本号",
+			data:    headerFrame(HeaderVersion+1, FlagNone, int32(len(payload)), payload),
+			opts:    DecodeOptions{},
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "魔数后的版本号为0",
+			data:    headerFrame(LegacyVersion, FlagNone, int32(len(payload)), payload),
+			opts:    DecodeOptions{},
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "未知的标志位",
+			data:    headerFrame(HeaderVersion, 1<<7, int32(len(payload)), payload),
+			opts:    DecodeOptions{},
+			wantErr: ErrUnsupportedFlags,
+		},
+		{
+			name:    "帧头不完整",
+			data:    Magic[:],
+			opts:    DecodeOptions{},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	})
+}
+
+func TestMagicIsNegativeAsLegacyLength(t *testing.T) {
+	// 魔数按旧版格式解析为负数长度，保证两种格式不会混淆
+	if length := int32(binary.LittleEndian.Uint32(Magic[:])); length >= 0 {
+		t.Fatalf("magic as legacy length = %v, want negative", length)
+	}
+}
+
+func TestEncodeFrameErrors(t *testing.T) {
+	if _, err := EncodeFrame(&Frame{Version: HeaderVersion + 1}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want %v", err, ErrUnsupportedVersion)
+	}
+	if _, err := EncodeFrame(&Frame{Version: LegacyVersion, Flags: FlagChecksum}); !errors.Is(err, ErrUnsupportedFlags) {
+		t.Fatalf("err = %v, want %v", err, ErrUnsupportedFlags)
+	}
+}
+
+func TestLegacyFallback(t *testing.T) {
+	// 旧版对端发来的帧按旧版格式解析，回复时同样使用旧版格式
+	data, err := EncodeLegacy([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(data[:len(Magic)], Magic[:]) {
+		t.Fatal("legacy frame starts with magic")
+	}
+	frame, err := DecodeFrame(bufio.NewReader(bytes.NewReader(data)), DecodeOptions{AllowLegacy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !frame.IsLegacy() || string(frame.Payload) != "legacy" {
+		t.Fatalf("frame = %v, %q", frame.Version, frame.Payload)
+	}
+	// 新版帧紧跟在旧版帧之后也能正确区分
+	stream := append(data, mustEncode(t, &Frame{Version: HeaderVersion, Payload: []byte("new")})...)
+	reader := bufio.NewReader(bytes.NewReader(stream))
+	for _, want := range []uint8{LegacyVersion, HeaderVersion} {
+		frame, err = DecodeFrame(reader, DecodeOptions{AllowLegacy: true})
+		if err != nil || frame.Version != want {
+			t.Fatalf("frame = %v, %v, want version %v", frame, err, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package serializer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/compress"
+	"tcpsocketv2/internal/protocol"
+)
+
+type codecCtxKey struct{}
+
+// 校验和错误处理策略
+const (
+	ChecksumPolicyDrop  = "drop"  // 丢弃损坏的帧，继续读取后续消息
+	ChecksumPolicyClose = "close" // 关闭连接
+)
+
+// Codec 连接级编解码器，记录与对端协商的帧格式，每个连接独立持有一个实例
+type Codec struct {
+	legacy    atomic.Bool   // 对端使用旧版帧格式，回复时同样使用旧版格式
+	checksum  atomic.Bool   // 是否启用校验和，启用后发送的帧携带校验和，接收的帧必须携带校验和
+	corrupted atomic.Int64  // 校验失败的帧数量
+	compress  atomic.Uint32 // 协商的压缩算法编号，发送时使用，接收时只接受该编号，0 表示不压缩
+}
+
+// NewCodec 创建编解码器，默认使用新版帧格式
+func NewCodec() *Codec {
+	return &Codec{}
+}
+
+// IsLegacy 对端是否使用旧版帧格式
+func (c *Codec) IsLegacy() bool {
+	return c.legacy.Load()
+}
+
+// EnableChecksum 握手协商成功后启用校验和，发送的帧携带校验和，接收的帧必须携带校验和
+func (c *Codec) EnableChecksum() {
+	c.checksum.Store(true)
+}
+
+// ChecksumEnabled 是否启用了校验和
+func (c *Codec) ChecksumEnabled() bool {
+	return c.checksum.Load()
+}
+
+// SetCompression 握手协商成功后设置双向使用的压缩算法
+func (c *Codec) SetCompression(name string) error {
+	compressor, ok := compress.Get(name)
+	if !ok {
+		return fmt.Errorf("unsupported compression: %v", name)
+	}
+	c.compress.Store(uint32(compressor.ID()))
+	return nil
+}
+
+// Compression 发送时使用的压缩算法，未启用时返回 false
+func (c *Codec) Compression() (compress.Compressor, bool) {
+	return compress.ByID(uint8(c.compress.Load()))
+}
+
+// CorruptedFrames 当前连接校验失败的帧数量
+func (c *Codec) CorruptedFrames() int64 {
+	return c.corrupted.Load()
+}
+
+// encode 按照协商结果对消息体进行编码
+func (c *Codec) encode(data []byte) ([]byte, error) {
+	if c.IsLegacy() {
+		return protocol.EncodeLegacy(data)
+	}
+	flags := protocol.FlagNone
+	if c.ChecksumEnabled() {
+		flags |= protocol.FlagChecksum
+	}
+	// 消息体超过阈值时进行压缩，压缩后没有变小则直接发送原始数据
+	if compressor, ok := c.Compression(); ok && len(data) >= config.Get().Msg.CompressThreshold {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress data: %w", err)
+		}
+		if len(compressed) < len(data) {
+			data = compressed
+			flags = flags.WithCompression(compressor.ID())
+		}
+	}
+	return protocol.EncodeFrame(&protocol.Frame{Version: protocol.HeaderVersion, Flags: flags, Payload: data})
+}
+
+// decompress 根据帧标志位解压消息体，只接受握手时协商的压缩算法
+func (c *Codec) decompress(frame *protocol.Frame, maxFrameSize int) ([]byte, error) {
+	id := frame.Flags.Compression()
+	if id == 0 {
+		return frame.Payload, nil
+	}
+	if agreed := uint8(c.compress.Load()); id != agreed {
+		return nil, fmt.Errorf("unnegotiated compression id: %v, agreed: %v", id, agreed)
+	}
+	compressor, ok := compress.ByID(id)
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression id: %v", id)
+	}
+	if maxFrameSize <= 0 {
+		maxFrameSize = protocol.DefaultMaxFrameSize
+	}
+	return compressor.Decompress(frame.Payload, maxFrameSize)
+}
+
+// IsFatal 判断反序列化错误是否需要关闭连接
+func IsFatal(err error) bool {
+	if errors.Is(err, protocol.ErrChecksum) {
+		return config.Get().Msg.ChecksumPolicy == ChecksumPolicyClose
+	}
+	return protocol.IsStreamBroken(err)
+}
+
+// WithCodec 将编解码器注入到上下文中
+func WithCodec(ctx context.Context, c *Codec) context.Context {
+	return context.WithValue(ctx, codecCtxKey{}, c)
+}
+
+// CodecFromCtx 从上下文中获取编解码器，不存在时返回一个默认的编解码器
+func CodecFromCtx(ctx context.Context) *Codec {
+	if c, ok := ctx.Value(codecCtxKey{}).(*Codec); ok {
+		return c
+	}
+	return NewCodec()
+}
@@ -0,0 +1,228 @@
+package serializer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"strings"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/compress"
+	"tcpsocketv2/internal/protocol"
+	message "tcpsocketv2/pb"
+	"testing"
+)
+
+// setupConfig 测试使用的配置
+func setupConfig(t *testing.T, policy string) {
+	t.Helper()
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{
+		MsgExpireTime:     60,
+		MaxFrameSize:      1024 * 1024,
+		AllowLegacyFrame:  true,
+		Checksum:          true,
+		ChecksumPolicy:    policy,
+		CompressThreshold: 1024,
+	}}
+	t.Cleanup(func() { config.Cfg = old })
+}
+
+// heartbeat 测试使用的消息体
+func heartbeat(os string) *message.MSG_HEARTBEAT {
+	return &message.MSG_HEARTBEAT{Os: proto.String(os), Cpu: proto.Float64(1), Mem: proto.Float64(2)}
+}
+
+// decodeOne 用新的编解码器解析一帧消息
+func decodeOne(t *testing.T, data []byte) (*Codec, message.CommandType, proto.Message, error) {
+	t.Helper()
+	codec := NewCodec()
+	command, payload, err := codec.DeserializeMessage(bufio.NewReader(bytes.NewReader(data)), context.Background())
+	return codec, command, payload, err
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	setupConfig(t, ChecksumPolicyDrop)
+	codec := NewCodec()
+	codec.EnableChecksum()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("linux"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := protocol.Flag(data[5]); !flags.Has(protocol.FlagChecksum) {
+		t.Fatalf("flags = %b, want checksum", flags)
+	}
+	_, command, payload, err := decodeOne(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != message.CommandType_CommandType_Heartbeat || payload.(*message.MSG_HEARTBEAT).GetOs() != "linux" {
+		t.Fatalf("got %v %v", command, payload)
+	}
+}
+
+func TestChecksumMismatchPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		fatal  bool
+	}{
+		{ChecksumPolicyDrop, false},
+		{ChecksumPolicyClose, true},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			setupConfig(t, tt.policy)
+			codec := NewCodec()
+			codec.EnableChecksum()
+			corrupted, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 破坏消息体中的一个字节
+			corrupted[len(corrupted)-8] ^= 0xFF
+			next, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("b"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver := NewCodec()
+			reader := bufio.NewReader(bytes.NewReader(append(corrupted, next...)))
+			_, _, err = receiver.DeserializeMessage(reader, context.Background())
+			if !errors.Is(err, protocol.ErrChecksum) {
+				t.Fatalf("err = %v, want checksum error", err)
+			}
+			if IsFatal(err) != tt.fatal {
+				t.Fatalf("IsFatal = %v, want %v", IsFatal(err), tt.fatal)
+			}
+			if receiver.CorruptedFrames() != 1 {
+				t.Fatalf("corrupted = %v, want 1", receiver.CorruptedFrames())
+			}
+			// 丢弃损坏的帧后，后续消息仍能正常解析
+			_, payload, err := receiver.DeserializeMessage(reader, context.Background())
+			if err != nil || payload.(*message.MSG_HEARTBEAT).GetOs() != "b" {
+				t.Fatalf("next = %v, %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestChecksumNotNegotiated(t *testing.T) {
+	setupConfig(t, ChecksumPolicyDrop)
+	// 未协商校验和时不携带帧尾
+	codec := NewCodec()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protocol.Flag(data[5]).Has(protocol.FlagChecksum) {
+		t.Fatal("checksum flag set without negotiation")
+	}
+	if _, _, _, err = decodeOne(t, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// 对端使用旧版帧格式时按旧版格式回复
+	legacy, err := protocol.EncodeLegacy(mustBody(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec = NewCodec()
+	if _, _, err = codec.DeserializeMessage(bufio.NewReader(bytes.NewReader(legacy)), context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !codec.IsLegacy() {
+		t.Fatal("codec should switch to legacy frames")
+	}
+	reply, err := codec.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(reply[:len(protocol.Magic)], protocol.Magic[:]) {
+		t.Fatal("reply to legacy peer uses new frame header")
+	}
+	if _, _, _, err = decodeOne(t, reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecksumRequiredAfterNegotiation(t *testing.T) {
+	setupConfig(t, ChecksumPolicyDrop)
+	sender := NewCodec()
+	sender.EnableChecksum()
+	// 校验和标志位被清除的帧
+	flagCleared, err := sender.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagCleared[5] &^= byte(protocol.FlagChecksum)
+	next, err := sender.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := NewCodec()
+	receiver.EnableChecksum()
+	reader := bufio.NewReader(bytes.NewReader(append(flagCleared, next...)))
+	_, _, err = receiver.DeserializeMessage(reader, context.Background())
+	if !errors.Is(err, protocol.ErrChecksum) || IsFatal(err) {
+		t.Fatalf("err = %v, want droppable checksum error", err)
+	}
+	if receiver.CorruptedFrames() != 1 {
+		t.Fatalf("corrupted = %v, want 1", receiver.CorruptedFrames())
+	}
+	// 按丢弃策略只丢弃当前帧，数据流没有错乱
+	_, payload, err := receiver.DeserializeMessage(reader, context.Background())
+	if err != nil || payload.(*message.MSG_HEARTBEAT).GetOs() != "b" {
+		t.Fatalf("next = %v, %v", payload, err)
+	}
+}
+
+func TestCompressionOnlyNegotiated(t *testing.T) {
+	setupConfig(t, ChecksumPolicyDrop)
+	config.Cfg.Msg.CompressThreshold = 1
+	sender := NewCodec()
+	if err := sender.SetCompression(compress.Snappy); err != nil {
+		t.Fatal(err)
+	}
+	data, err := sender.SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat(strings.Repeat("linux", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := protocol.Flag(data[5]).Compression(); id != 4 {
+		t.Fatalf("compression id = %v, want snappy", id)
+	}
+
+	// 协商了同一算法时正常解压
+	receiver := NewCodec()
+	if err = receiver.SetCompression(compress.Snappy); err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := receiver.DeserializeMessage(bufio.NewReader(bytes.NewReader(data)), context.Background())
+	if err != nil || payload.(*message.MSG_HEARTBEAT).GetOs() != strings.Repeat("linux", 100) {
+		t.Fatalf("got %v, %v", payload, err)
+	}
+
+	// 未协商压缩或协商了其他算法时拒绝
+	other := NewCodec()
+	if err = other.SetCompression(compress.Gzip); err != nil {
+		t.Fatal(err)
+	}
+	for name, receiver := range map[string]*Codec{"none": NewCodec(), "gzip": other} {
+		_, _, err = receiver.DeserializeMessage(bufio.NewReader(bytes.NewReader(data)), context.Background())
+		if err == nil || !strings.Contains(err.Error(), "unnegotiated compression") {
+			t.Fatalf("%v: err = %v, want unnegotiated compression", name, err)
+		}
+	}
+}
+
+// mustBody 序列化后的消息体，不含帧头
+func mustBody(t *testing.T) []byte {
+	t.Helper()
+	data, err := NewCodec().SerializeMessage(message.CommandType_CommandType_Heartbeat, heartbeat("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := protocol.DecodeFrame(bufio.NewReader(bytes.NewReader(data)), protocol.DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame.Payload
+}
@@ -0,0 +1,54 @@
+package serializer
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sync"
+	message "tcpsocketv2/pb"
+)
+
+// ErrUnknownCommand 未注册的指令，整帧已经读取完毕，数据流仍然完整，可以回复错误后继续处理后续消息
+var ErrUnknownCommand = errors.New("unknown command")
+
+var (
+	payloadMu sync.RWMutex
+	// payloadTypes 指令对应的消息体类型
+	payloadTypes = map[message.CommandType]protoreflect.MessageType{
+		message.CommandType_CommandType_HandShakeReq:  (*message.MSG_HANDSHAKE_REQ)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_HandShakeResp: (*message.MSG_HANDSHAKE_RESP)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_Heartbeat:     (*message.MSG_HEARTBEAT)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_AuthChallenge: (*message.MSG_AUTH_CHALLENGE)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_AuthResp:      (*message.MSG_AUTH_RESP)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_Goodbye:       (*message.MSG_GOODBYE)(nil).ProtoReflect().Type(),
+		message.CommandType_CommandType_Error:         (*message.MSG_ERROR)(nil).ProtoReflect().Type(),
+	}
+)
+
+// RegisterPayload 注册指令对应的消息体类型，prototype 可以是该类型的空指针；
+// 同一指令重复注册为相同类型时忽略，注册为不同类型属于编程错误，直接 panic
+func RegisterPayload(command message.CommandType, prototype proto.Message) {
+	messageType := prototype.ProtoReflect().Type()
+	payloadMu.Lock()
+	defer payloadMu.Unlock()
+	if registered, ok := payloadTypes[command]; ok {
+		if registered.Descriptor().FullName() != messageType.Descriptor().FullName() {
+			panic(fmt.Sprintf("指令 %v 已注册为消息类型 %v，不能再注册为 %v",
+				command, registered.Descriptor().FullName(), messageType.Descriptor().FullName()))
+		}
+		return
+	}
+	payloadTypes[command] = messageType
+}
+
+// newPayload 创建指令对应的空消息体，指令未注册时返回 false
+func newPayload(command message.CommandType) (proto.Message, bool) {
+	payloadMu.RLock()
+	defer payloadMu.RUnlock()
+	messageType, ok := payloadTypes[command]
+	if !ok {
+		return nil, false
+	}
+	return messageType.New().Interface(), true
+}
@@ -3,6 +3,7 @@ package serializer
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
@@ -14,8 +15,34 @@ import (
 	"tcpsocketv2/pkg/utils"
 )
 
-// SerializeMessage 序列化消息
+// SerializeMessage 序列化消息，使用新版帧格式
 func SerializeMessage(command message.CommandType, payload proto.Message) ([]byte, error) {
+	return NewCodec().SerializeMessage(command, payload)
+}
+
+// DeserializeMessage 反序列化消息，使用上下文中的编解码器
+func DeserializeMessage(reader *bufio.Reader, ctx context.Context) (message.CommandType, proto.Message, error) {
+	return CodecFromCtx(ctx).DeserializeMessage(reader, ctx)
+}
+
+// DeserializeEnvelope 反序列化消息及其关联信息，使用上下文中的编解码器
+func DeserializeEnvelope(reader *bufio.Reader, ctx context.Context) (message.CommandType, proto.Message, Envelope, error) {
+	return CodecFromCtx(ctx).DeserializeEnvelope(reader, ctx)
+}
+
+// Envelope 消息的关联信息，用于将回复与请求对应起来
+type Envelope struct {
+	RequestId uint64 // 请求ID，需要对端回复时设置
+	ReplyTo   uint64 // 回复的请求ID
+}
+
+// SerializeMessage 序列化消息，帧格式与对端保持一致
+func (c *Codec) SerializeMessage(command message.CommandType, payload proto.Message) ([]byte, error) {
+	return c.SerializeEnvelope(command, payload, Envelope{})
+}
+
+// SerializeEnvelope 序列化消息并附带关联信息
+func (c *Codec) SerializeEnvelope(command message.CommandType, payload proto.Message, envelope Envelope) ([]byte, error) {
 	// 包装 payload
 	payloadAny, err := anypb.New(payload)
 	if err != nil {
@@ -29,6 +56,12 @@ func SerializeMessage(command message.CommandType, payload proto.Message) ([]byt
 		Payload:   payloadAny,
 		Timestamp: &timestamp,
 	}
+	if envelope.RequestId != 0 {
+		msgBody.RequestId = &envelope.RequestId
+	}
+	if envelope.ReplyTo != 0 {
+		msgBody.ReplyTo = &envelope.ReplyTo
+	}
 	// 序列化 消息体
 	msgBodyBytes, marshalErr := proto.Marshal(msgBody)
 	if marshalErr != nil {
@@ -36,64 +69,87 @@ func SerializeMessage(command message.CommandType, payload proto.Message) ([]byt
 	}
 
 	// 对消息体进行编码
-	pkg, _ := protocol.Encode(msgBodyBytes)
+	pkg, encodeErr := c.encode(msgBodyBytes)
+	if encodeErr != nil {
+		return nil, fmt.Errorf("failed to encode message body: %w", encodeErr)
+	}
 	return pkg, nil
 }
 
-// DeserializeMessage 反序列化消息
-func DeserializeMessage(reader *bufio.Reader, ctx context.Context) (message.CommandType, proto.Message, error) {
+// DeserializeMessage 反序列化消息，并记录对端使用的帧格式
+func (c *Codec) DeserializeMessage(reader *bufio.Reader, ctx context.Context) (message.CommandType, proto.Message, error) {
+	command, payload, _, err := c.DeserializeEnvelope(reader, ctx)
+	return command, payload, err
+}
+
+// DeserializeEnvelope 反序列化消息及其关联信息，并记录对端使用的帧格式；
+// 指令未注册时仍返回关联信息，便于回复错误
+func (c *Codec) DeserializeEnvelope(reader *bufio.Reader, ctx context.Context) (message.CommandType, proto.Message, Envelope, error) {
+	var envelope Envelope
 	cfg := config.Get()
 	l := logger.FromCtx(ctx)
 	// 先进行协议解码
-	decodedData, err := protocol.Decode(reader)
+	frame, err := protocol.DecodeFrame(reader, protocol.DecodeOptions{
+		MaxFrameSize:    cfg.Msg.MaxFrameSize,
+		AllowLegacy:     cfg.Msg.AllowLegacyFrame,
+		RequireChecksum: c.ChecksumEnabled(),
+	})
 	if err == io.EOF {
 		l.Warn("收到EOF消息，准备结束会话")
-		return 0, nil, err
+		return 0, nil, envelope, err
+	}
+	if errors.Is(err, protocol.ErrChecksum) {
+		corrupted := c.corrupted.Add(1)
+		return 0, nil, envelope, fmt.Errorf("failed to decode data: %w, 累计损坏帧数: %v", err, corrupted)
 	}
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to decode data: %v", err)
+		return 0, nil, envelope, fmt.Errorf("failed to decode data: %w", err)
+	}
+	if frame.IsLegacy() != c.IsLegacy() {
+		l.Debug(fmt.Sprintf("对端帧格式版本: %v", frame.Version))
+		c.legacy.Store(frame.IsLegacy())
+	}
+	decodedData, err := c.decompress(frame, cfg.Msg.MaxFrameSize)
+	if err != nil {
+		return 0, nil, envelope, fmt.Errorf("failed to decompress data: %w", err)
 	}
 
 	// 反序列化消息体
 	msgBody := &message.MSG_BODY{}
 	if err := proto.Unmarshal(decodedData, msgBody); err != nil {
-		return 0, nil, fmt.Errorf("failed to unmarshal message body: %v", err)
+		return 0, nil, envelope, fmt.Errorf("failed to unmarshal message body: %v", err)
 	}
 	timestamp := msgBody.GetTimestamp()
 	expireTime := utils.GetCurrentTimestamp() - cfg.Msg.MsgExpireTime
 	// 判断消息是否过期
 	if timestamp < expireTime {
-		return 0, nil, fmt.Errorf("消息非法，超过过期时间，当前时间%v, 消息时间: %v\n", utils.GetCurrentTimestamp(), timestamp)
+		return 0, nil, envelope, fmt.Errorf("消息非法，超过过期时间，当前时间%v, 消息时间: %v\n", utils.GetCurrentTimestamp(), timestamp)
 	}
 	command := msgBody.GetCommand()
 	payload := msgBody.GetPayload()
+	envelope = Envelope{RequestId: msgBody.GetRequestId(), ReplyTo: msgBody.GetReplyTo()}
 	if payload == nil {
-		return command, nil, fmt.Errorf("payload is nil")
+		return command, nil, envelope, fmt.Errorf("payload is nil")
 	}
 
-	// 根据不同的消息类型创建对应的 payload 结构
-	var payloadMsg proto.Message
+	// 回复的消息体类型与请求不同，按消息体自带的类型解析，由等待回复的一方检查类型
+	if envelope.ReplyTo != 0 {
+		payloadMsg, err := payload.UnmarshalNew()
+		if err != nil {
+			return command, nil, envelope, fmt.Errorf("failed to unmarshal reply payload: %v", err)
+		}
+		return command, payloadMsg, envelope, nil
+	}
+	// 根据指令注册的消息体类型创建对应的 payload 结构
 	l.Debug(fmt.Sprintf("收到指令类型为： %v", command))
-	switch command {
-	case message.CommandType_CommandType_HandShakeReq:
-		l.Debug("收到指令：握手请求消息")
-		payloadMsg = &message.MSG_HANDSHAKE_REQ{}
-	case message.CommandType_CommandType_HandShakeResp:
-		l.Debug("收到指令：握手响应消息")
-		payloadMsg = &message.MSG_HANDSHAKE_RESP{}
-	case message.CommandType_CommandType_Heartbeat:
-		l.Debug("收到指令：心跳消息")
-		payloadMsg = &message.MSG_HEARTBEAT{}
-	case message.CommandType_CommandType_Unknow:
-		l.Warn("收到指令：未知消息")
-	// 添加更多 case 处理其他命令类型
-	default:
-		return command, nil, fmt.Errorf("unsupported handler type: %v", command)
+	payloadMsg, ok := newPayload(command)
+	if !ok {
+		return command, nil, envelope, fmt.Errorf("%w: %v", ErrUnknownCommand, command)
 	}
 	if err := payload.UnmarshalTo(payloadMsg); err != nil {
-		return command, nil, fmt.Errorf("failed to unmarshal payload: %v", err)
+		return command, nil, envelope, fmt.Errorf("failed to unmarshal payload: %v", err)
 	}
 
 	// 返回解析后的命令类型、对应的消息体以及错误为nil
-	return command, payloadMsg, nil
+	return command, payloadMsg, envelope, nil
 }
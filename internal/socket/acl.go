@@ -0,0 +1,102 @@
+package socket
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+)
+
+// accessList 来源IP访问控制列表，创建后只读，热重载时整体替换
+type accessList struct {
+	enable         bool
+	allowByDefault bool
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+}
+
+// newAccessList 根据配置创建访问控制列表
+func newAccessList(cfg config.ACL) (*accessList, error) {
+	allow, deny, err := cfg.Rules()
+	if err != nil {
+		return nil, err
+	}
+	return &accessList{
+		enable:         cfg.Enable,
+		allowByDefault: cfg.DefaultPolicy != "deny",
+		allow:          allow,
+		deny:           deny,
+	}, nil
+}
+
+// permit 判断是否允许该地址访问，deny 优先于 allow，都不匹配时按默认策略处理
+func (a *accessList) permit(addr netip.Addr) bool {
+	if a == nil || !a.enable {
+		return true
+	}
+	// IPv4映射的IPv6地址按IPv4匹配
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range a.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	for _, prefix := range a.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return a.allowByDefault
+}
+
+// permitConn 判断是否允许该连接的来源地址访问，无法解析地址时按默认策略处理
+func (a *accessList) permitConn(conn net.Conn) bool {
+	if a == nil || !a.enable {
+		return true
+	}
+	addr, err := netip.ParseAddr(RemoteIP(conn))
+	if err != nil {
+		return a.allowByDefault
+	}
+	return a.permit(addr)
+}
+
+// reloadACL 配置热重载后替换访问控制列表，按需断开已不被允许的连接
+func (s *Server) reloadACL(cfg config.ACL) {
+	l := logger.Get()
+	acl, err := newAccessList(cfg)
+	if err != nil {
+		l.Error(fmt.Sprintf("重新加载访问控制列表失败，继续使用原有配置: %v", err))
+		return
+	}
+	s.acl.Store(acl)
+	l.Info(fmt.Sprintf("访问控制列表重新加载成功, 启用: %v, 默认策略: %v, 允许: %v, 拒绝: %v", cfg.Enable, cfg.DefaultPolicy, cfg.Allow, cfg.Deny))
+	if cfg.KickDenied {
+		s.kickDenied(acl)
+	}
+}
+
+// kickDenied 断开不再被允许访问的连接，已握手的客户端先收到断开通知
+func (s *Server) kickDenied(acl *accessList) {
+	l := logger.Get()
+	s.mu.Lock()
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		if !acl.permitConn(conn) {
+			conns = append(conns, conn)
+		}
+	}
+	s.mu.Unlock()
+	for _, conn := range conns {
+		s.Metrics.KickedByACL.Add(1)
+		l.Warn(fmt.Sprintf("来源IP已不被允许访问，断开连接: %v", conn.RemoteAddr()))
+		if _, ok := s.Sessions.Get(conn); ok {
+			if err := s.Goodbye(conn, enums.GoodbyeCode_Kicked, "来源IP已不被允许访问", 0); err == nil {
+				continue
+			}
+		}
+		_ = conn.Close()
+	}
+}
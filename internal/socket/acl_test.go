@@ -0,0 +1,167 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+func TestAccessListPermit(t *testing.T) {
+	tests := []struct {
+		name string
+		acl  config.ACL
+		addr string
+		want bool
+	}{
+		{name: "未启用", acl: config.ACL{Deny: []string{"0.0.0.0/0"}}, addr: "10.0.0.1", want: true},
+		{name: "默认允许", acl: config.ACL{Enable: true, DefaultPolicy: "allow"}, addr: "10.0.0.1", want: true},
+		{name: "默认拒绝", acl: config.ACL{Enable: true, DefaultPolicy: "deny"}, addr: "10.0.0.1", want: false},
+		{name: "IPv4网段允许", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"10.0.0.0/8"}}, addr: "10.1.2.3", want: true},
+		{name: "IPv4网段外", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"10.0.0.0/8"}}, addr: "11.0.0.1", want: false},
+		{name: "IPv4单个地址", acl: config.ACL{Enable: true, Deny: []string{"192.168.1.10"}}, addr: "192.168.1.10", want: false},
+		{name: "IPv4单个地址不含相邻地址", acl: config.ACL{Enable: true, Deny: []string{"192.168.1.10"}}, addr: "192.168.1.11", want: true},
+		{name: "IPv6网段允许", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"2001:db8::/32"}}, addr: "2001:db8::1", want: true},
+		{name: "IPv6网段外", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"2001:db8::/32"}}, addr: "2001:db9::1", want: false},
+		{name: "IPv6带区域", acl: config.ACL{Enable: true, Deny: []string{"fe80::/10"}}, addr: "fe80::1%eth0", want: false},
+		{name: "IPv4映射地址匹配IPv4网段", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"10.0.0.0/8"}}, addr: "::ffff:10.0.0.1", want: true},
+		{name: "IPv4映射地址匹配IPv4拒绝", acl: config.ACL{Enable: true, Deny: []string{"10.0.0.1"}}, addr: "::ffff:10.0.0.1", want: false},
+		{name: "IPv4地址不匹配IPv6网段", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"::/0"}}, addr: "10.0.0.1", want: false},
+		{name: "拒绝优先于允许", acl: config.ACL{Enable: true, Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.0/24"}}, addr: "10.0.0.5", want: false},
+		{name: "拒绝网段外仍允许", acl: config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.0/24"}}, addr: "10.0.1.5", want: true},
+		{name: "拒绝优先于允许IPv6", acl: config.ACL{Enable: true, Allow: []string{"2001:db8::/32"}, Deny: []string{"2001:db8::1"}}, addr: "2001:db8::1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := newAccessList(tt.acl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := acl.permit(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Fatalf("permit(%v) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessListPermitConn(t *testing.T) {
+	acl, err := newAccessList(config.ACL{Enable: true, DefaultPolicy: "deny", Allow: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		addr net.Addr
+		want bool
+	}{
+		{name: "IPv4", addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, want: true},
+		{name: "IPv4映射的IPv6", addr: &net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 1000}, want: true},
+		{name: "网段外", addr: &net.TCPAddr{IP: net.IPv4(11, 0, 0, 1), Port: 1000}, want: false},
+		{name: "IPv6", addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000}, want: false},
+		// 无法解析的地址按默认策略处理
+		{name: "无法解析", addr: &net.UnixAddr{Name: "/tmp/socket", Net: "unix"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acl.permitConn(&fakeConn{addr: tt.addr}); got != tt.want {
+				t.Fatalf("permitConn(%v) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+	// 未创建访问控制列表时允许所有连接
+	var nilACL *accessList
+	if !nilACL.permitConn(newFakeConn(1000)) {
+		t.Fatal("nil access list denied")
+	}
+}
+
+// loadTestConfig 从临时目录加载配置文件并开启热重载，返回配置文件路径
+func loadTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(dir, "config", "test.config.yaml")
+	if err := os.WriteFile(cfgFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TCPSOCKET_ENV", "test")
+	old := config.Cfg
+	t.Cleanup(func() { config.Cfg = old })
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(pwd) }()
+	config.Init()
+	return cfgFile
+}
+
+// reloadConfig 写入新的配置文件并等待满足条件的那次重载完成
+func reloadConfig(t *testing.T, cfgFile, content string, match func(cfg *config.Config) bool) {
+	t.Helper()
+	reloaded := make(chan struct{}, 1)
+	unregister := config.OnReload(func(newCfg *config.Config) {
+		// 写入过程中可能先读到不完整的文件，只关心写入完成后的那次重载
+		if !match(newCfg) {
+			return
+		}
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+	defer unregister()
+	if err := os.WriteFile(cfgFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded")
+	}
+}
+
+func TestServeUnregistersReloadHooks(t *testing.T) {
+	cfgFile := loadTestConfig(t, "acl:\n  enable: false\n")
+	server := NewServer("127.0.0.1", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); server.Addr() == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server not listening")
+		}
+	}
+
+	// 运行期间访问控制列表随配置重新加载
+	reloadConfig(t, cfgFile, "acl:\n  enable: true\n  deny:\n    - 10.0.0.1\n", func(cfg *config.Config) bool {
+		return cfg.ACL.Enable
+	})
+	running := server.acl.Load()
+	if running.permit(netip.MustParseAddr("10.0.0.1")) {
+		t.Fatal("acl not reloaded while serving")
+	}
+
+	// Serve 返回后不再响应配置重新加载
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not return")
+	}
+	reloadConfig(t, cfgFile, "acl:\n  enable: true\n  deny:\n    - 10.0.0.2\n", func(cfg *config.Config) bool {
+		return len(cfg.ACL.Deny) == 1 && cfg.ACL.Deny[0] == "10.0.0.2"
+	})
+	if server.acl.Load() != running {
+		t.Fatal("acl reloaded after serve returned")
+	}
+}
@@ -0,0 +1,96 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// 连接准入被拒绝的原因
+var (
+	errTooManyPending    = errors.New("未完成握手的连接数超过限制")
+	errAcceptRateLimited = errors.New("接受新连接的速率超过限制")
+	errTooManyConns      = errors.New("服务端连接数超过限制")
+	errTooManyConnsPerIP = errors.New("同一IP的连接数超过限制")
+)
+
+// connInfo 连接的准入信息
+type connInfo struct {
+	ip       string // 来源IP
+	pending  bool   // 尚未完成握手
+	admitted bool   // 已计入连接数限制，为 false 时握手会被拒绝
+}
+
+// admissionCtxKey 上下文中保存准入结果的键
+type admissionCtxKey struct{}
+
+// withAdmission 将连接的准入结果注入到上下文中
+func withAdmission(ctx context.Context, rejected error) context.Context {
+	return context.WithValue(ctx, admissionCtxKey{}, rejected)
+}
+
+// AdmissionFromCtx 获取连接的准入结果，连接数超过限制时返回拒绝原因，处理握手时应回复握手失败
+func AdmissionFromCtx(ctx context.Context) error {
+	rejected, _ := ctx.Value(admissionCtxKey{}).(error)
+	return rejected
+}
+
+// RemoteIP 连接的来源IP，不含端口
+func RemoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// tokenBucket 令牌桶限流器，用于限制接受新连接的速率
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒生成的令牌数，0 表示不限制
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 创建令牌桶，初始时桶是满的
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{}
+	b.setRate(rate, burst)
+	return b
+}
+
+// setRate 修改速率和桶容量，配置热重载时调用
+func (b *tokenBucket) setRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	capacity := float64(burst)
+	if capacity <= 0 {
+		capacity = math.Max(1, math.Ceil(rate))
+	}
+	b.rate = rate
+	b.burst = capacity
+	b.tokens = capacity
+	b.last = time.Now()
+}
+
+// allow 取一个令牌，令牌不足时返回 false
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,78 @@
+package socket
+
+import (
+	"testing"
+	"time"
+)
+
+// take 连续取 n 次令牌，返回成功的次数
+func take(b *tokenBucket, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if b.allow() {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		want  int
+	}{
+		{name: "不限制", rate: 0, burst: 0, want: 100},
+		{name: "桶容量", rate: 1, burst: 5, want: 5},
+		{name: "容量默认为速率", rate: 3, burst: 0, want: 3},
+		{name: "小数速率向上取整", rate: 2.5, burst: 0, want: 3},
+		{name: "速率小于1时容量为1", rate: 0.1, burst: 0, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 初始时桶是满的，连续取令牌直到耗尽
+			if got := take(newTokenBucket(tt.rate, tt.burst), 100); got != tt.want {
+				t.Fatalf("allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	if got := take(b, 3); got != 2 {
+		t.Fatalf("allowed = %v, want 2", got)
+	}
+	// 按速率补充令牌，0.15秒补充1个
+	b.mu.Lock()
+	b.last = b.last.Add(-150 * time.Millisecond)
+	b.mu.Unlock()
+	if got := take(b, 3); got != 1 {
+		t.Fatalf("allowed after 150ms = %v, want 1", got)
+	}
+	// 补充的令牌不超过桶容量
+	b.mu.Lock()
+	b.last = b.last.Add(-time.Hour)
+	b.mu.Unlock()
+	if got := take(b, 10); got != 2 {
+		t.Fatalf("allowed after 1h = %v, want 2", got)
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	b := newTokenBucket(1, 1)
+	if got := take(b, 2); got != 1 {
+		t.Fatalf("allowed = %v, want 1", got)
+	}
+	// 修改速率后桶重新装满
+	b.setRate(1, 4)
+	if got := take(b, 10); got != 4 {
+		t.Fatalf("allowed after setRate = %v, want 4", got)
+	}
+	// 速率改为0后不再限制
+	b.setRate(0, 0)
+	if got := take(b, 100); got != 100 {
+		t.Fatalf("allowed after disable = %v, want 100", got)
+	}
+}
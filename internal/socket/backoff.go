@@ -0,0 +1,54 @@
+package socket
+
+import (
+	"math"
+	"math/rand"
+	"tcpsocketv2/config"
+	"time"
+)
+
+// Backoff 指数退避重连策略，带随机抖动和熔断
+type Backoff struct {
+	cfg      config.Reconnect
+	attempts int // 连续失败次数
+}
+
+// NewBackoff 创建重连退避策略
+func NewBackoff(cfg config.Reconnect) *Backoff {
+	return &Backoff{cfg: cfg}
+}
+
+// Next 记录一次失败并返回下次重连前的等待时间，超过最大重连次数时返回 false
+func (b *Backoff) Next() (time.Duration, bool) {
+	b.attempts++
+	if b.cfg.MaxAttempts > 0 && b.attempts > b.cfg.MaxAttempts {
+		return 0, false
+	}
+	// 连续失败达到熔断阈值时，等待冷却时间后再尝试
+	if b.cfg.BreakerThreshold > 0 && b.attempts%b.cfg.BreakerThreshold == 0 {
+		return b.cfg.BreakerCooldown * time.Second, true
+	}
+
+	// 熔断后重新从初始等待时间开始增长
+	exponent := b.attempts - 1
+	if b.cfg.BreakerThreshold > 0 {
+		exponent %= b.cfg.BreakerThreshold
+	}
+	initial := float64(b.cfg.InitialInterval * time.Second)
+	maximum := float64(b.cfg.MaxInterval * time.Second)
+	delay := math.Min(initial*math.Pow(b.cfg.Multiplier, float64(exponent)), maximum)
+
+	// 随机抖动：delay * [1-jitter, 1+jitter]
+	delay *= 1 + b.cfg.Jitter*(2*rand.Float64()-1)
+	return time.Duration(delay), true
+}
+
+// Attempts 当前连续失败次数
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Reset 连接成功后重置失败次数
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
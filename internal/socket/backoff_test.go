@@ -0,0 +1,91 @@
+package socket
+
+import (
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  config.Reconnect
+		want []time.Duration // 依次调用 Next 的返回值，-1 表示放弃重连
+	}{
+		{
+			name: "指数增长",
+			cfg:  config.Reconnect{InitialInterval: 1, MaxInterval: 100, Multiplier: 2},
+			want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second},
+		},
+		{
+			name: "不超过上限",
+			cfg:  config.Reconnect{InitialInterval: 1, MaxInterval: 5, Multiplier: 3},
+			want: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name: "熔断后冷却，之后重新从初始等待时间开始",
+			cfg:  config.Reconnect{InitialInterval: 1, MaxInterval: 100, Multiplier: 2, BreakerThreshold: 3, BreakerCooldown: 60},
+			want: []time.Duration{time.Second, 2 * time.Second, time.Minute, time.Second, 2 * time.Second, time.Minute},
+		},
+		{
+			name: "超过最大重连次数",
+			cfg:  config.Reconnect{InitialInterval: 1, MaxInterval: 100, Multiplier: 2, MaxAttempts: 3},
+			want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, -1, -1},
+		},
+		{
+			name: "熔断与最大重连次数同时配置",
+			cfg:  config.Reconnect{InitialInterval: 1, MaxInterval: 100, Multiplier: 2, MaxAttempts: 2, BreakerThreshold: 2, BreakerCooldown: 30},
+			want: []time.Duration{time.Second, 30 * time.Second, -1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackoff(tt.cfg)
+			for i, want := range tt.want {
+				got, ok := b.Next()
+				if want < 0 {
+					if ok {
+						t.Fatalf("attempt %v: got %v, want give up", i+1, got)
+					}
+					continue
+				}
+				if !ok || got != want {
+					t.Fatalf("attempt %v: got %v, %v, want %v", i+1, got, ok, want)
+				}
+			}
+			if b.Attempts() != len(tt.want) {
+				t.Fatalf("Attempts = %v, want %v", b.Attempts(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := NewBackoff(config.Reconnect{InitialInterval: 10, MaxInterval: 10, Multiplier: 2, Jitter: 0.2})
+	low, high := 8*time.Second, 12*time.Second
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got, ok := b.Next()
+		if !ok || got < low || got > high {
+			t.Fatalf("attempt %v: got %v, %v, want within [%v, %v]", i+1, got, ok, low, high)
+		}
+		seen[got] = true
+	}
+	// 抖动使等待时间分散，而不是固定值
+	if len(seen) < 100 {
+		t.Fatalf("only %v distinct delays, jitter not applied", len(seen))
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+	b := NewBackoff(config.Reconnect{InitialInterval: 1, MaxInterval: 100, Multiplier: 2, MaxAttempts: 2})
+	b.Next()
+	b.Next()
+	if _, ok := b.Next(); ok {
+		t.Fatal("should give up after max attempts")
+	}
+	// 连接成功后重新计数
+	b.Reset()
+	if got, ok := b.Next(); !ok || got != time.Second || b.Attempts() != 1 {
+		t.Fatalf("after reset got %v, %v, attempts %v", got, ok, b.Attempts())
+	}
+}
@@ -0,0 +1,257 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// 同步调用失败的原因
+var (
+	ErrConnClosed = errors.New("connection closed")        // 连接未建立或已断开，等待中的调用全部返回该错误
+	ErrNotRequest = errors.New("message is not a request") // 收到的消息不是同步调用，无需回复
+)
+
+// RemoteError 对端处理请求失败时回复的错误
+type RemoteError struct {
+	Code    int32               // 错误码，取值见 enums.ResponseCode
+	Command message.CommandType // 出错的指令
+	Message string              // 错误信息
+}
+
+// Error 实现 error 接口
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("对端处理指令 %v 失败, 错误码: %v, 错误信息: %v", e.Command, e.Code, e.Message)
+}
+
+// callResult 同步调用的结果
+type callResult struct {
+	payload proto.Message
+	err     error
+}
+
+// inflight 连接上等待回复的同步调用，每个连接一份，连接断开后所有等待中的调用立即返回
+type inflight struct {
+	mu      sync.Mutex
+	lastId  uint64
+	pending map[uint64]chan callResult
+	err     error // 连接断开的原因，不为空时不再接受新的调用
+	metrics *Metrics
+}
+
+// inflightCtxKey 上下文中保存同步调用的键
+type inflightCtxKey struct{}
+
+// newInflight 创建连接的同步调用记录
+func newInflight(metrics *Metrics) *inflight {
+	return &inflight{pending: make(map[uint64]chan callResult), metrics: metrics}
+}
+
+// withInflight 将同步调用记录注入到连接的上下文中
+func withInflight(ctx context.Context, calls *inflight) context.Context {
+	return context.WithValue(ctx, inflightCtxKey{}, calls)
+}
+
+// inflightFromCtx 从上下文中获取同步调用记录，不存在时返回 nil
+func inflightFromCtx(ctx context.Context) *inflight {
+	calls, _ := ctx.Value(inflightCtxKey{}).(*inflight)
+	return calls
+}
+
+// start 分配请求ID并开始等待回复，连接已断开时返回错误
+func (f *inflight) start() (uint64, chan callResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, nil, f.err
+	}
+	f.lastId++
+	// 缓冲为1，回复到达时不会阻塞读协程
+	ch := make(chan callResult, 1)
+	f.pending[f.lastId] = ch
+	f.metrics.InflightCalls.Add(1)
+	return f.lastId, ch, nil
+}
+
+// resolve 收到回复，错误消息转换为 *RemoteError；调用已超时或取消时丢弃该回复并返回 false
+func (f *inflight) resolve(id uint64, command message.CommandType, payload proto.Message, err error) bool {
+	f.mu.Lock()
+	ch, ok := f.pending[id]
+	if ok {
+		delete(f.pending, id)
+		f.metrics.InflightCalls.Add(-1)
+	}
+	f.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if errMsg, isErr := payload.(*message.MSG_ERROR); err == nil && isErr && command == message.CommandType_CommandType_Error {
+		err = &RemoteError{Code: errMsg.GetCode(), Command: errMsg.GetCommand(), Message: errMsg.GetMessage()}
+		payload = nil
+	}
+	ch <- callResult{payload: payload, err: err}
+	return true
+}
+
+// cancel 调用结束后取消等待，回复已经到达时不做任何事
+func (f *inflight) cancel(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.pending[id]; ok {
+		delete(f.pending, id)
+		f.metrics.InflightCalls.Add(-1)
+	}
+}
+
+// close 连接断开，所有等待中的调用返回 err，之后的调用直接失败
+func (f *inflight) close(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return
+	}
+	f.err = err
+	for id, ch := range f.pending {
+		ch <- callResult{err: err}
+		delete(f.pending, id)
+		f.metrics.InflightCalls.Add(-1)
+	}
+}
+
+// request 正在处理的同步调用请求
+type request struct {
+	id      uint64
+	command message.CommandType
+}
+
+// requestCtxKey 上下文中保存请求信息的键
+type requestCtxKey struct{}
+
+// withRequest 将请求ID注入到处理消息的上下文中，回复时据此关联请求，requestId 为0时不是同步调用
+func withRequest(ctx context.Context, command message.CommandType, requestId uint64) context.Context {
+	if requestId == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requestCtxKey{}, request{id: requestId, command: command})
+}
+
+// requestFromCtx 获取正在处理的请求，消息不是同步调用时返回 false
+func requestFromCtx(ctx context.Context) (request, bool) {
+	req, ok := ctx.Value(requestCtxKey{}).(request)
+	return req, ok
+}
+
+// RequestIdFromCtx 获取正在处理的请求ID，消息不是同步调用时返回0
+func RequestIdFromCtx(ctx context.Context) uint64 {
+	req, _ := requestFromCtx(ctx)
+	return req.id
+}
+
+// Reply 回复正在处理的同步调用，ctx 须为处理函数收到的上下文
+func Reply(ctx context.Context, session *Session, payload proto.Message) error {
+	req, ok := requestFromCtx(ctx)
+	if !ok {
+		return ErrNotRequest
+	}
+	pkg, err := serializer.CodecFromCtx(ctx).SerializeEnvelope(req.command, payload, serializer.Envelope{ReplyTo: req.id})
+	if err != nil {
+		return fmt.Errorf("序列化回复消息异常: %v", err)
+	}
+	if _, err = session.Conn.Write(pkg); err != nil {
+		return fmt.Errorf("发送回复消息失败: %v", err)
+	}
+	return nil
+}
+
+// CallHandlerFunc 同步调用的处理函数，返回的消息体作为回复发送给调用方，返回错误时调用方收到 *RemoteError
+type CallHandlerFunc[Req, Resp proto.Message] func(ctx context.Context, session *Session, req Req) (Resp, error)
+
+// RegisterCall 注册同步调用的处理函数；处理失败只回复错误，不会断开连接。
+// 对端未使用 Call 发送该指令时不回复
+func RegisterCall[Req, Resp proto.Message](r *Registry, command message.CommandType, handler CallHandlerFunc[Req, Resp]) {
+	Register(r, command, func(ctx context.Context, session *Session, req Req) error {
+		resp, err := handler(ctx, session, req)
+		if _, ok := requestFromCtx(ctx); !ok {
+			return nil
+		}
+		if err != nil {
+			return writeError(session.Conn, ctx, enums.ResponseCode_Fail, command, err.Error())
+		}
+		return Reply(ctx, session, resp)
+	})
+}
+
+// roundTrip 发送请求并等待回复，ctx 没有截止时间时按 msg.call_timeout 等待
+func roundTrip(ctx context.Context, conn net.Conn, connCtx context.Context, metrics *Metrics, command message.CommandType, req proto.Message) (proto.Message, error) {
+	calls := inflightFromCtx(connCtx)
+	if conn == nil || calls == nil {
+		return nil, ErrConnClosed
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		if timeout := config.Get().Msg.CallTimeout * time.Second; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	id, ch, err := calls.start()
+	if err != nil {
+		return nil, err
+	}
+	defer calls.cancel(id)
+	pkg, err := serializer.CodecFromCtx(connCtx).SerializeEnvelope(command, req, serializer.Envelope{RequestId: id})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求消息异常: %v", err)
+	}
+	if _, err = conn.Write(pkg); err != nil {
+		// 写队列已满之外的写入失败说明连接已断开
+		if errors.Is(err, ErrWriteQueueFull) {
+			return nil, fmt.Errorf("发送请求消息失败: %w", err)
+		}
+		return nil, fmt.Errorf("发送请求消息失败: %w: %v", ErrConnClosed, err)
+	}
+	select {
+	case result := <-ch:
+		return result.payload, result.err
+	case <-ctx.Done():
+		metrics.CallTimeouts.Add(1)
+		return nil, fmt.Errorf("等待指令 %v 的回复失败: %w", command, ctx.Err())
+	}
+}
+
+// Call 向服务端发送请求并等待回复，ctx 没有截止时间时按 msg.call_timeout 等待；
+// 服务端处理失败时返回 *RemoteError，连接断开时返回 ErrConnClosed。
+// 回复由读取消息的协程交付，不能在指令的处理函数中直接调用，否则一直等到超时
+func (c *Client) Call(ctx context.Context, command message.CommandType, req proto.Message) (proto.Message, error) {
+	// 只读取一次当前连接，重连期间也不会把请求发到一个连接、在另一个连接上等待回复
+	active := c.active.Load()
+	if active == nil || c.closing.Load() {
+		return nil, ErrConnClosed
+	}
+	return roundTrip(ctx, active.conn, active.ctx, c.Metrics, command, req)
+}
+
+// Call 向已握手的客户端发送请求并等待回复，用法与 Client.Call 相同
+func (s *Server) Call(ctx context.Context, _session *Session, command message.CommandType, req proto.Message) (proto.Message, error) {
+	if _session == nil {
+		return nil, ErrConnClosed
+	}
+	return roundTrip(ctx, _session.Conn, _session.Ctx, s.Metrics, command, req)
+}
+
+// handleReply 收到对端的回复，交给等待中的调用；调用已超时或取消时丢弃该回复
+func handleReply(ctx context.Context, command message.CommandType, envelope serializer.Envelope, payload proto.Message, err error) {
+	if calls := inflightFromCtx(ctx); calls != nil && calls.resolve(envelope.ReplyTo, command, payload, err) {
+		return
+	}
+	logger.FromCtx(ctx).Debug(fmt.Sprintf("丢弃已结束调用的回复, 请求ID: %v, 指令: %v", envelope.ReplyTo, command))
+}
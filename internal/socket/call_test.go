@@ -0,0 +1,211 @@
+package socket
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+	"sync/atomic"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// callConfig 同步调用测试使用的配置
+func callConfig(t *testing.T, reconnect bool) {
+	old := config.Cfg
+	config.Cfg = &config.Config{
+		Msg: config.Msg{
+			MsgExpireTime:     60,
+			MaxFrameSize:      1024 * 1024,
+			AllowLegacyFrame:  true,
+			HeartbeatInterval: 60,
+			HandshakeTimeout:  5,
+			WriteQueueSize:    16,
+			WriteQueuePolicy:  "block",
+			WriteTimeout:      5,
+			CallTimeout:       5,
+		},
+		Reconnect: config.Reconnect{Enable: reconnect},
+	}
+	t.Cleanup(func() { config.Cfg = old })
+}
+
+// callServer 模拟服务端：接受连接后回复握手响应，每个连接回复 replies 个请求后关闭，replies 为0时收到请求直接关闭
+func callServer(t *testing.T, replies int) (port int, accepted *atomic.Int64) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener.Addr().(*net.TCPAddr).Port, serveListener(t, listener, replies)
+}
+
+// serveListener 在指定的监听上模拟服务端，返回已接受的连接数
+func serveListener(t *testing.T, listener net.Listener, replies int) (accepted *atomic.Int64) {
+	// 服务端只转发消息，不注册处理函数，需要单独注册请求的消息体类型
+	serializer.RegisterPayload(message.CommandType_CommandType_Task, &message.MSG_TASK{})
+	// 模拟服务端的协程会读取日志，先于客户端完成初始化
+	logger.Get()
+	accepted = new(atomic.Int64)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			accepted.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveCalls(conn, replies)
+			}()
+		}
+	}()
+	// 客户端先于服务端停止，连接随之关闭；等待处理协程退出后才恢复配置
+	t.Cleanup(func() {
+		_ = listener.Close()
+		wg.Wait()
+	})
+	return accepted
+}
+
+// serveCalls 在一个连接上回复握手和同步调用
+func serveCalls(conn net.Conn, replies int) {
+	defer conn.Close()
+	codec := serializer.NewCodec()
+	data, err := codec.SerializeMessage(message.CommandType_CommandType_HandShakeResp, &message.MSG_HANDSHAKE_RESP{
+		Code:    proto.Int32(0),
+		Message: proto.String("success"),
+	})
+	if err != nil {
+		return
+	}
+	if _, err = conn.Write(data); err != nil {
+		return
+	}
+	reader := bufio.NewReader(conn)
+	ctx := serializer.WithCodec(context.Background(), codec)
+	for handled := 0; ; {
+		command, payload, envelope, readErr := serializer.DeserializeEnvelope(reader, ctx)
+		if readErr != nil {
+			return
+		}
+		if envelope.RequestId == 0 {
+			continue
+		}
+		if handled >= replies {
+			return
+		}
+		// 原样回复请求
+		data, err = codec.SerializeEnvelope(command, payload, serializer.Envelope{ReplyTo: envelope.RequestId})
+		if err != nil {
+			return
+		}
+		if _, err = conn.Write(data); err != nil {
+			return
+		}
+		handled++
+	}
+}
+
+// runClient 启动连接本地服务端的客户端，测试结束时停止
+func runClient(t *testing.T, port int) *Client {
+	client, cancel := NewClient("127.0.0.1", port)
+	client.RegisterHandler(&pipeHandler{client: client})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.Run()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return client
+}
+
+func TestCallDuringReconnect(t *testing.T) {
+	callConfig(t, true)
+	// 每个连接只回复少量请求，客户端在调用期间不断重连
+	port, accepted := callServer(t, 5)
+	client := runClient(t, port)
+
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(10 * time.Second)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; succeeded.Load() < 100 && time.Now().Before(deadline); i++ {
+				taskId := fmt.Sprintf("%d-%d", w, i)
+				resp, err := client.Call(context.Background(), message.CommandType_CommandType_Task, &message.MSG_TASK{
+					TaskId: proto.String(taskId),
+					Type:   message.TaskType(0).Enum(),
+				})
+				if errors.Is(err, ErrConnClosed) {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				if err != nil {
+					t.Errorf("call %v: %v", taskId, err)
+					return
+				}
+				// 回复来自发送请求的同一个连接
+				if got := resp.(*message.MSG_TASK).GetTaskId(); got != taskId {
+					t.Errorf("call %v got reply of %v", taskId, got)
+					return
+				}
+				succeeded.Add(1)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if succeeded.Load() < 100 {
+		t.Fatalf("succeeded calls = %v, want 100", succeeded.Load())
+	}
+	if accepted.Load() < 2 {
+		t.Fatalf("accepted conns = %v, want reconnects", accepted.Load())
+	}
+	if n := client.Metrics.InflightCalls.Load(); n != 0 {
+		t.Fatalf("inflight calls = %v, want 0", n)
+	}
+}
+
+func TestCallFailsWhenConnClosed(t *testing.T) {
+	callConfig(t, false)
+	// 服务端收到请求后不回复并关闭连接
+	port, _ := callServer(t, 0)
+	client := runClient(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := client.Call(context.Background(), message.CommandType_CommandType_Task, &message.MSG_TASK{
+		TaskId: proto.String("1"),
+		Type:   message.TaskType(0).Enum(),
+	})
+	if !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("err = %v, want %v", err, ErrConnClosed)
+	}
+	// 连接断开时立即失败，不等到调用超时
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("call failed after %v", elapsed)
+	}
+	// 连接断开后的调用直接失败
+	if _, err = client.Call(context.Background(), message.CommandType_CommandType_Task, &message.MSG_TASK{}); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("err after disconnect = %v, want %v", err, ErrConnClosed)
+	}
+}
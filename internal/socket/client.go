@@ -3,106 +3,378 @@ package socket
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"google.golang.org/protobuf/proto"
 	"io"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"tcpsocketv2/common/enums"
 	"tcpsocketv2/common/logger"
 	"tcpsocketv2/config"
+	"tcpsocketv2/internal/protocol"
 	"tcpsocketv2/internal/serializer"
 	message "tcpsocketv2/pb"
 	"time"
 )
 
-// ClientMsgHandlerInterface 客户端消息处理器
+// ClientMsgHandlerInterface 客户端消息处理器：发送握手和心跳，并将各指令的处理函数注册到客户端的指令注册表
 type ClientMsgHandlerInterface interface {
 	HandshakeReq() error
-	HandleHandshakeResp(payload *message.MSG_HANDSHAKE_RESP) error
 	HeartbeatReq() error
+	RegisterCommands(registry *Registry)
 }
 
 // Client 客户端
 type Client struct {
-	Address string
-	Port    int
-	Status  enums.ClientStatusEM
-	Conn    net.Conn
-	Handler ClientMsgHandlerInterface
-	Ctx     context.Context
+	Address   string // 当前连接的服务端地址
+	Port      int    // 当前连接的服务端端口
+	Endpoints *EndpointPool
+	Conn      net.Conn
+	Handler   ClientMsgHandlerInterface
+	Commands  *Registry       // 指令注册表
+	Ctx       context.Context // 当前连接的上下文，每次重连都会重新创建
+	Metrics   *Metrics        // 运行指标
+
+	rootCtx        context.Context            // 客户端生命周期的上下文，取消后停止重连
+	connCancel     context.CancelFunc         // 取消当前连接的上下文，会关闭当前连接
+	connWg         sync.WaitGroup             // 当前连接的后台协程（心跳、主服务端探测）
+	failback       atomic.Bool                // 主服务端已恢复，需要切回主服务端
+	closing        atomic.Bool                // 当前连接正在优雅断开，不再发送消息
+	reconnectAfter time.Duration              // 服务端优雅断开时建议的重连间隔
+	state          *stateMachine              // 连接状态机
+	active         atomic.Pointer[activeConn] // 当前连接及其上下文，供其他协程发起的同步调用读取
+}
+
+// activeConn 当前连接及其上下文，连接切换时整体替换，同步调用读取一次后始终使用同一个连接
+type activeConn struct {
+	conn net.Conn
+	ctx  context.Context
 }
 
-// NewClient 创建客户端
+// NewClient 创建连接单个服务端的客户端
 func NewClient(address string, port int) (*Client, context.CancelFunc) {
+	return NewClientWithEndpoints([]config.Endpoint{{Host: address, Port: port}})
+}
+
+// NewClientWithEndpoints 创建客户端，连接失败、握手被拒绝或心跳中断时按顺序切换到下一个服务端
+func NewClientWithEndpoints(endpoints []config.Endpoint) (*Client, context.CancelFunc) {
 	l := logger.Get()
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// 日志记录器存储到 context
-	logger.WithCtx(ctx, l)
+	// 日志记录器和编解码器存储到 context
+	ctx = logger.WithCtx(ctx, l)
+	ctx = serializer.WithCodec(ctx, serializer.NewCodec())
 
-	return &Client{
-		Address: address,
-		Port:    port,
-		Status:  enums.ClientStatusWaiting,
-		Conn:    nil,
-		Handler: nil,
-		Ctx:     ctx,
-	}, cancel
+	pool := NewEndpointPool(endpoints)
+	primary := pool.Primary()
+	c := &Client{
+		Address:   primary.Host,
+		Port:      primary.Port,
+		Endpoints: pool,
+		Commands:  NewRegistry(),
+		Metrics:   &Metrics{},
+		state:     newStateMachine(enums.ClientStatusWaiting),
+		Conn:      nil,
+		Handler:   nil,
+		Ctx:       ctx,
+		rootCtx:   ctx,
+	}
+	// 内置指令
+	Register(c.Commands, message.CommandType_CommandType_Goodbye, c.handleGoodbye)
+	Register(c.Commands, message.CommandType_CommandType_Error, handleError)
+	return c, cancel
 }
 
 // RegisterHandler 注册处理器
 func (c *Client) RegisterHandler(handler ClientMsgHandlerInterface) {
 	c.Handler = handler
+	handler.RegisterCommands(c.Commands)
+}
+
+// OnStateChange 注册状态变更监听器，监听器在状态发生变化时按注册顺序同步执行
+func (c *Client) OnStateChange(listener StateListener) {
+	c.state.subscribe(listener)
+}
+
+// Status 获取客户端当前状态
+func (c *Client) Status() enums.ClientStatusEM {
+	return c.state.current()
+}
+
+// Transition 转换客户端状态并记录原因，非法转换返回 ErrIllegalTransition
+func (c *Client) Transition(to enums.ClientStatusEM, reason string) error {
+	return c.state.transition(to, reason)
+}
+
+// WaitFor 阻塞直到客户端进入指定状态或上下文取消
+func (c *Client) WaitFor(state enums.ClientStatusEM, ctx context.Context) error {
+	return c.state.waitFor(state, ctx)
+}
+
+// StateHistory 最近的状态转换记录
+func (c *Client) StateHistory() []StateTransition {
+	return c.state.snapshot()
+}
+
+// moveTo 客户端内部的状态转换，非法转换只记录日志
+func (c *Client) moveTo(to enums.ClientStatusEM, reason string) {
+	if err := c.state.transition(to, reason); err != nil {
+		logger.FromCtx(c.rootCtx).Warn(fmt.Sprintf("客户端状态转换失败: %v, 原因: %v", err, reason))
+	}
 }
 
 // Connect 连接到服务器
 func (c *Client) Connect() error {
-	l := logger.FromCtx(c.Ctx)
-	server := fmt.Sprintf("%s:%d", c.Address, c.Port)
-	conn, err := net.Dial("tcp", server)
+	l := logger.FromCtx(c.rootCtx)
+	cfg := config.Get()
+	server := net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+	c.moveTo(enums.ClientStatusConnecting, "连接服务端 "+server)
+	dialer, err := newDialer(cfg, c.Address)
 	if err != nil {
+		c.moveTo(enums.ClientStatusDisConnected, "加载TLS配置失败")
+		return fmt.Errorf("Load TLS Config Failed\nerr: %v\n", err)
+	}
+	conn, err := dialer.DialContext(c.rootCtx, "tcp", server)
+	if err != nil {
+		c.moveTo(enums.ClientStatusDisConnected, fmt.Sprintf("连接服务端失败: %v", err))
 		return fmt.Errorf("Connect to %v Failed\nerr: %v\n", server, err)
 	}
 	c.Conn = conn
-	l.Info(fmt.Sprintf("Connect to %v Success", server))
+	l.Info(fmt.Sprintf("Connect to %v Success, TLS: %v", server, cfg.TLS.Enable))
 	return nil
 }
 
-// Run 启动客户端
+// contextDialer 连接服务端使用的拨号器，net.Dialer 和 tls.Dialer 都实现了该接口
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// newDialer 按配置创建连接服务端的拨号器，启用TLS时每次都读取最新的证书配置，超时时间包含TLS握手
+func newDialer(cfg *config.Config, host string) (contextDialer, error) {
+	netDialer := &net.Dialer{Timeout: cfg.SrvInfo.DialTimeout * time.Second}
+	if !cfg.TLS.Enable {
+		return netDialer, nil
+	}
+	loader, err := newTLSLoader(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Dialer{NetDialer: netDialer, Config: loader.clientConfig(host)}, nil
+}
+
+// Run 启动客户端，连接断开后切换服务端并按配置以指数退避的方式自动重连，直到客户端被取消
 func (c *Client) Run() {
-	l := logger.FromCtx(c.Ctx)
+	l := logger.FromCtx(c.rootCtx)
+	cfg := config.Get()
+	backoff := NewBackoff(cfg.Reconnect)
+	for {
+		// 建立连接并处理消息，直到连接断开
+		endpoint := c.Endpoints.Current()
+		c.Address, c.Port = endpoint.Host, endpoint.Port
+		c.reconnectAfter = 0
+		established := false
+		reason := ""
+		if c.Conn != nil {
+			established, reason = c.serve()
+		} else if err := c.Connect(); err != nil {
+			l.Error(fmt.Sprintf("Connect error: %v", err))
+		} else {
+			established, reason = c.serve()
+		}
+		// 握手被拒绝时保持 Error 状态
+		if state := c.Status(); state == enums.ClientStatusConnecting || state == enums.ClientStatusConnected {
+			c.moveTo(enums.ClientStatusDisConnected, reason)
+		}
+
+		if c.rootCtx.Err() != nil {
+			l.Info("客户端已取消，停止运行")
+			return
+		}
+		if !cfg.Reconnect.Enable {
+			l.Error("服务器关闭了连接，未启用断线重连，退出程序")
+			return
+		}
+		// 握手成功过的连接断开后重新开始计算退避时间
+		if established {
+			backoff.Reset()
+		}
+		// 主服务端已恢复，立即切回
+		if c.failback.Swap(false) {
+			c.Endpoints.Reset()
+			l.Info(fmt.Sprintf("主服务端 %v 已恢复，切回主服务端", endpointAddr(c.Endpoints.Primary())))
+			continue
+		}
+		// 连接失败、握手被拒绝或连接中断时切换到下一个服务端，所有服务端都失败一轮后才退避等待
+		next, wrapped := c.Endpoints.Failover()
+		if c.Endpoints.Len() > 1 {
+			l.Warn(fmt.Sprintf("服务端 %v 不可用，切换到 %v", endpointAddr(endpoint), endpointAddr(next)))
+		}
+		if !wrapped {
+			continue
+		}
+		delay, ok := backoff.Next()
+		// 服务端优雅断开时按其建议的间隔重连，避免所有客户端同时重连
+		if c.reconnectAfter > delay {
+			delay = c.reconnectAfter
+		}
+		if !ok {
+			l.Error(fmt.Sprintf("连续重连 %v 次失败，停止重连", cfg.Reconnect.MaxAttempts))
+			c.moveTo(enums.ClientStatusError, fmt.Sprintf("连续重连 %v 次失败", cfg.Reconnect.MaxAttempts))
+			return
+		}
+		l.Warn(fmt.Sprintf("第 %v 次重连将在 %v 后进行", backoff.Attempts(), delay))
+		c.moveTo(enums.ClientStatusWaiting, fmt.Sprintf("等待 %v 后重连", delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.rootCtx.Done():
+			timer.Stop()
+			l.Info("客户端已取消，停止重连")
+			return
+		}
+	}
+}
+
+// serve 在当前连接上完成握手并循环处理消息，连接断开后返回是否握手成功过以及断开原因
+func (c *Client) serve() (established bool, reason string) {
+	l := logger.FromCtx(c.rootCtx)
+	// 每个连接使用独立的上下文和编解码器，协商结果不会带到下一个连接
+	ctx, cancel := context.WithCancel(c.rootCtx)
+	c.Ctx = serializer.WithCodec(ctx, serializer.NewCodec())
+	c.connCancel = cancel
+	c.closing.Store(false)
+	// 所有写入经由连接的写队列发送
+	c.Conn = newQueuedConn(c.Conn, c.Metrics)
+	// 须在握手超时内收到握手响应；握手完成后默认不限制读取时间，服务端同意回复心跳响应时由握手处理设置空闲超时，
+	// 超时未收到任何消息说明连接已半开，关闭连接后重连
+	deadline := newReadDeadline(c.Conn, config.Get().Msg.HandshakeTimeout*time.Second, 0)
+	c.Ctx = withReadDeadline(c.Ctx, deadline)
+	// 连接断开时等待回复的同步调用立即返回
+	calls := newInflight(c.Metrics)
+	c.Ctx = withInflight(c.Ctx, calls)
+	conn := c.Conn
+	connCtx := c.Ctx
+	c.active.Store(&activeConn{conn: conn, ctx: connCtx})
+	// 客户端取消或切回主服务端时通知服务端并等待其处理完剩余消息，其他情况（如心跳发送失败）直接关闭连接
+	stop := context.AfterFunc(ctx, func() {
+		switch {
+		case c.rootCtx.Err() != nil:
+			c.sayGoodbye(conn, connCtx, enums.GoodbyeCode_Normal, "客户端退出")
+		case c.failback.Load():
+			c.sayGoodbye(conn, connCtx, enums.GoodbyeCode_Failback, "客户端切换回主服务端")
+		default:
+			_ = conn.Close()
+		}
+	})
 	defer func() {
-		err := c.Conn.Close()
-		if err != nil {
+		stop()
+		cancel()
+		// 先撤下当前连接再让等待中的调用失败，之后的调用不会再使用该连接
+		c.active.Store(nil)
+		calls.close(ErrConnClosed)
+		err := conn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			l.Error(fmt.Sprintf("Conn Close Error: %v", err))
 		}
+		// 等待后台协程退出后再释放连接，避免与下一次连接并发访问
+		c.connWg.Wait()
+		c.Conn = nil
+	}()
+	// 发生 panic 时只断开当前连接，之后按断线处理重连
+	defer func() {
+		if p := recover(); p != nil {
+			c.Metrics.reportPanic(l, newPanicError(p), "处理连接时", c.session())
+			reason = "处理连接时发生panic"
+		}
 	}()
-	// 发送握手消息
+
+	// 发送握手消息，调用方直接设置的连接也要经过 Connecting 状态
+	c.moveTo(enums.ClientStatusConnecting, "开始握手")
 	err := c.Handler.HandshakeReq()
 	if err != nil {
 		l.Error(fmt.Sprintf("客户端发送握手消息失败了，Error: %v", err))
-		return
+		return false, fmt.Sprintf("发送握手消息失败: %v", err)
 	}
 	reader := bufio.NewReader(c.Conn)
 
-	// 创建上下文
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	c.Ctx = ctx
-
 	for {
+		// 已握手且设置了空闲超时时，每次读取前延后空闲超时
+		deadline.refresh()
 		// 反序列化消息
-		command, payload, err := serializer.DeserializeMessage(reader, c.Ctx)
+		command, payload, envelope, err := serializer.DeserializeEnvelope(reader, c.Ctx)
 		if err == io.EOF {
-			// TODO: 后续实现关系连接挥手消息，以及断线重连
-			l.Error(fmt.Sprintf("收到EOF，服务器关闭了连接，退出程序"))
-			break
+			// 优雅断开时对端处理完剩余消息后关闭连接
+			if c.closing.Load() {
+				l.Info("优雅断开完成，连接已关闭")
+				if ctx.Err() != nil {
+					return established, "客户端主动断开"
+				}
+				return established, "服务端主动断开"
+			}
+			l.Error(fmt.Sprintf("收到EOF，服务器关闭了连接"))
+			return established, "服务器关闭了连接"
+		}
+		// 读超时，按所处阶段区分原因
+		if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() == nil {
+			if deadline.current() == phaseHandshake {
+				c.Metrics.HandshakeTimeouts.Add(1)
+				l.Warn("握手超时，关闭连接")
+				return established, "握手超时"
+			}
+			if deadline.current() == phaseIdle {
+				c.Metrics.IdleTimeouts.Add(1)
+				l.Warn("空闲超时，长时间未收到服务端的消息，连接可能已中断，关闭连接")
+				return established, "空闲超时"
+			}
+			l.Info("优雅断开排空超时，关闭连接")
+			return established, "优雅断开排空超时"
+		}
+		// 同步调用的回复交给等待中的调用，消息体有误时调用方收到错误
+		if envelope.ReplyTo != 0 {
+			handleReply(c.Ctx, command, envelope, payload, err)
+			continue
+		}
+		msgCtx := withRequest(c.Ctx, command, envelope.RequestId)
+		// 未注册的指令回复错误后继续处理后续消息
+		if errors.Is(err, serializer.ErrUnknownCommand) {
+			replyUnknownCommand(c.Conn, msgCtx, command)
+			continue
 		}
 		if err != nil {
 			l.Error(fmt.Sprintf("deserialize message error: %v", err))
+			if errors.Is(err, protocol.ErrChecksum) {
+				c.Metrics.CorruptedFrames.Add(1)
+			}
+			// 数据流已经错乱、校验失败策略要求关闭连接或连接已关闭
+			if ctx.Err() != nil {
+				return established, "连接已被客户端关闭"
+			}
+			if serializer.IsFatal(err) || errors.Is(err, net.ErrClosed) {
+				return established, fmt.Sprintf("读取消息失败: %v", err)
+			}
 			continue
 		}
 		l.Debug(fmt.Sprintf("收到服务器的响应，handler: %v, payload: %v", command, payload))
-		handleMsgErr := c.handleMessage(command, payload)
+		handleMsgErr := c.handleMessage(msgCtx, command, payload)
+		if !established && c.Status() == enums.ClientStatusConnected {
+			established = true
+			deadline.established()
+			c.startFailbackProbe()
+		}
+		if errors.Is(handleMsgErr, serializer.ErrUnknownCommand) {
+			replyUnknownCommand(c.Conn, msgCtx, command)
+			continue
+		}
+		var panicErr *PanicError
+		if errors.As(handleMsgErr, &panicErr) {
+			c.Metrics.reportPanic(l, panicErr, fmt.Sprintf("处理指令 %v 时", command), c.session())
+			return established, "处理消息时发生panic"
+		}
 		if handleMsgErr != nil {
 			l.Error(fmt.Sprintf("处理服务器消息异常, Error: %v", handleMsgErr))
 			continue
@@ -110,22 +382,37 @@ func (c *Client) Run() {
 	}
 }
 
-// handleMessage 处理消息
-func (c *Client) handleMessage(command message.CommandType, payload interface{}) (err error) {
-	switch command {
-	case message.CommandType_CommandType_HandShakeResp:
-		err = c.Handler.HandleHandshakeResp(payload.(*message.MSG_HANDSHAKE_RESP))
-	default:
-		err = fmt.Errorf("Unknow command: %v, payload: %v\n", command, payload)
+// handleMessage 处理消息，根据指令注册表调用对应的处理函数
+func (c *Client) handleMessage(ctx context.Context, command message.CommandType, payload proto.Message) error {
+	return c.Commands.dispatch(ctx, command, c.session(), payload)
+}
+
+// session 当前连接的会话信息，客户端没有会话管理器，只包含连接、上下文和服务端地址
+func (c *Client) session() *Session {
+	_session := &Session{Ctx: c.Ctx, Conn: c.Conn}
+	if c.Conn != nil {
+		_session.RemoteAddr = c.Conn.RemoteAddr().String()
 	}
-	return err
+	return _session
 }
 
-// StartHeartbeat 启动心跳
+// StartHeartbeat 启动心跳，客户端断开连接或上下文取消时停止
 func (c *Client) StartHeartbeat() (err error) {
 	cfg := config.Get()
+	ctx := c.Ctx
+	l := logger.FromCtx(ctx)
+	cancel := c.connCancel
 	// 启动心跳协程
+	c.connWg.Add(1)
 	go func() {
+		defer c.connWg.Done()
+		// 发生 panic 时断开当前连接
+		defer func() {
+			if p := recover(); p != nil {
+				c.Metrics.reportPanic(l, newPanicError(p), "发送心跳时", c.session())
+				cancel()
+			}
+		}()
 		ticker := time.NewTicker(time.Second * cfg.Msg.HeartbeatInterval)
 		// 创建心跳定时器
 		defer ticker.Stop()
@@ -133,17 +420,71 @@ func (c *Client) StartHeartbeat() (err error) {
 			select {
 			case <-ticker.C:
 				// 检查连接状态
-				if c.Status != enums.ClientStatusConnected {
-					err = fmt.Errorf("客户端未连接，停止心跳发送")
+				if c.Status() != enums.ClientStatusConnected || c.closing.Load() {
+					l.Warn("客户端未连接，停止心跳发送")
+					return
+				}
+				// 发送心跳包，发送失败说明连接已中断，关闭连接以便切换服务端重连
+				if sendErr := c.Handler.HeartbeatReq(); sendErr != nil {
+					// 采集性能数据期间连接已关闭
+					if ctx.Err() != nil || c.closing.Load() {
+						return
+					}
+					l.Error(fmt.Sprintf("发送心跳包失败，关闭连接，Error: %v", sendErr))
+					cancel()
+					return
 				}
-				// 发送心跳包
-				err = c.Handler.HeartbeatReq()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
 
+// startFailbackProbe 连接备用服务端时定期探测主服务端，主服务端恢复后关闭当前连接以切回主服务端
+func (c *Client) startFailbackProbe() {
+	interval := config.Get().SrvInfo.FailbackInterval
+	if interval <= 0 || c.Endpoints.IsPrimary() {
+		return
+	}
+	ctx := c.Ctx
+	cancel := c.connCancel
+	l := logger.FromCtx(ctx)
+	endpoint := c.Endpoints.Primary()
+	primary := endpointAddr(endpoint)
+	c.connWg.Add(1)
+	go func() {
+		defer c.connWg.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				c.Metrics.reportPanic(l, newPanicError(p), "探测主服务端时", c.session())
+			}
+		}()
+		ticker := time.NewTicker(time.Second * interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// 与正常连接使用相同的TLS配置，只有TLS握手成功才认为主服务端已恢复
+				dialer, err := newDialer(config.Get(), endpoint.Host)
+				if err != nil {
+					l.Warn(fmt.Sprintf("探测主服务端时加载TLS配置失败: %v", err))
+					continue
+				}
+				conn, err := dialer.DialContext(ctx, "tcp", primary)
 				if err != nil {
-					err = fmt.Errorf("发送心跳包失败，Error: %v\n", err)
+					l.Debug(fmt.Sprintf("主服务端 %v 仍不可用: %v", primary, err))
+					continue
 				}
+				_ = conn.Close()
+				l.Info(fmt.Sprintf("探测到主服务端 %v 已恢复，断开备用服务端连接", primary))
+				c.failback.Store(true)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
-	return err
 }
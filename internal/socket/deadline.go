@@ -0,0 +1,101 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// readPhase 连接读超时所处的阶段
+type readPhase int
+
+const (
+	phaseHandshake readPhase = iota // 握手阶段：须在建立连接后的握手超时内完成握手
+	phaseIdle                       // 已握手：每次读取前将读超时延后到空闲超时之后
+	phaseDrain                      // 优雅断开：读超时固定为排空超时，不再延后
+)
+
+// readDeadline 管理连接的读超时，避免半开连接或迟迟不发数据的客户端一直占用连接处理协程
+type readDeadline struct {
+	mu    sync.Mutex
+	conn  net.Conn
+	phase readPhase
+	idle  time.Duration // 空闲超时，0 表示不限制
+}
+
+// readDeadlineCtxKey 上下文中保存读超时的键
+type readDeadlineCtxKey struct{}
+
+// newReadDeadline 创建读超时并立即开始计算握手超时，handshake 为0时不限制握手时间
+func newReadDeadline(conn net.Conn, handshake, idle time.Duration) *readDeadline {
+	d := &readDeadline{conn: conn, idle: idle}
+	if handshake > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(handshake))
+	}
+	return d
+}
+
+// withReadDeadline 将读超时注入到连接的上下文中，优雅断开时据此切换为排空超时
+func withReadDeadline(ctx context.Context, d *readDeadline) context.Context {
+	return context.WithValue(ctx, readDeadlineCtxKey{}, d)
+}
+
+// readDeadlineFromCtx 从上下文中获取读超时，不存在时返回 nil
+func readDeadlineFromCtx(ctx context.Context) *readDeadline {
+	d, _ := ctx.Value(readDeadlineCtxKey{}).(*readDeadline)
+	return d
+}
+
+// SetIdleTimeout 设置当前连接已握手后的空闲读超时，0 表示不限制，下一次读取时生效
+func SetIdleTimeout(ctx context.Context, idle time.Duration) {
+	d := readDeadlineFromCtx(ctx)
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.idle = idle
+}
+
+// handshaking 是否仍处于握手阶段
+func (d *readDeadline) handshaking() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.phase == phaseHandshake
+}
+
+// established 握手完成，取消握手超时，之后按空闲超时计算
+func (d *readDeadline) established() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.phase != phaseHandshake {
+		return
+	}
+	d.phase = phaseIdle
+	_ = d.conn.SetReadDeadline(time.Time{})
+}
+
+// refresh 读取下一条消息前调用，已握手时将读超时延后到空闲超时之后
+func (d *readDeadline) refresh() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.phase == phaseIdle && d.idle > 0 {
+		_ = d.conn.SetReadDeadline(time.Now().Add(d.idle))
+	}
+}
+
+// drain 进入优雅断开阶段，读超时固定为 timeout 之后
+func (d *readDeadline) drain(timeout time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.phase = phaseDrain
+	return d.conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// current 当前所处的阶段，读超时后据此区分超时原因
+func (d *readDeadline) current() readPhase {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.phase
+}
@@ -0,0 +1,106 @@
+package socket
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"tcpsocketv2/config"
+)
+
+// EndpointPool 客户端的服务端地址列表，连接失败时按顺序故障转移
+type EndpointPool struct {
+	mu        sync.Mutex
+	endpoints []config.Endpoint // 按优先级和权重排好序的地址，第一个为主服务端
+	index     int               // 当前使用的地址下标
+}
+
+// NewEndpointPool 创建服务端地址列表，按优先级升序排列，同优先级内按权重随机排序
+func NewEndpointPool(endpoints []config.Endpoint) *EndpointPool {
+	ordered := make([]config.Endpoint, len(endpoints))
+	copy(ordered, endpoints)
+	// 稳定排序，同优先级保持配置顺序
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+	for start := 0; start < len(ordered); {
+		end := start + 1
+		for end < len(ordered) && ordered[end].Priority == ordered[start].Priority {
+			end++
+		}
+		shuffleByWeight(ordered[start:end])
+		start = end
+	}
+	return &EndpointPool{endpoints: ordered}
+}
+
+// shuffleByWeight 按权重随机排序：每次以 weight/总权重 的概率选出下一个地址，权重为0的地址排在最后
+func shuffleByWeight(group []config.Endpoint) {
+	for i := range group {
+		total := 0
+		for _, endpoint := range group[i:] {
+			total += endpoint.Weight
+		}
+		if total == 0 {
+			return
+		}
+		pick := rand.Intn(total)
+		for j := i; j < len(group); j++ {
+			if pick < group[j].Weight {
+				// 保持剩余地址的相对顺序
+				chosen := group[j]
+				copy(group[i+1:j+1], group[i:j])
+				group[i] = chosen
+				break
+			}
+			pick -= group[j].Weight
+		}
+	}
+}
+
+// Current 当前使用的服务端地址
+func (p *EndpointPool) Current() config.Endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endpoints[p.index]
+}
+
+// Primary 主服务端地址
+func (p *EndpointPool) Primary() config.Endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endpoints[0]
+}
+
+// IsPrimary 当前是否使用主服务端
+func (p *EndpointPool) IsPrimary() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.index == 0
+}
+
+// Failover 切换到下一个服务端地址，所有地址都尝试过一轮后回到主服务端并返回 true
+func (p *EndpointPool) Failover() (config.Endpoint, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.index = (p.index + 1) % len(p.endpoints)
+	return p.endpoints[p.index], p.index == 0
+}
+
+// Reset 回到主服务端
+func (p *EndpointPool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.index = 0
+}
+
+// Len 服务端地址数量
+func (p *EndpointPool) Len() int {
+	return len(p.endpoints)
+}
+
+// endpointAddr 服务端地址的 host:port 形式
+func endpointAddr(endpoint config.Endpoint) string {
+	return net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+}
@@ -0,0 +1,153 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+// hosts 地址列表中的主机名
+func hosts(endpoints []config.Endpoint) []string {
+	names := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		names[i] = endpoint.Host
+	}
+	return names
+}
+
+func TestEndpointPoolPriority(t *testing.T) {
+	// 按优先级升序排列，同优先级且权重都为0时保持配置顺序
+	pool := NewEndpointPool([]config.Endpoint{
+		{Host: "c", Priority: 2},
+		{Host: "a", Priority: 0},
+		{Host: "d", Priority: 2},
+		{Host: "b", Priority: 1},
+		{Host: "e", Priority: 2},
+	})
+	if got, want := hosts(pool.endpoints), []string{"a", "b", "c", "d", "e"}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+
+	// 权重只影响同优先级内的顺序
+	for i := 0; i < 100; i++ {
+		pool = NewEndpointPool([]config.Endpoint{
+			{Host: "backup-1", Priority: 1, Weight: 1},
+			{Host: "primary", Priority: 0, Weight: 1},
+			{Host: "backup-2", Priority: 1, Weight: 1},
+		})
+		if got := hosts(pool.endpoints); got[0] != "primary" || !slices.Contains(got[1:], "backup-1") || !slices.Contains(got[1:], "backup-2") {
+			t.Fatalf("order = %v, want primary first", got)
+		}
+	}
+}
+
+func TestShuffleByWeight(t *testing.T) {
+	const rounds = 10000
+	first := make(map[string]int)
+	for i := 0; i < rounds; i++ {
+		group := []config.Endpoint{{Host: "heavy", Weight: 3}, {Host: "zero", Weight: 0}, {Host: "light", Weight: 1}}
+		shuffleByWeight(group)
+		// 权重为0的地址总是排在最后
+		if group[2].Host != "zero" {
+			t.Fatalf("order = %v, want zero weight last", hosts(group))
+		}
+		first[group[0].Host]++
+	}
+	// 以 weight/总权重 的概率排在第一位
+	if ratio := float64(first["heavy"]) / rounds; ratio < 0.7 || ratio > 0.8 {
+		t.Fatalf("heavy first ratio = %.3f, want about 0.75", ratio)
+	}
+
+	// 全部为0时保持原有顺序
+	group := []config.Endpoint{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	shuffleByWeight(group)
+	if got, want := hosts(group), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	pool := NewEndpointPool([]config.Endpoint{{Host: "a"}, {Host: "b", Priority: 1}, {Host: "c", Priority: 2}})
+	if !pool.IsPrimary() || pool.Current().Host != "a" || pool.Primary().Host != "a" {
+		t.Fatalf("current = %v, want primary", pool.Current().Host)
+	}
+	// 依次切换，尝试过一轮后回到主服务端
+	for _, want := range []struct {
+		host    string
+		wrapped bool
+	}{{"b", false}, {"c", false}, {"a", true}, {"b", false}} {
+		next, wrapped := pool.Failover()
+		if next.Host != want.host || wrapped != want.wrapped || pool.Current().Host != want.host {
+			t.Fatalf("Failover = %v, %v, want %v, %v", next.Host, wrapped, want.host, want.wrapped)
+		}
+	}
+	if pool.IsPrimary() {
+		t.Fatal("IsPrimary after failover")
+	}
+	pool.Reset()
+	if !pool.IsPrimary() || pool.Current().Host != "a" {
+		t.Fatalf("current after reset = %v", pool.Current().Host)
+	}
+}
+
+func TestClientFailback(t *testing.T) {
+	callConfig(t, true)
+	config.Cfg.SrvInfo = config.ServerInfo{FailbackInterval: 1, DialTimeout: 1}
+	// 主服务端暂不可用，先占用一个端口再释放
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primaryPort := reserved.Addr().(*net.TCPAddr).Port
+	_ = reserved.Close()
+	backupPort, backupAccepted := callServer(t, 0)
+
+	client, cancel := NewClientWithEndpoints([]config.Endpoint{
+		{Host: "127.0.0.1", Port: backupPort, Priority: 1},
+		{Host: "127.0.0.1", Port: primaryPort},
+	})
+	client.RegisterHandler(&pipeHandler{client: client})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.Run()
+	}()
+	stop := sync.OnceFunc(func() {
+		cancel()
+		<-stopped
+	})
+	t.Cleanup(stop)
+
+	// 连接主服务端失败后切换到备用服务端
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	if err = client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.Endpoints.IsPrimary() || backupAccepted.Load() != 1 {
+		t.Fatalf("connected to primary = %v, backup accepted = %v", client.Endpoints.IsPrimary(), backupAccepted.Load())
+	}
+
+	// 主服务端恢复后，探测成功并切回主服务端
+	primary, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(primaryPort)))
+	if err != nil {
+		t.Skipf("primary port reused: %v", err)
+	}
+	primaryAccepted := serveListener(t, primary, 0)
+	// 模拟的主服务端等待连接关闭后才退出，需要先停止客户端
+	t.Cleanup(stop)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		// 探测连接也会被计数，切回后至少有两个连接
+		if client.Endpoints.IsPrimary() && client.Status() == enums.ClientStatusConnected && primaryAccepted.Load() >= 2 {
+			return
+		}
+	}
+	t.Fatalf("not failed back: primary = %v, status = %v, accepted = %v",
+		client.Endpoints.IsPrimary(), client.Status(), primaryAccepted.Load())
+}
@@ -0,0 +1,101 @@
+package socket
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// writeGoodbye 发送优雅断开消息并关闭写方向，之后只读取对端尚未发完的消息，排空超时后读操作返回错误
+func writeGoodbye(conn net.Conn, ctx context.Context, code enums.GoodbyeCode, reason string, reconnectAfter time.Duration) error {
+	_code := int32(code)
+	_reconnectAfter := int64(reconnectAfter / time.Second)
+	pkg, err := serializer.CodecFromCtx(ctx).SerializeMessage(
+		message.CommandType_CommandType_Goodbye,
+		&message.MSG_GOODBYE{
+			Code:           &_code,
+			Message:        &reason,
+			ReconnectAfter: &_reconnectAfter,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("序列化优雅断开消息异常: %v", err)
+	}
+	if _, err = conn.Write(pkg); err != nil {
+		return fmt.Errorf("发送优雅断开消息失败: %v", err)
+	}
+	return drain(conn, ctx)
+}
+
+// drain 关闭写方向，并限制继续读取对端剩余消息的时间，之后不再按空闲超时延后
+func drain(conn net.Conn, ctx context.Context) error {
+	if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err := closer.CloseWrite(); err != nil {
+			return fmt.Errorf("关闭连接写方向失败: %v", err)
+		}
+	}
+	timeout := config.Get().Msg.DrainTimeout * time.Second
+	if d := readDeadlineFromCtx(ctx); d != nil {
+		return d.drain(timeout)
+	}
+	return conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// Goodbye 通知客户端服务端将断开连接，客户端处理完已收到的消息后关闭连接
+func (s *Server) Goodbye(conn net.Conn, code enums.GoodbyeCode, reason string, reconnectAfter time.Duration) error {
+	_session, ok := s.Sessions.Get(conn)
+	if !ok {
+		return fmt.Errorf("未找到对应的会话: %v", conn.RemoteAddr())
+	}
+	l := logger.FromCtx(_session.Ctx)
+	l.Info(fmt.Sprintf("Server, 通知客户端断开连接, 原因码: %v, 原因: %v, 建议重连间隔: %v, Client: %v", code, reason, reconnectAfter, conn.RemoteAddr()))
+	return writeGoodbye(conn, _session.Ctx, code, reason, reconnectAfter)
+}
+
+// GoodbyeAll 通知所有客户端断开连接
+func (s *Server) GoodbyeAll(code enums.GoodbyeCode, reason string, reconnectAfter time.Duration) {
+	l := logger.Get()
+	for _, _session := range s.Sessions.Snapshot() {
+		if err := s.Goodbye(_session.Conn, code, reason, reconnectAfter); err != nil {
+			l.Error(fmt.Sprintf("Server, 通知客户端断开连接失败: %v, Client: %v", err, _session.RemoteAddr))
+		}
+	}
+}
+
+// handleGoodbye 客户端主动断开，移除会话后继续读取客户端剩余的消息直到对端关闭
+func (s *Server) handleGoodbye(ctx context.Context, _session *Session, payload *message.MSG_GOODBYE) error {
+	l := logger.FromCtx(ctx)
+	conn := _session.Conn
+	l.Info(fmt.Sprintf("Server, 客户端主动断开, 原因码: %v, 原因: %v, Client: %v", payload.GetCode(), payload.GetMessage(), conn.RemoteAddr()))
+	s.Sessions.Remove(conn)
+	return drain(conn, ctx)
+}
+
+// handleGoodbye 服务端通知断开，停止发送消息并记录建议的重连间隔，处理完服务端剩余消息后断开
+func (c *Client) handleGoodbye(ctx context.Context, _session *Session, payload *message.MSG_GOODBYE) error {
+	l := logger.FromCtx(ctx)
+	l.Warn(fmt.Sprintf("服务端通知断开连接, 原因码: %v, 原因: %v, 建议重连间隔: %v秒", payload.GetCode(), payload.GetMessage(), payload.GetReconnectAfter()))
+	c.reconnectAfter = time.Duration(payload.GetReconnectAfter()) * time.Second
+	c.closing.Store(true)
+	c.moveTo(enums.ClientStatusDisConnected, fmt.Sprintf("服务端断开连接: %v", payload.GetMessage()))
+	return drain(_session.Conn, ctx)
+}
+
+// sayGoodbye 通知服务端客户端将断开连接，每个连接只发送一次
+func (c *Client) sayGoodbye(conn net.Conn, ctx context.Context, code enums.GoodbyeCode, reason string) {
+	if c.closing.Swap(true) {
+		return
+	}
+	l := logger.FromCtx(ctx)
+	l.Info(fmt.Sprintf("通知服务端断开连接, 原因: %v", reason))
+	if err := writeGoodbye(conn, ctx, code, reason, 0); err != nil {
+		l.Error(fmt.Sprintf("通知服务端断开连接失败，直接关闭连接: %v", err))
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,50 @@
+package socket
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// Call 一次消息处理，拦截器可以读取指令、消息体和会话，也可以替换消息体后再继续处理
+type Call struct {
+	Command   message.CommandType // 指令
+	Payload   proto.Message       // 消息体
+	Session   *Session            // 消息所属的会话
+	RequestId uint64              // 同步调用的请求ID，不是同步调用时为0
+	Received  time.Time           // 开始处理的时间
+}
+
+// Invoker 继续处理消息：调用下一个拦截器，最后一个拦截器调用指令的处理函数
+type Invoker func(ctx context.Context, call *Call) error
+
+// Interceptor 消息拦截器，调用 next 之前和之后的逻辑即前置和后置钩子，不调用 next 则不再处理该消息；
+// 未注册的指令同样经过拦截器，此时 next 返回 serializer.ErrUnknownCommand
+type Interceptor func(ctx context.Context, call *Call, next Invoker) error
+
+// Use 按顺序添加拦截器，先添加的拦截器在外层，最先执行前置逻辑、最后执行后置逻辑
+func (r *Registry) Use(interceptors ...Interceptor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interceptors = append(r.interceptors, interceptors...)
+	// 从内到外组装调用链，处理消息时不必再逐个包装
+	chain := r.invoke
+	for i := len(r.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := r.interceptors[i], chain
+		chain = func(ctx context.Context, call *Call) error {
+			return interceptor(ctx, call, next)
+		}
+	}
+	r.chain = chain
+}
+
+// Use 添加服务端的消息拦截器，对所有连接收到的消息生效
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.Commands.Use(interceptors...)
+}
+
+// Use 添加客户端的消息拦截器，对之后每个连接收到的消息生效
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.Commands.Use(interceptors...)
+}
@@ -0,0 +1,114 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"testing"
+)
+
+// recordingInterceptor 记录前置和后置逻辑的执行顺序
+func recordingInterceptor(name string, calls *[]string) Interceptor {
+	return func(ctx context.Context, call *Call, next Invoker) error {
+		*calls = append(*calls, name+" before")
+		err := next(ctx, call)
+		*calls = append(*calls, name+" after")
+		return err
+	}
+}
+
+// heartbeatRegistry 注册了心跳处理函数的指令注册表，处理函数记录收到的系统信息
+func heartbeatRegistry(calls *[]string) *Registry {
+	r := NewRegistry()
+	Register(r, message.CommandType_CommandType_Heartbeat, func(ctx context.Context, session *Session, payload *message.MSG_HEARTBEAT) error {
+		*calls = append(*calls, "handler "+payload.GetOs())
+		return nil
+	})
+	return r
+}
+
+// heartbeat 测试使用的心跳消息
+func heartbeat(os string) *message.MSG_HEARTBEAT {
+	return &message.MSG_HEARTBEAT{Os: proto.String(os), Cpu: proto.Float64(1), Mem: proto.Float64(1)}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	// 分多次添加，先添加的在外层
+	r.Use(recordingInterceptor("first", &calls))
+	r.Use(recordingInterceptor("second", &calls), recordingInterceptor("third", &calls))
+	if err := r.dispatch(context.Background(), message.CommandType_CommandType_Heartbeat, &Session{}, heartbeat("linux")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"first before", "second before", "third before",
+		"handler linux",
+		"third after", "second after", "first after",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	errDenied := errors.New("denied")
+	var outerErr error
+	r.Use(
+		func(ctx context.Context, call *Call, next Invoker) error {
+			outerErr = next(ctx, call)
+			return outerErr
+		},
+		// 不调用 next，内层拦截器和处理函数都不再执行
+		func(ctx context.Context, call *Call, next Invoker) error {
+			calls = append(calls, "deny "+call.Command.String())
+			return errDenied
+		},
+		recordingInterceptor("inner", &calls),
+	)
+	err := r.dispatch(context.Background(), message.CommandType_CommandType_Heartbeat, &Session{}, heartbeat("linux"))
+	if !errors.Is(err, errDenied) || !errors.Is(outerErr, errDenied) {
+		t.Fatalf("err = %v, outer saw %v, want %v", err, outerErr, errDenied)
+	}
+	if want := []string{"deny CommandType_Heartbeat"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestInterceptorReplacesPayload(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	r.Use(func(ctx context.Context, call *Call, next Invoker) error {
+		call.Payload = heartbeat("replaced")
+		return next(ctx, call)
+	})
+	if err := r.dispatch(context.Background(), message.CommandType_CommandType_Heartbeat, &Session{}, heartbeat("linux")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"handler replaced"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestInterceptorUnknownCommand(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	var seen error
+	r.Use(func(ctx context.Context, call *Call, next Invoker) error {
+		seen = next(ctx, call)
+		return seen
+	})
+	// 未注册的指令同样经过拦截器，next 返回未知指令错误
+	err := r.dispatch(context.Background(), message.CommandType_CommandType_TaskOutput, &Session{}, &message.MSG_TASK_OUTPUT{})
+	if !errors.Is(err, serializer.ErrUnknownCommand) || !errors.Is(seen, serializer.ErrUnknownCommand) {
+		t.Fatalf("err = %v, interceptor saw %v, want %v", err, seen, serializer.ErrUnknownCommand)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("calls = %v, want none", calls)
+	}
+}
@@ -0,0 +1,81 @@
+package socket
+
+import "sync/atomic"
+
+// Metrics 连接相关的运行指标，服务端和客户端各自持有一份
+type Metrics struct {
+	QueueDepth          atomic.Int64 // 所有连接写队列中待发送的消息数
+	MaxQueueDepth       atomic.Int64 // 单个连接写队列的历史最大深度
+	DroppedFrames       atomic.Int64 // 写队列满时丢弃的消息数
+	OverflowDisconnects atomic.Int64 // 写队列满时断开的连接数
+	WriteErrors         atomic.Int64 // 写入失败次数（不含超时）
+	WriteTimeouts       atomic.Int64 // 写超时次数
+	HandshakeTimeouts   atomic.Int64 // 未在规定时间内完成握手而断开的连接数
+	IdleTimeouts        atomic.Int64 // 空闲超时断开的连接数
+	RejectedByRate      atomic.Int64 // 超过接受速率被关闭的连接数
+	RejectedByPending   atomic.Int64 // 未完成握手的连接数超过限制被关闭的连接数
+	RejectedByLimit     atomic.Int64 // 并发连接数超过限制被拒绝握手的连接数
+	RejectedByIPLimit   atomic.Int64 // 同一IP连接数超过限制被拒绝握手的连接数
+	RejectedByACL       atomic.Int64 // 来源IP不被允许访问而关闭的连接数
+	KickedByACL         atomic.Int64 // 访问控制列表重新加载后断开的连接数
+	Panics              atomic.Int64 // 处理消息或后台协程中发生 panic 的次数
+	InflightCalls       atomic.Int64 // 正在等待回复的同步调用数
+	CallTimeouts        atomic.Int64 // 超时或被取消的同步调用数
+	CorruptedFrames     atomic.Int64 // 校验和不匹配的帧数，单个连接的数量见 Session.CorruptedFrames
+}
+
+// MetricsSnapshot 某一时刻的运行指标
+type MetricsSnapshot struct {
+	QueueDepth          int64
+	MaxQueueDepth       int64
+	DroppedFrames       int64
+	OverflowDisconnects int64
+	WriteErrors         int64
+	WriteTimeouts       int64
+	HandshakeTimeouts   int64
+	IdleTimeouts        int64
+	RejectedByRate      int64
+	RejectedByPending   int64
+	RejectedByLimit     int64
+	RejectedByIPLimit   int64
+	RejectedByACL       int64
+	KickedByACL         int64
+	Panics              int64
+	InflightCalls       int64
+	CallTimeouts        int64
+	CorruptedFrames     int64
+}
+
+// Snapshot 获取当前的运行指标
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		QueueDepth:          m.QueueDepth.Load(),
+		MaxQueueDepth:       m.MaxQueueDepth.Load(),
+		DroppedFrames:       m.DroppedFrames.Load(),
+		OverflowDisconnects: m.OverflowDisconnects.Load(),
+		WriteErrors:         m.WriteErrors.Load(),
+		WriteTimeouts:       m.WriteTimeouts.Load(),
+		HandshakeTimeouts:   m.HandshakeTimeouts.Load(),
+		IdleTimeouts:        m.IdleTimeouts.Load(),
+		RejectedByRate:      m.RejectedByRate.Load(),
+		RejectedByPending:   m.RejectedByPending.Load(),
+		RejectedByLimit:     m.RejectedByLimit.Load(),
+		RejectedByIPLimit:   m.RejectedByIPLimit.Load(),
+		RejectedByACL:       m.RejectedByACL.Load(),
+		KickedByACL:         m.KickedByACL.Load(),
+		Panics:              m.Panics.Load(),
+		InflightCalls:       m.InflightCalls.Load(),
+		CallTimeouts:        m.CallTimeouts.Load(),
+		CorruptedFrames:     m.CorruptedFrames.Load(),
+	}
+}
+
+// observeQueueDepth 记录写队列深度的最大值
+func (m *Metrics) observeQueueDepth(depth int64) {
+	for {
+		current := m.MaxQueueDepth.Load()
+		if depth <= current || m.MaxQueueDepth.CompareAndSwap(current, depth) {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package socket
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"runtime/debug"
+)
+
+// PanicError 处理消息或后台协程中发生的 panic，只影响所在的连接
+type PanicError struct {
+	Value any    // panic 的值
+	Stack []byte // 发生 panic 时的调用栈
+}
+
+// Error 实现 error 接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// newPanicError 在 defer 中调用，将 recover 的返回值转换为错误，此时调用栈仍是发生 panic 的协程的调用栈
+func newPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// reportPanic 记录 panic 的调用栈和所在的会话，并增加 panic 计数
+func (m *Metrics) reportPanic(l *zap.Logger, err *PanicError, where string, _session *Session) {
+	m.Panics.Add(1)
+	l.Error(fmt.Sprintf("%v发生panic: %v, %v\n%s", where, err.Value, sessionContext(_session), err.Stack))
+}
+
+// sessionContext 会话的描述信息，用于日志
+func sessionContext(_session *Session) string {
+	if _session == nil {
+		return "无会话信息"
+	}
+	return fmt.Sprintf("设备: %v, 身份: %v, 对端: %v", _session.DiverId, _session.Identity, _session.RemoteAddr)
+}
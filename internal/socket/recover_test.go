@@ -0,0 +1,60 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	message "tcpsocketv2/pb"
+	"testing"
+)
+
+func TestDispatchRecoversPanic(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	Register(r, message.CommandType_CommandType_TaskOutput, func(ctx context.Context, session *Session, payload *message.MSG_TASK_OUTPUT) error {
+		var missing *message.MSG_HEARTBEAT
+		calls = append(calls, "panic "+*missing.Os)
+		return nil
+	})
+
+	// 处理函数的 panic 转换为 PanicError，携带发生 panic 时的调用栈
+	err := r.dispatch(context.Background(), message.CommandType_CommandType_TaskOutput, &Session{}, &message.MSG_TASK_OUTPUT{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("err = %v, want *PanicError", err)
+	}
+	if !strings.Contains(panicErr.Error(), "nil pointer") || !strings.Contains(string(panicErr.Stack), "TestDispatchRecoversPanic") {
+		t.Fatalf("panic error = %v, stack:\n%s", panicErr, panicErr.Stack)
+	}
+
+	// 其他处理函数不受影响
+	if err = r.dispatch(context.Background(), message.CommandType_CommandType_Heartbeat, &Session{}, heartbeat("linux")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"handler linux"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestDispatchRecoversInterceptorPanic(t *testing.T) {
+	var calls []string
+	r := heartbeatRegistry(&calls)
+	r.Use(func(ctx context.Context, call *Call, next Invoker) error {
+		if call.Command == message.CommandType_CommandType_TaskOutput {
+			panic("interceptor panic")
+		}
+		return next(ctx, call)
+	})
+	err := r.dispatch(context.Background(), message.CommandType_CommandType_TaskOutput, &Session{}, &message.MSG_TASK_OUTPUT{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "interceptor panic" {
+		t.Fatalf("err = %v, want interceptor panic", err)
+	}
+	if err = r.dispatch(context.Background(), message.CommandType_CommandType_Heartbeat, &Session{}, heartbeat("linux")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"handler linux"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
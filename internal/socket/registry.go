@@ -0,0 +1,130 @@
+package socket
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// HandlerFunc 指令处理函数，session 为消息所属会话的副本，修改会话需通过 SessionManager；
+// 服务端尚未握手的连接和客户端没有会话，此时只包含连接、上下文和对端地址
+type HandlerFunc[T proto.Message] func(ctx context.Context, session *Session, payload T) error
+
+// handlerFunc 擦除消息体类型后的处理函数
+type handlerFunc func(ctx context.Context, session *Session, payload proto.Message) error
+
+// Registry 指令注册表，记录每个指令的处理函数和消息拦截器，服务端和客户端各自持有一份
+type Registry struct {
+	mu           sync.RWMutex
+	handlers     map[message.CommandType]handlerFunc
+	interceptors []Interceptor
+	chain        Invoker // 拦截器和处理函数组成的调用链
+}
+
+// NewRegistry 创建指令注册表
+func NewRegistry() *Registry {
+	r := &Registry{handlers: make(map[message.CommandType]handlerFunc)}
+	r.chain = r.invoke
+	return r
+}
+
+// Register 注册指令的消息体类型和处理函数，新增指令只需注册一次，重复注册时覆盖原有的处理函数
+func Register[T proto.Message](r *Registry, command message.CommandType, handler HandlerFunc[T]) {
+	var prototype T
+	serializer.RegisterPayload(command, prototype)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[command] = func(ctx context.Context, session *Session, payload proto.Message) error {
+		typed, ok := payload.(T)
+		if !ok {
+			return fmt.Errorf("指令 %v 的消息体类型错误: %T", command, payload)
+		}
+		return handler(ctx, session, typed)
+	}
+}
+
+// Unregister 取消注册指令，之后收到该指令时按未知指令处理
+func (r *Registry) Unregister(command message.CommandType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, command)
+}
+
+// dispatch 依次经过拦截器后调用指令的处理函数，指令未注册时返回 serializer.ErrUnknownCommand，
+// 拦截器或处理函数发生 panic 时返回 *PanicError
+func (r *Registry) dispatch(ctx context.Context, command message.CommandType, session *Session, payload proto.Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(p)
+		}
+	}()
+	r.mu.RLock()
+	chain := r.chain
+	r.mu.RUnlock()
+	return chain(ctx, &Call{
+		Command:   command,
+		Payload:   payload,
+		Session:   session,
+		RequestId: RequestIdFromCtx(ctx),
+		Received:  time.Now(),
+	})
+}
+
+// invoke 调用链的末端，调用指令的处理函数
+func (r *Registry) invoke(ctx context.Context, call *Call) error {
+	r.mu.RLock()
+	handler, ok := r.handlers[call.Command]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %v", serializer.ErrUnknownCommand, call.Command)
+	}
+	return handler(ctx, call.Session, call.Payload)
+}
+
+// writeError 回复错误消息，对端据此得知出错的指令和原因；出错的消息是同步调用时作为该调用的回复
+func writeError(conn net.Conn, ctx context.Context, code enums.ResponseCode, command message.CommandType, reason string) error {
+	_code := int32(code)
+	pkg, err := serializer.CodecFromCtx(ctx).SerializeEnvelope(
+		message.CommandType_CommandType_Error,
+		&message.MSG_ERROR{
+			Code:    &_code,
+			Message: &reason,
+			Command: command.Enum(),
+		},
+		serializer.Envelope{ReplyTo: RequestIdFromCtx(ctx)},
+	)
+	if err != nil {
+		return fmt.Errorf("序列化错误消息异常: %v", err)
+	}
+	if _, err = conn.Write(pkg); err != nil {
+		return fmt.Errorf("发送错误消息失败: %v", err)
+	}
+	return nil
+}
+
+// replyUnknownCommand 收到未注册的指令时回复错误，连接继续处理后续消息
+func replyUnknownCommand(conn net.Conn, ctx context.Context, command message.CommandType) {
+	l := logger.FromCtx(ctx)
+	l.Warn(fmt.Sprintf("收到未知指令: %v, 对端: %v", command, conn.RemoteAddr()))
+	// 错误消息本身出错时不再回复，避免双方互相回复
+	if command == message.CommandType_CommandType_Error {
+		return
+	}
+	if err := writeError(conn, ctx, enums.ResponseCode_UnknownCommand, command, fmt.Sprintf("未知指令: %v", command)); err != nil {
+		l.Error(err.Error())
+	}
+}
+
+// handleError 收到对端的错误回复
+func handleError(ctx context.Context, session *Session, payload *message.MSG_ERROR) error {
+	l := logger.FromCtx(ctx)
+	l.Warn(fmt.Sprintf("对端返回错误, 错误码: %v, 指令: %v, 错误信息: %v, 对端: %v", payload.GetCode(), payload.GetCommand(), payload.GetMessage(), session.RemoteAddr))
+	return nil
+}
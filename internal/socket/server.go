@@ -3,205 +3,625 @@ package socket
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"google.golang.org/protobuf/proto"
 	"io"
+	"math/rand"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"tcpsocketv2/common/enums"
 	"tcpsocketv2/common/logger"
 	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
+	"tcpsocketv2/internal/protocol"
 	"tcpsocketv2/internal/serializer"
 	message "tcpsocketv2/pb"
 	"tcpsocketv2/pkg/utils"
 	"time"
 )
 
-// Spec 客户端硬件信息
-type Spec struct {
-	Os  string
-	Cpu float64
-	Mem float64
+// ServMsgHandlerInterface 接口：将各指令的处理函数注册到服务端的指令注册表
+type ServMsgHandlerInterface interface {
+	RegisterCommands(registry *Registry)
 }
 
-// Session 会话信息
-type Session struct {
-	DiverId       string          // 设备ID
-	LastAliveTime int64           //  最后活跃时间
-	ClientSpec    Spec            // 客户端硬件信息
-	Ctx           context.Context // 会话上下文
-}
+// ErrServerClosed 服务端已关闭，Serve 在 Shutdown 之后返回该错误
+var ErrServerClosed = errors.New("server closed")
 
-// ServMsgHandlerInterface 接口：处理消息
-type ServMsgHandlerInterface interface {
-	HandleHandshakeReq(conn net.Conn, payload *message.MSG_HANDSHAKE_REQ, ctx context.Context) error
-	HandleHeartbeatReq(conn net.Conn, payload *message.MSG_HEARTBEAT) error
+// ErrNotHandshaken 连接尚未完成握手就发送了握手阶段以外的指令，服务端回复错误后关闭连接
+var ErrNotHandshaken = errors.New("command not allowed before handshake")
+
+// handshakeCommands 握手完成前允许处理的指令
+var handshakeCommands = map[message.CommandType]bool{
+	message.CommandType_CommandType_HandShakeReq: true,
+	message.CommandType_CommandType_AuthResp:     true,
+	message.CommandType_CommandType_Goodbye:      true,
+	message.CommandType_CommandType_Error:        true,
 }
 
 // Server TCP 服务器
 type Server struct {
-	Address    string                  // 监听地址
-	Port       int                     // 监听端口
-	SessionMap map[net.Conn]Session    // 会话连接池
-	Handler    ServMsgHandlerInterface // 消息处理器
+	Address       string             // 监听地址
+	Port          int                // 监听端口
+	Sessions      *SessionManager    // 会话管理器
+	Commands      *Registry          // 指令注册表
+	Authenticator auth.Authenticator // 握手认证器，为空时不做认证
+	Metrics       *Metrics           // 运行指标
+
+	ctx         context.Context    // 服务端生命周期的上下文，关闭时取消，所有连接和心跳检测协程由此派生
+	cancel      context.CancelFunc // 取消服务端上下文
+	mu          sync.Mutex
+	listener    net.Listener
+	tcpListener *net.TCPListener           // TLS包装前的监听socket，热升级时移交给新进程
+	conns       map[net.Conn]*connInfo     // 所有连接，包括尚未握手的连接
+	pending     int                        // 尚未完成握手的连接数
+	admitted    int                        // 计入连接数限制的连接数
+	ipConns     map[string]int             // 每个来源IP计入连接数限制的连接数
+	limiter     *tokenBucket               // 接受新连接的速率限制
+	acl         atomic.Pointer[accessList] // 来源IP访问控制列表，随配置热重载
+	closing     bool                       // 服务端正在关闭，不再接受新连接
+	upgrading   bool                       // 正在热升级
+	connWg      sync.WaitGroup             // 连接处理协程
+	bgWg        sync.WaitGroup             // 时间轮等后台协程
+	heartbeats  *TimingWheel[net.Conn]     // 心跳检测时间轮
+	done        chan struct{}              // 关闭完成后关闭
+	shutdownErr error                      // 关闭结果
 }
 
-// NewServer 创建并返回一个Server实例，并初始化SessionMap
+// NewServer 创建并返回一个Server实例，并初始化会话管理器
 func NewServer(address string, port int) *Server {
-	return &Server{
-		Address:    address,
-		Port:       port,
-		SessionMap: make(map[net.Conn]Session), // 使用make函数初始化map
-		Handler:    nil,
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := config.Get()
+	s := &Server{
+		Address:  address,
+		Port:     port,
+		Sessions: NewSessionManager(),
+		Commands: NewRegistry(),
+		Metrics:  &Metrics{},
+		ctx:      ctx,
+		cancel:   cancel,
+		conns:    make(map[net.Conn]*connInfo),
+		ipConns:  make(map[string]int),
+		limiter:  newTokenBucket(cfg.Limit.AcceptRate, cfg.Limit.AcceptBurst),
+		done:     make(chan struct{}),
 	}
+	// 时间轮的精度为心跳检测间隔
+	s.heartbeats = NewTimingWheel(cfg.Msg.HeartbeatCheckTime*time.Second, s.checkHeartbeat)
+	// 内置指令
+	Register(s.Commands, message.CommandType_CommandType_Goodbye, s.handleGoodbye)
+	Register(s.Commands, message.CommandType_CommandType_Error, handleError)
+	// 配置已经过校验，这里不会失败
+	if acl, err := newAccessList(cfg.ACL); err == nil {
+		s.acl.Store(acl)
+	}
+	return s
 }
 
 // RegisterHandler 注册消息处理器
 func (s *Server) RegisterHandler(handler ServMsgHandlerInterface) {
-	s.Handler = handler
+	handler.RegisterCommands(s.Commands)
+}
+
+// SetAuthenticator 设置握手认证器
+func (s *Server) SetAuthenticator(authenticator auth.Authenticator) {
+	s.Authenticator = authenticator
 }
 
 // GetSession 获取指定连接的Session信息
 func (s *Server) GetSession(conn net.Conn) (Session, bool) {
-	_session, ok := s.SessionMap[conn]
-	return _session, ok
+	return s.Sessions.Get(conn)
 }
 
 // UpdateSession 更新Session信息
 func (s *Server) UpdateSession(conn net.Conn, _session Session) {
-	s.SessionMap[conn] = _session
+	s.Sessions.Update(conn, _session)
+}
+
+// Addr 服务端实际监听的地址，端口为0时可由此获取分配的端口，尚未开始监听时返回 nil
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
 }
 
-// ListenAndServe 启动TCP服务器并开始监听
+// ListenAndServe 启动TCP服务器并开始监听，直到调用 Shutdown
 func (s *Server) ListenAndServe() error {
+	return s.Serve(context.Background())
+}
+
+// Serve 启动TCP服务器并开始监听，ctx 取消后在 srvInfo.shutdown_timeout 内优雅关闭服务端，
+// 由热升级启动的新进程直接使用旧进程移交的监听socket
+func (s *Server) Serve(ctx context.Context) error {
 	l := logger.Get()
-	server := fmt.Sprintf("%s:%d", s.Address, s.Port)
-	listener, err := net.Listen("tcp", server)
+	cfg := config.Get()
+	server := net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+	listener, inherited, err := inheritedListener()
 	if err != nil {
-		return fmt.Errorf("Start TCP Server on %v Failed\nerr: %v", server, err)
+		return fmt.Errorf("Inherit Listener Failed\nerr: %v", err)
 	}
-	l.Info(fmt.Sprintf("Server Listening: %s ", server))
-	defer func() {
-		err := listener.Close()
+	if !inherited {
+		listener, err = net.Listen("tcp", server)
 		if err != nil {
-			l.Error(fmt.Sprintf("Listen Close Error: %v\n", err))
+			return fmt.Errorf("Start TCP Server on %v Failed\nerr: %v", server, err)
+		}
+	}
+	tcpListener, _ := listener.(*net.TCPListener)
+	// 启用TLS时包装监听器，证书随配置热重载
+	if cfg.TLS.Enable {
+		loader, tlsErr := newTLSLoader(cfg.TLS)
+		if tlsErr != nil {
+			_ = listener.Close()
+			return fmt.Errorf("Start TLS Server on %v Failed\nerr: %v", server, tlsErr)
+		}
+		// 服务端停止后不再重新加载证书
+		unregisterTLS := config.OnReload(func(newCfg *config.Config) {
+			if reloadErr := loader.reload(newCfg.TLS); reloadErr != nil {
+				l.Error(fmt.Sprintf("重新加载TLS证书失败，继续使用原有证书: %v", reloadErr))
+				return
+			}
+			l.Info("TLS证书重新加载成功")
+		})
+		defer unregisterTLS()
+		listener = tls.NewListener(listener, loader.serverConfig())
+	}
+	// 接受新连接的速率和访问控制列表随配置热重载，连接数限制在每次接受连接时读取
+	unregisterLimit := config.OnReload(func(newCfg *config.Config) {
+		s.limiter.setRate(newCfg.Limit.AcceptRate, newCfg.Limit.AcceptBurst)
+		s.reloadACL(newCfg.ACL)
+	})
+	defer unregisterLimit()
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.tcpListener = tcpListener
+	s.mu.Unlock()
+	l.Info(fmt.Sprintf("Server Listening: %s, TLS: %v, Inherited: %v", server, cfg.TLS.Enable, inherited))
+	// 启动心跳检测时间轮，服务端关闭时停止
+	s.bgWg.Add(1)
+	go func() {
+		defer s.bgWg.Done()
+		s.heartbeats.Run(s.ctx)
+	}()
+	// 通知发起热升级的旧进程可以退出了
+	if err = notifyUpgradeReady(); err != nil {
+		l.Error(fmt.Sprintf("通知旧进程热升级完成失败: %v", err))
+	}
+
+	// ctx 取消时优雅关闭，已经开始关闭时等待其结束后再返回
+	shutdownDone := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(shutdownDone)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Get().SrvInfo.ShutdownTimeout*time.Second)
+		defer cancel()
+		_ = s.Shutdown(shutdownCtx)
+	})
+	defer func() {
+		if !stop() {
+			<-shutdownDone
 		}
 	}()
 
 	for {
 		conn, acceptErr := listener.Accept()
 		if acceptErr != nil {
+			// 等待关闭完成后再返回，调用方可以直接退出进程
+			if s.isClosing() {
+				<-s.done
+				if ctx.Err() != nil {
+					return s.shutdownErr
+				}
+				return ErrServerClosed
+			}
+			if errors.Is(acceptErr, net.ErrClosed) {
+				return acceptErr
+			}
 			l.Error(fmt.Sprintf("Accept Error: %v", acceptErr))
+			time.Sleep(acceptRetryDelay)
 			continue
 		}
 		l.Info(fmt.Sprintf("Accept Client Conn: %v", conn.RemoteAddr()))
 
-		// 启动一个goroutine处理连接
-		go s.handleConnection(conn)
+		// 来源IP不被允许访问的连接直接关闭
+		if !s.acl.Load().permitConn(conn) {
+			s.Metrics.RejectedByACL.Add(1)
+			l.Warn(fmt.Sprintf("来源IP不被允许访问，关闭连接: %v", conn.RemoteAddr()))
+			_ = conn.Close()
+			continue
+		}
+		// 超过接受速率的连接直接关闭，不再为其分配任何资源
+		if !s.limiter.allow() {
+			s.Metrics.RejectedByRate.Add(1)
+			l.Warn(fmt.Sprintf("%v，关闭连接: %v", errAcceptRateLimited, conn.RemoteAddr()))
+			_ = conn.Close()
+			continue
+		}
+		// 所有写入经由连接的写队列发送
+		conn = newQueuedConn(conn, s.Metrics)
+		// 启动一个goroutine处理连接，关闭过程中到达的连接和未握手连接过多时直接关闭
+		rejected, ok := s.trackConn(conn)
+		if !ok {
+			if rejected != nil {
+				l.Warn(fmt.Sprintf("%v，关闭连接: %v", rejected, conn.RemoteAddr()))
+			}
+			_ = conn.Close()
+			continue
+		}
+		go s.handleConnection(conn, rejected)
+	}
+}
+
+// acceptRetryDelay Accept 出现临时错误（如文件描述符耗尽）后的重试间隔
+const acceptRetryDelay = 100 * time.Millisecond
 
+// isClosing 服务端是否正在关闭
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// trackConn 记录新连接并进行准入检查，服务端正在关闭或未握手的连接过多时返回 false，
+// 超过并发连接数限制的连接仍会被处理，返回的拒绝原因在握手时回复给客户端
+func (s *Server) trackConn(conn net.Conn) (rejected error, ok bool) {
+	limit := config.Get().Limit
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return nil, false
+	}
+	if limit.MaxPending > 0 && s.pending >= limit.MaxPending {
+		s.Metrics.RejectedByPending.Add(1)
+		return errTooManyPending, false
+	}
+	info := &connInfo{ip: RemoteIP(conn), pending: true}
+	switch {
+	case limit.MaxConns > 0 && s.admitted >= limit.MaxConns:
+		s.Metrics.RejectedByLimit.Add(1)
+		rejected = errTooManyConns
+	case limit.MaxConnsPerIP > 0 && s.ipConns[info.ip] >= limit.MaxConnsPerIP:
+		s.Metrics.RejectedByIPLimit.Add(1)
+		rejected = errTooManyConnsPerIP
+	default:
+		info.admitted = true
+		s.admitted++
+		s.ipConns[info.ip]++
 	}
+	s.conns[conn] = info
+	s.pending++
+	s.connWg.Add(1)
+	return rejected, true
 }
 
-// handleConnection 处理客户端连接
-func (s *Server) handleConnection(conn net.Conn) {
-	// 初始化上下文，用于传递必要参数
-	ctx, cancel := context.WithCancel(context.Background())
+// handshakeDone 连接完成握手，不再计入未握手连接数
+func (s *Server) handshakeDone(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.conns[conn]; ok && info.pending {
+		info.pending = false
+		s.pending--
+	}
+}
+
+// untrackConn 连接处理结束，释放占用的连接数
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	if info, ok := s.conns[conn]; ok {
+		if info.pending {
+			s.pending--
+		}
+		if info.admitted {
+			s.admitted--
+			s.ipConns[info.ip]--
+			if s.ipConns[info.ip] <= 0 {
+				delete(s.ipConns, info.ip)
+			}
+		}
+		delete(s.conns, conn)
+	}
+	s.mu.Unlock()
+	s.connWg.Done()
+}
+
+// Shutdown 优雅关闭服务端：停止接受新连接，通知已握手的客户端断开并关闭未握手的连接，
+// 等待连接处理协程退出，ctx 到期后强制关闭剩余连接，最后停止所有心跳检测协程
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.shutdown(ctx, enums.GoodbyeCode_Shutdown, "服务端关闭", 0)
+}
+
+// shutdown 优雅关闭服务端，reconnectSpread 大于0时为每个客户端随机分配不超过该值的重连间隔，避免集中重连
+func (s *Server) shutdown(ctx context.Context, code enums.GoodbyeCode, reason string, reconnectSpread time.Duration) error {
+	l := logger.Get()
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.closing = true
+	listener := s.listener
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	l.Info(fmt.Sprintf("Server 开始关闭，当前连接数: %v，会话数: %v", len(conns), s.Sessions.Len()))
+	// 停止接受新连接
+	if listener != nil {
+		if err := listener.Close(); err != nil {
+			l.Error(fmt.Sprintf("Listen Close Error: %v\n", err))
+		}
+	}
+	// 已握手的客户端收到通知后自行断开，未握手的连接直接关闭
+	for _, conn := range conns {
+		if _, ok := s.Sessions.Get(conn); ok {
+			var reconnectAfter time.Duration
+			if reconnectSpread > 0 {
+				reconnectAfter = time.Duration(rand.Int63n(int64(reconnectSpread)))
+			}
+			if err := s.Goodbye(conn, code, reason, reconnectAfter); err != nil {
+				l.Error(fmt.Sprintf("Server, 通知客户端断开连接失败: %v, Client: %v", err, conn.RemoteAddr()))
+				_ = conn.Close()
+			}
+			continue
+		}
+		_ = conn.Close()
+	}
+
+	// 等待连接处理协程退出
+	done := make(chan struct{})
+	go func() {
+		s.connWg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.mu.Lock()
+		l.Warn(fmt.Sprintf("Server 关闭超时，强制关闭剩余的 %v 个连接", len(s.conns)))
+		for conn := range s.conns {
+			_ = forceClose(conn)
+		}
+		s.mu.Unlock()
+		<-done
+	}
+
+	// 停止心跳检测等后台协程
+	s.cancel()
+	s.bgWg.Wait()
+	l.Info("Server 已关闭")
+	s.shutdownErr = err
+	close(s.done)
+	return err
+}
+
+// handleConnection 处理客户端连接，rejected 不为空时客户端握手会被拒绝
+func (s *Server) handleConnection(conn net.Conn, rejected error) {
+	defer s.untrackConn(conn)
+	// 初始化上下文，用于传递必要参数，连接断开或服务端关闭时取消
+	ctx, cancel := context.WithCancel(s.ctx)
 	defer cancel()
 	// 获取日志实例, 并将上下文传递给日志实例
 	l := logger.Get()
 	ctx = logger.WithCtx(ctx, l)
+	// 每个连接独立的编解码器，记录对端使用的帧格式
+	ctx = serializer.WithCodec(ctx, serializer.NewCodec())
+	// 从建立连接开始计算握手超时，握手完成后按空闲超时计算
+	cfg := config.Get()
+	deadline := newReadDeadline(conn, cfg.Msg.HandshakeTimeout*time.Second, cfg.Msg.IdleReadTimeout())
+	ctx = withReadDeadline(ctx, deadline)
+	ctx = withAdmission(ctx, rejected)
+	// 连接断开时等待回复的同步调用立即返回
+	calls := newInflight(s.Metrics)
+	ctx = withInflight(ctx, calls)
+	defer calls.close(ErrConnClosed)
 
 	defer func() {
+		// 连接断开时移除会话和心跳检测定时器
+		s.Sessions.Remove(conn)
+		s.heartbeats.Remove(conn)
 		err := conn.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			l.Error(fmt.Sprintf("Close Client Conn Error: %v\n", err))
 		}
 	}()
-	reader := bufio.NewReader(conn)
+	// 发生 panic 时只关闭当前连接，先于上面的清理执行，日志中还能带上会话信息
+	defer func() {
+		if p := recover(); p != nil {
+			s.Metrics.reportPanic(l, newPanicError(p), "处理连接时", s.sessionOf(conn))
+		}
+	}()
 	clientIp := conn.RemoteAddr().String()
+	// TLS连接先完成握手，便于尽早拒绝证书不合法的客户端
+	if tlsConn, ok := auth.TLSConn(conn); ok {
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				s.Metrics.HandshakeTimeouts.Add(1)
+				l.Warn(fmt.Sprintf("TLS握手超时，关闭连接, Client: %s", clientIp))
+				return
+			}
+			l.Error(fmt.Sprintf("TLS Handshake Error: %v, Client: %s", err, clientIp))
+			return
+		}
+	}
+	reader := bufio.NewReader(conn)
 	for {
+		// 握手完成（已创建会话）后，每次读取前延后空闲超时
+		if deadline.handshaking() {
+			if _, ok := s.Sessions.Get(conn); ok {
+				deadline.established()
+				s.handshakeDone(conn)
+			}
+		}
+		deadline.refresh()
 		// 反序列化消息
-		command, payload, err := serializer.DeserializeMessage(reader, ctx)
+		command, payload, envelope, err := serializer.DeserializeEnvelope(reader, ctx)
 		// 消息结束符则不再继续
 		if err == io.EOF {
 			break
 		}
+		// 同步调用的回复交给等待中的调用，消息体有误时调用方收到错误
+		if envelope.ReplyTo != 0 {
+			handleReply(ctx, command, envelope, payload, err)
+			continue
+		}
+		msgCtx := withRequest(ctx, command, envelope.RequestId)
+		// 未注册的指令回复错误后继续处理后续消息，尚未握手时回复错误后关闭连接
+		if errors.Is(err, serializer.ErrUnknownCommand) {
+			if _, ok := s.Sessions.Get(conn); !ok {
+				_ = s.rejectBeforeHandshake(conn, msgCtx, command)
+				break
+			}
+			replyUnknownCommand(conn, msgCtx, command)
+			continue
+		}
 		// 反序列化失败
 		if err != nil {
+			if errors.Is(err, protocol.ErrChecksum) {
+				s.Metrics.CorruptedFrames.Add(1)
+			}
+			// 校验和错误且策略为丢弃时，只丢弃当前帧
+			if errors.Is(err, protocol.ErrChecksum) && !serializer.IsFatal(err) {
+				l.Warn(fmt.Sprintf("Server 丢弃损坏的消息: %v, Client: %s", err, clientIp))
+				continue
+			}
+			// 读超时，按所处阶段区分原因
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				s.readTimeout(deadline.current(), clientIp)
+				break
+			}
+			// 服务端关闭时主动关闭的连接
+			if errors.Is(err, net.ErrClosed) && s.isClosing() {
+				l.Debug(fmt.Sprintf("Server 关闭连接, Client: %s", clientIp))
+				break
+			}
 			l.Error(fmt.Sprintf("Server DeserializeMessage Error: %v, Client: %s", err, clientIp))
 			break
 		}
 		l.Info(fmt.Sprintf("Server Receive Message: %v, Client: %s", payload, clientIp))
 		// 处理消息
-		handlerErr := s.handleMessage(command, payload, conn, ctx)
+		handlerErr := s.handleMessage(command, payload, conn, msgCtx)
+		if errors.Is(handlerErr, serializer.ErrUnknownCommand) {
+			replyUnknownCommand(conn, msgCtx, command)
+			continue
+		}
 		if handlerErr != nil {
-			l.Error(fmt.Sprintf("Server HandleMessage Error: %v, Client: %s", err, clientIp))
+			l.Error(fmt.Sprintf("Server HandleMessage Error: %v, Client: %s", handlerErr, clientIp))
 			break
 		}
 	}
 }
 
-// handleMessage 处理接收到的消息，根据命令类型调用对应的处理器函数
-func (s *Server) handleMessage(command message.CommandType, payload interface{}, conn net.Conn, ctx context.Context) (err error) {
-	l := logger.FromCtx(ctx)
-	switch command {
-	case message.CommandType_CommandType_HandShakeReq:
-		err = s.Handler.HandleHandshakeReq(conn, payload.(*message.MSG_HANDSHAKE_REQ), ctx)
-	case message.CommandType_CommandType_Heartbeat:
-		err = s.Handler.HandleHeartbeatReq(conn, payload.(*message.MSG_HEARTBEAT))
+// readTimeout 记录读超时的原因
+func (s *Server) readTimeout(phase readPhase, clientIp string) {
+	l := logger.Get()
+	switch phase {
+	case phaseHandshake:
+		s.Metrics.HandshakeTimeouts.Add(1)
+		l.Warn(fmt.Sprintf("握手超时，关闭连接, Client: %s", clientIp))
+	case phaseIdle:
+		s.Metrics.IdleTimeouts.Add(1)
+		l.Warn(fmt.Sprintf("空闲超时，关闭连接, Client: %s", clientIp))
 	default:
-		l.Warn(fmt.Sprintf("收到未知指令: %v\n", command))
+		l.Info(fmt.Sprintf("优雅断开排空超时，关闭连接, Client: %s", clientIp))
 	}
+}
 
-	if err != nil {
+// handleMessage 处理接收到的消息，根据指令注册表调用对应的处理函数
+func (s *Server) handleMessage(command message.CommandType, payload proto.Message, conn net.Conn, ctx context.Context) error {
+	l := logger.FromCtx(ctx)
+	// 尚未握手的连接没有会话，只提供连接信息
+	_session, ok := s.Sessions.Get(conn)
+	if !ok {
+		// 握手完成前只处理握手阶段的指令
+		if !handshakeCommands[command] {
+			return s.rejectBeforeHandshake(conn, ctx, command)
+		}
+		_session = Session{Ctx: ctx, Conn: conn, RemoteAddr: conn.RemoteAddr().String()}
+	}
+	err := s.Commands.dispatch(ctx, command, &_session, payload)
+	var panicErr *PanicError
+	switch {
+	case err == nil, errors.Is(err, serializer.ErrUnknownCommand):
+	case errors.As(err, &panicErr):
+		s.Metrics.reportPanic(l, panicErr, fmt.Sprintf("处理指令 %v 时", command), &_session)
+	default:
 		l.Error(fmt.Sprintf("Server, 处理消息异常: %v\n", err))
 	}
 	return err
 }
 
-// StartHeartbeatChecker 启动心跳检查协程
-func (s *Server) StartHeartbeatChecker(conn net.Conn) {
-	ctx := s.SessionMap[conn].Ctx
+// rejectBeforeHandshake 拒绝握手完成前发送的指令，回复错误并返回 ErrNotHandshaken，由调用方关闭连接
+func (s *Server) rejectBeforeHandshake(conn net.Conn, ctx context.Context, command message.CommandType) error {
 	l := logger.FromCtx(ctx)
-	// 获取停止通道用于管理心跳协程生命周期
-	checkHeartbeat(s, conn)
-	// 可以在这里记录日志或添加清理逻辑
-	l.Debug(fmt.Sprintf("Heartbeat checker started for client: %v", conn.RemoteAddr()))
+	l.Warn(fmt.Sprintf("客户端: %v, 握手完成前发送指令: %v, 关闭连接", conn.RemoteAddr(), command))
+	if err := writeError(conn, ctx, enums.ResponseCode_NotHandshaken, command, fmt.Sprintf("握手完成前不允许发送指令: %v", command)); err != nil {
+		l.Error(err.Error())
+	}
+	return fmt.Errorf("%w: %v", ErrNotHandshaken, command)
 }
 
-// checkHeartbeat 检测心跳
-func checkHeartbeat(s *Server, conn net.Conn) (stopC chan bool) {
+// sessionOf 获取连接的会话，尚未握手时返回 nil
+func (s *Server) sessionOf(conn net.Conn) *Session {
+	if _session, ok := s.Sessions.Get(conn); ok {
+		return &_session
+	}
+	return nil
+}
+
+// StartHeartbeatChecker 开始检测连接的心跳，由时间轮统一调度，不再为每个连接启动协程
+func (s *Server) StartHeartbeatChecker(conn net.Conn) {
 	cfg := config.Get()
-	ctx := s.SessionMap[conn].Ctx
-	l := logger.FromCtx(ctx)
-	ticker := time.NewTicker(cfg.Msg.HeartbeatCheckTime * time.Second)
-	stopC = make(chan bool)
-	go func() {
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				_session, ok := s.SessionMap[conn]
-				if !ok {
-					l.Error("客户端会话不存在，停止心跳检测")
-					return
-				}
-				// 检查心跳超时
-				current := utils.GetCurrentTimestamp()
-				interval := current - _session.LastAliveTime
-				if interval > cfg.Msg.HeartbeatTimeout {
-					l.Error(fmt.Sprintf("客户端: %v, 心跳超时，关闭连接", conn.RemoteAddr()))
-					delete(s.SessionMap, conn)
-					err := conn.Close()
-					if err != nil {
-						l.Error(fmt.Sprintf("Server, 关闭连接异常: %v\n", err))
-					}
-					return
-				} else {
-					l.Debug(fmt.Sprintf("客户端: %v, 心跳正常", conn.RemoteAddr()))
-				}
-			case <-stopC:
-				l.Warn("停止心跳检查")
-				return
-			}
+	_session, _ := s.Sessions.Get(conn)
+	l := logger.FromCtx(_session.Ctx)
+	s.heartbeats.Add(conn, time.Duration(cfg.Msg.HeartbeatTimeout)*time.Second)
+	l.Debug(fmt.Sprintf("Heartbeat checker started for client: %v", conn.RemoteAddr()))
+}
+
+// checkHeartbeat 心跳检测定时器到期，距上次心跳已超时则关闭连接，否则按剩余时间重新调度
+func (s *Server) checkHeartbeat(conn net.Conn) {
+	// 在时间轮协程中执行，不能阻塞；发生 panic 时只关闭该连接，不影响其他连接的心跳检测
+	defer func() {
+		if p := recover(); p != nil {
+			s.Metrics.reportPanic(logger.Get(), newPanicError(p), "心跳检测时", s.sessionOf(conn))
+			go forceClose(conn)
 		}
 	}()
-	return stopC
+	cfg := config.Get()
+	_session, ok := s.Sessions.Get(conn)
+	if !ok {
+		return
+	}
+	l := logger.FromCtx(_session.Ctx)
+	// 检查心跳超时
+	current := utils.GetCurrentTimestamp()
+	interval := current - _session.LastAliveTime
+	if interval > cfg.Msg.HeartbeatTimeout {
+		l.Error(fmt.Sprintf("客户端: %v, 心跳超时，关闭连接", conn.RemoteAddr()))
+		s.Sessions.Remove(conn)
+		// 心跳超时的连接多半已经写不出数据，不等待写队列排空；关闭TLS连接时发送 close_notify 也可能阻塞，
+		// 在新协程中关闭，避免阻塞时间轮中其他连接的检测
+		go func() {
+			if err := forceClose(conn); err != nil && !errors.Is(err, net.ErrClosed) {
+				l.Error(fmt.Sprintf("Server, 关闭连接异常: %v\n", err))
+			}
+		}()
+		return
+	}
+	l.Debug(fmt.Sprintf("客户端: %v, 心跳正常", conn.RemoteAddr()))
+	// 超时时间比实际剩余时间多1秒，保证再次到期时已超过 HeartbeatTimeout
+	s.heartbeats.Add(conn, time.Duration(cfg.Msg.HeartbeatTimeout-interval+1)*time.Second)
 }
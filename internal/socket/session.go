@@ -0,0 +1,234 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"tcpsocketv2/internal/serializer"
+)
+
+// Spec 客户端硬件信息
+type Spec struct {
+	Os  string
+	Cpu float64
+	Mem float64
+}
+
+// Session 会话信息
+type Session struct {
+	DiverId       string            // 设备ID
+	LastAliveTime int64             //  最后活跃时间
+	ClientSpec    Spec              // 客户端硬件信息
+	Ctx           context.Context   // 会话上下文
+	Identity      string            // 认证后的身份
+	Roles         []string          // 认证后的角色，用于后续鉴权
+	Labels        map[string]string // 认证后的标签
+	Features      []string          // 握手时协商启用的协议特性
+	Conn          net.Conn          // 客户端连接，加入会话管理器时自动设置
+	RemoteAddr    string            // 客户端地址，加入会话管理器时自动设置
+}
+
+// CorruptedFrames 会话所属连接上校验和不匹配的帧数
+func (s Session) CorruptedFrames() int64 {
+	if s.Ctx == nil {
+		return 0
+	}
+	return serializer.CodecFromCtx(s.Ctx).CorruptedFrames()
+}
+
+// SessionEvent 会话生命周期事件
+type SessionEvent int
+
+const (
+	SessionAdded   SessionEvent = iota // 会话创建
+	SessionUpdated                     // 会话更新
+	SessionRemoved                     // 会话移除
+)
+
+// SessionCallback 会话生命周期回调，在会话管理器的锁之外执行
+type SessionCallback func(event SessionEvent, session Session)
+
+// SessionManager 并发安全的会话管理器，支持按连接、设备ID和客户端地址查询
+type SessionManager struct {
+	mu       sync.RWMutex
+	sessions map[net.Conn]Session  // 会话连接池
+	byDevice map[string][]net.Conn // 设备ID索引，同一设备的连接按加入顺序排列，查询时返回最新的连接
+	byAddr   map[string]net.Conn   // 客户端地址索引
+
+	callbackMu sync.RWMutex
+	callbacks  []SessionCallback
+}
+
+// NewSessionManager 创建会话管理器
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions: make(map[net.Conn]Session),
+		byDevice: make(map[string][]net.Conn),
+		byAddr:   make(map[string]net.Conn),
+	}
+}
+
+// OnEvent 注册会话生命周期回调
+func (m *SessionManager) OnEvent(callback SessionCallback) {
+	m.callbackMu.Lock()
+	defer m.callbackMu.Unlock()
+	m.callbacks = append(m.callbacks, callback)
+}
+
+// emit 触发会话生命周期回调
+func (m *SessionManager) emit(event SessionEvent, session Session) {
+	m.callbackMu.RLock()
+	callbacks := m.callbacks
+	m.callbackMu.RUnlock()
+	for _, callback := range callbacks {
+		callback(event, session)
+	}
+}
+
+// Add 添加会话，连接已存在时覆盖原有会话
+func (m *SessionManager) Add(conn net.Conn, session Session) {
+	session.Conn = conn
+	session.RemoteAddr = conn.RemoteAddr().String()
+	m.mu.Lock()
+	if old, ok := m.sessions[conn]; ok {
+		m.unindex(old)
+	}
+	m.sessions[conn] = session
+	m.index(session)
+	m.mu.Unlock()
+	m.emit(SessionAdded, session)
+}
+
+// Get 获取指定连接的会话
+func (m *SessionManager) Get(conn net.Conn) (Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[conn]
+	return session, ok
+}
+
+// GetByDevice 根据设备ID获取会话，同一设备存在多个连接时返回最新的连接，最新的连接断开后返回剩余连接中最新的一个
+func (m *SessionManager) GetByDevice(deviceId string) (Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conns := m.byDevice[deviceId]
+	if len(conns) == 0 {
+		return Session{}, false
+	}
+	return m.sessions[conns[len(conns)-1]], true
+}
+
+// GetByAddr 根据客户端地址获取会话
+func (m *SessionManager) GetByAddr(addr string) (Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conn, ok := m.byAddr[addr]
+	if !ok {
+		return Session{}, false
+	}
+	return m.sessions[conn], true
+}
+
+// Update 更新会话，会话不存在时返回 false
+func (m *SessionManager) Update(conn net.Conn, session Session) bool {
+	_, ok := m.Modify(conn, func(s *Session) {
+		*s = session
+	})
+	return ok
+}
+
+// Modify 在锁内读取并修改会话，保证并发修改不会相互覆盖，返回修改后的会话
+func (m *SessionManager) Modify(conn net.Conn, modify func(session *Session)) (Session, bool) {
+	session, ok := m.modify(conn, modify)
+	if ok {
+		m.emit(SessionUpdated, session)
+	}
+	return session, ok
+}
+
+// modify 加锁修改会话，修改函数异常时也能释放锁
+func (m *SessionManager) modify(conn net.Conn, modify func(session *Session)) (Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[conn]
+	if !ok {
+		return Session{}, false
+	}
+	updated := session
+	modify(&updated)
+	updated.Conn = conn
+	updated.RemoteAddr = session.RemoteAddr
+	m.sessions[conn] = updated
+	// 设备ID不变时保持连接在设备索引中的顺序，心跳等更新不会改变最新的连接
+	if updated.DiverId != session.DiverId {
+		m.unindex(session)
+		m.index(updated)
+	}
+	return updated, true
+}
+
+// Remove 移除会话，返回被移除的会话
+func (m *SessionManager) Remove(conn net.Conn) (Session, bool) {
+	m.mu.Lock()
+	session, ok := m.sessions[conn]
+	if ok {
+		delete(m.sessions, conn)
+		m.unindex(session)
+	}
+	m.mu.Unlock()
+	if ok {
+		m.emit(SessionRemoved, session)
+	}
+	return session, ok
+}
+
+// Len 当前会话数量
+func (m *SessionManager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// Snapshot 获取所有会话的快照，快照与会话管理器之后的修改互不影响
+func (m *SessionManager) Snapshot() []Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Range 遍历会话快照，回调返回 false 时停止遍历，回调中可以安全地修改会话管理器
+func (m *SessionManager) Range(fn func(session Session) bool) {
+	for _, session := range m.Snapshot() {
+		if !fn(session) {
+			return
+		}
+	}
+}
+
+// index 建立二级索引，调用方需持有写锁
+func (m *SessionManager) index(session Session) {
+	if session.DiverId != "" {
+		m.byDevice[session.DiverId] = append(m.byDevice[session.DiverId], session.Conn)
+	}
+	m.byAddr[session.RemoteAddr] = session.Conn
+}
+
+// unindex 删除二级索引，设备的其他连接仍保留在索引中，调用方需持有写锁
+func (m *SessionManager) unindex(session Session) {
+	conns := slices.DeleteFunc(m.byDevice[session.DiverId], func(conn net.Conn) bool {
+		return conn == session.Conn
+	})
+	if len(conns) == 0 {
+		delete(m.byDevice, session.DiverId)
+	} else {
+		m.byDevice[session.DiverId] = conns
+	}
+	if conn, ok := m.byAddr[session.RemoteAddr]; ok && conn == session.Conn {
+		delete(m.byAddr, session.RemoteAddr)
+	}
+}
@@ -0,0 +1,164 @@
+package socket
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeConn 只提供客户端地址的测试连接
+type fakeConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// newFakeConn 创建指定端口的测试连接
+func newFakeConn(port int) net.Conn {
+	return &fakeConn{addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port}}
+}
+
+func TestSessionIndex(t *testing.T) {
+	m := NewSessionManager()
+	first, second, third := newFakeConn(1), newFakeConn(2), newFakeConn(3)
+	m.Add(first, Session{DiverId: "device-1"})
+	m.Add(second, Session{DiverId: "device-1"})
+	m.Add(third, Session{DiverId: "device-2"})
+
+	if _session, ok := m.GetByDevice("device-1"); !ok || _session.Conn != second {
+		t.Fatalf("GetByDevice = %v, %v, want newest conn", _session.RemoteAddr, ok)
+	}
+	if _session, ok := m.GetByAddr(first.RemoteAddr().String()); !ok || _session.Conn != first {
+		t.Fatalf("GetByAddr = %v, %v", _session.RemoteAddr, ok)
+	}
+
+	// 更新旧连接的心跳不改变最新的连接
+	m.Modify(first, func(s *Session) { s.LastAliveTime = 100 })
+	if _session, _ := m.GetByDevice("device-1"); _session.Conn != second {
+		t.Fatalf("GetByDevice after modify = %v, want newest conn", _session.RemoteAddr)
+	}
+
+	// 最新的连接断开后回退到设备的其他连接
+	m.Remove(second)
+	if _session, ok := m.GetByDevice("device-1"); !ok || _session.Conn != first || _session.LastAliveTime != 100 {
+		t.Fatalf("GetByDevice after remove = %v, %v, want remaining conn", _session.RemoteAddr, ok)
+	}
+	if _, ok := m.GetByAddr(second.RemoteAddr().String()); ok {
+		t.Fatal("removed conn still indexed by addr")
+	}
+	m.Remove(first)
+	if _, ok := m.GetByDevice("device-1"); ok {
+		t.Fatal("device still indexed after all conns removed")
+	}
+
+	// 修改设备ID时迁移索引
+	m.Modify(third, func(s *Session) { s.DiverId = "device-3" })
+	if _, ok := m.GetByDevice("device-2"); ok {
+		t.Fatal("old device id still indexed")
+	}
+	if _session, ok := m.GetByDevice("device-3"); !ok || _session.Conn != third {
+		t.Fatalf("GetByDevice(device-3) = %v, %v", _session.RemoteAddr, ok)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("Len = %v, want 1", m.Len())
+	}
+}
+
+func TestSessionCallbacks(t *testing.T) {
+	m := NewSessionManager()
+	var events []SessionEvent
+	m.OnEvent(func(event SessionEvent, _session Session) {
+		// 回调在锁外执行，可以再次访问会话管理器
+		if _, ok := m.Get(_session.Conn); ok != (event != SessionRemoved) {
+			t.Errorf("event %v: session present = %v", event, ok)
+		}
+		events = append(events, event)
+	})
+	conn := newFakeConn(1)
+	m.Add(conn, Session{DiverId: "device-1"})
+	m.Update(conn, Session{DiverId: "device-1", LastAliveTime: 1})
+	m.Remove(conn)
+	// 会话不存在时不触发回调
+	m.Update(conn, Session{})
+	m.Remove(conn)
+	want := []SessionEvent{SessionAdded, SessionUpdated, SessionRemoved}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+}
+
+func TestSessionConcurrent(t *testing.T) {
+	const (
+		devices = 8
+		workers = 16
+		rounds  = 200
+	)
+	m := NewSessionManager()
+	var added, removed atomic.Int64
+	m.OnEvent(func(event SessionEvent, _session Session) {
+		switch event {
+		case SessionAdded:
+			added.Add(1)
+		case SessionRemoved:
+			removed.Add(1)
+		}
+		// 回调中查询会话管理器不会死锁
+		m.GetByDevice(_session.DiverId)
+	})
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				conn := newFakeConn(w*rounds + i + 1)
+				deviceId := fmt.Sprintf("device-%d", (w+i)%devices)
+				m.Add(conn, Session{DiverId: deviceId})
+				m.Modify(conn, func(s *Session) { s.LastAliveTime++ })
+				if _session, ok := m.GetByDevice(deviceId); ok && _session.DiverId != deviceId {
+					t.Errorf("GetByDevice(%v) returned %v", deviceId, _session.DiverId)
+				}
+				if _session, ok := m.GetByAddr(conn.RemoteAddr().String()); !ok || _session.Conn != conn {
+					t.Errorf("GetByAddr(%v) = %v", conn.RemoteAddr(), ok)
+				}
+				m.Range(func(Session) bool { return true })
+				// 保留每个协程的最后一个连接
+				if i < rounds-1 {
+					m.Remove(conn)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if m.Len() != workers {
+		t.Fatalf("Len = %v, want %v", m.Len(), workers)
+	}
+	if added.Load() != workers*rounds || removed.Load() != workers*(rounds-1) {
+		t.Fatalf("added = %v, removed = %v", added.Load(), removed.Load())
+	}
+	// 剩余的每个会话都能通过设备ID和地址查到，索引中没有残留的连接
+	for _, _session := range m.Snapshot() {
+		if _, ok := m.GetByDevice(_session.DiverId); !ok {
+			t.Fatalf("device %v not indexed", _session.DiverId)
+		}
+		if _, ok := m.GetByAddr(_session.RemoteAddr); !ok {
+			t.Fatalf("addr %v not indexed", _session.RemoteAddr)
+		}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	indexed := 0
+	for _, conns := range m.byDevice {
+		indexed += len(conns)
+	}
+	if indexed != workers || len(m.byAddr) != workers {
+		t.Fatalf("indexed devices = %v, addrs = %v, want %v", indexed, len(m.byAddr), workers)
+	}
+}
@@ -0,0 +1,198 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"time"
+)
+
+// ErrIllegalTransition 非法的客户端状态转换
+var ErrIllegalTransition = errors.New("illegal client state transition")
+
+// maxStateHistory 保留的状态转换记录条数
+const maxStateHistory = 32
+
+// legalTransitions 合法的客户端状态转换
+//
+//	Waiting -> Connecting -> Connected -> DisConnected -> Waiting
+//	                \-> DisConnected / Error        \-> Connecting（立即重连或切换服务端）
+//	Error -> Waiting / Connecting
+var legalTransitions = map[enums.ClientStatusEM][]enums.ClientStatusEM{
+	enums.ClientStatusWaiting:      {enums.ClientStatusConnecting},
+	enums.ClientStatusConnecting:   {enums.ClientStatusConnected, enums.ClientStatusDisConnected, enums.ClientStatusError},
+	enums.ClientStatusConnected:    {enums.ClientStatusDisConnected, enums.ClientStatusError},
+	enums.ClientStatusDisConnected: {enums.ClientStatusWaiting, enums.ClientStatusConnecting, enums.ClientStatusError},
+	enums.ClientStatusError:        {enums.ClientStatusWaiting, enums.ClientStatusConnecting},
+}
+
+// StateTransition 一次客户端状态转换
+type StateTransition struct {
+	From   enums.ClientStatusEM
+	To     enums.ClientStatusEM
+	Reason string
+	At     time.Time
+}
+
+// StateListener 客户端状态变更监听器
+type StateListener func(transition StateTransition)
+
+// stateMachine 客户端连接状态机，只允许合法的状态转换
+type stateMachine struct {
+	mu        sync.Mutex
+	state     enums.ClientStatusEM
+	history   []StateTransition
+	listeners []StateListener
+	waiters   []stateWaiter
+	pending   []StateTransition // 等待通知监听器的状态转换
+	notifying bool              // 是否有协程正在通知监听器
+}
+
+// stateWaiter 等待进入指定状态的调用方，进入该状态时关闭 ch
+type stateWaiter struct {
+	state enums.ClientStatusEM
+	ch    chan struct{}
+}
+
+// newStateMachine 创建状态机
+func newStateMachine(initial enums.ClientStatusEM) *stateMachine {
+	return &stateMachine{state: initial}
+}
+
+// canTransition 判断状态转换是否合法
+func canTransition(from, to enums.ClientStatusEM) bool {
+	for _, state := range legalTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// current 当前状态
+func (m *stateMachine) current() enums.ClientStatusEM {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// transition 转换到新状态，状态未变化时忽略，非法转换返回 ErrIllegalTransition
+func (m *stateMachine) transition(to enums.ClientStatusEM, reason string) error {
+	m.mu.Lock()
+	from := m.state
+	if from == to {
+		m.mu.Unlock()
+		return nil
+	}
+	if !canTransition(from, to) {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, from, to)
+	}
+	record := StateTransition{From: from, To: to, Reason: reason, At: time.Now()}
+	m.state = to
+	m.history = append(m.history, record)
+	if len(m.history) > maxStateHistory {
+		m.history = m.history[len(m.history)-maxStateHistory:]
+	}
+	// 唤醒等待该状态的调用方，即使状态随后马上变化也不会错过
+	waiters := m.waiters[:0]
+	for _, waiter := range m.waiters {
+		if waiter.state == to {
+			close(waiter.ch)
+		} else {
+			waiters = append(waiters, waiter)
+		}
+	}
+	m.waiters = waiters
+	m.pending = append(m.pending, record)
+	notify := !m.notifying
+	m.notifying = true
+	m.mu.Unlock()
+
+	if notify {
+		m.notify()
+	}
+	return nil
+}
+
+// notify 在锁外按转换发生的顺序通知监听器，监听器中可以查询和转换状态；
+// 其他协程正在通知时，新的转换由该协程依次通知
+func (m *stateMachine) notify() {
+	done := false
+	defer func() {
+		// 监听器发生 panic 时交给下一次转换继续通知
+		if !done {
+			m.mu.Lock()
+			m.notifying = false
+			m.mu.Unlock()
+		}
+	}()
+	for {
+		m.mu.Lock()
+		records := m.pending
+		m.pending = nil
+		listeners := m.listeners
+		if len(records) == 0 {
+			m.notifying = false
+			m.mu.Unlock()
+			done = true
+			return
+		}
+		m.mu.Unlock()
+		for _, record := range records {
+			for _, listener := range listeners {
+				listener(record)
+			}
+		}
+	}
+}
+
+// subscribe 注册状态变更监听器
+func (m *stateMachine) subscribe(listener StateListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// snapshot 状态转换记录，按时间先后排列
+func (m *stateMachine) snapshot() []StateTransition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := make([]StateTransition, len(m.history))
+	copy(history, m.history)
+	return history
+}
+
+// waitFor 阻塞直到进入指定状态或上下文取消，当前已处于该状态时立即返回
+func (m *stateMachine) waitFor(state enums.ClientStatusEM, ctx context.Context) error {
+	m.mu.Lock()
+	if m.state == state {
+		m.mu.Unlock()
+		return nil
+	}
+	waiter := stateWaiter{state: state, ch: make(chan struct{})}
+	m.waiters = append(m.waiters, waiter)
+	m.mu.Unlock()
+
+	select {
+	case <-waiter.ch:
+		return nil
+	case <-ctx.Done():
+		m.removeWaiter(waiter.ch)
+		return ctx.Err()
+	}
+}
+
+// removeWaiter 移除已放弃等待的调用方
+func (m *stateMachine) removeWaiter(ch chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, waiter := range m.waiters {
+		if waiter.ch == ch {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return
+		}
+	}
+}
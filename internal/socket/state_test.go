@@ -0,0 +1,307 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/serializer"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+func TestStateTransitions(t *testing.T) {
+	tests := []struct {
+		from, to enums.ClientStatusEM
+		legal    bool
+	}{
+		{enums.ClientStatusWaiting, enums.ClientStatusConnecting, true},
+		{enums.ClientStatusWaiting, enums.ClientStatusConnected, false},
+		{enums.ClientStatusConnecting, enums.ClientStatusConnected, true},
+		{enums.ClientStatusConnecting, enums.ClientStatusError, true},
+		{enums.ClientStatusConnecting, enums.ClientStatusWaiting, false},
+		{enums.ClientStatusConnected, enums.ClientStatusDisConnected, true},
+		{enums.ClientStatusConnected, enums.ClientStatusConnecting, false},
+		{enums.ClientStatusDisConnected, enums.ClientStatusConnecting, true},
+		{enums.ClientStatusDisConnected, enums.ClientStatusConnected, false},
+		{enums.ClientStatusError, enums.ClientStatusWaiting, true},
+		{enums.ClientStatusError, enums.ClientStatusConnected, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v->%v", tt.from, tt.to), func(t *testing.T) {
+			m := newStateMachine(tt.from)
+			err := m.transition(tt.to, "test")
+			if tt.legal != (err == nil) {
+				t.Fatalf("err = %v, legal = %v", err, tt.legal)
+			}
+			if !tt.legal {
+				if !errors.Is(err, ErrIllegalTransition) {
+					t.Fatalf("err = %v, want %v", err, ErrIllegalTransition)
+				}
+				// 非法转换不改变状态，也不记录
+				if m.current() != tt.from || len(m.snapshot()) != 0 {
+					t.Fatalf("state = %v, history = %v", m.current(), m.snapshot())
+				}
+				return
+			}
+			if m.current() != tt.to {
+				t.Fatalf("state = %v, want %v", m.current(), tt.to)
+			}
+		})
+	}
+
+	// 状态未变化时忽略
+	m := newStateMachine(enums.ClientStatusConnected)
+	if err := m.transition(enums.ClientStatusConnected, "again"); err != nil || len(m.snapshot()) != 0 {
+		t.Fatalf("same state: err = %v, history = %v", err, m.snapshot())
+	}
+}
+
+func TestStateHistoryCap(t *testing.T) {
+	m := newStateMachine(enums.ClientStatusWaiting)
+	cycle := []enums.ClientStatusEM{enums.ClientStatusConnecting, enums.ClientStatusConnected, enums.ClientStatusDisConnected, enums.ClientStatusWaiting}
+	total := maxStateHistory*2 + 3
+	for i := 0; i < total; i++ {
+		if err := m.transition(cycle[i%len(cycle)], fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := m.snapshot()
+	if len(history) != maxStateHistory {
+		t.Fatalf("history = %v, want %v", len(history), maxStateHistory)
+	}
+	// 只保留最近的记录，按时间先后排列
+	for i, record := range history {
+		if want := fmt.Sprint(total - maxStateHistory + i); record.Reason != want {
+			t.Fatalf("history[%d] = %v, want %v", i, record.Reason, want)
+		}
+	}
+	// 快照与状态机之后的修改互不影响
+	history[0].Reason = "modified"
+	if m.snapshot()[0].Reason == "modified" {
+		t.Fatal("snapshot shares memory with history")
+	}
+}
+
+func TestStateListenerOrder(t *testing.T) {
+	m := newStateMachine(enums.ClientStatusWaiting)
+	var mu sync.Mutex
+	var calls []string
+	for i := 0; i < 2; i++ {
+		m.subscribe(func(transition StateTransition) {
+			mu.Lock()
+			calls = append(calls, fmt.Sprintf("%d:%v", i, transition.To))
+			mu.Unlock()
+		})
+	}
+	// 监听器中转换状态不会死锁，新的转换在当前通知结束后按顺序通知
+	m.subscribe(func(transition StateTransition) {
+		if transition.To == enums.ClientStatusConnected {
+			if err := m.transition(enums.ClientStatusDisConnected, "nested"); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	_ = m.transition(enums.ClientStatusConnecting, "connect")
+	_ = m.transition(enums.ClientStatusConnected, "handshake")
+	want := fmt.Sprint([]string{
+		"0:" + enums.ClientStatusConnecting.String(), "1:" + enums.ClientStatusConnecting.String(),
+		"0:" + enums.ClientStatusConnected.String(), "1:" + enums.ClientStatusConnected.String(),
+		"0:" + enums.ClientStatusDisConnected.String(), "1:" + enums.ClientStatusDisConnected.String(),
+	})
+	if got := fmt.Sprint(calls); got != want {
+		t.Fatalf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestStateListenerOrderConcurrent(t *testing.T) {
+	m := newStateMachine(enums.ClientStatusWaiting)
+	var notified []StateTransition
+	m.subscribe(func(transition StateTransition) {
+		// 同一时刻只有一个协程通知监听器
+		notified = append(notified, transition)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				switch m.current() {
+				case enums.ClientStatusWaiting:
+					_ = m.transition(enums.ClientStatusConnecting, "")
+				case enums.ClientStatusConnecting:
+					_ = m.transition(enums.ClientStatusConnected, "")
+				case enums.ClientStatusConnected:
+					_ = m.transition(enums.ClientStatusDisConnected, "")
+				default:
+					_ = m.transition(enums.ClientStatusWaiting, "")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 所有转换都已通知，且每次通知的起始状态都是上一次通知的目标状态
+	for i := 1; i < len(notified); i++ {
+		if notified[i].From != notified[i-1].To {
+			t.Fatalf("notification %d: %v -> %v after %v -> %v", i, notified[i].From, notified[i].To, notified[i-1].From, notified[i-1].To)
+		}
+	}
+	if last := notified[len(notified)-1].To; last != m.current() {
+		t.Fatalf("last notified = %v, state = %v", last, m.current())
+	}
+}
+
+func TestStateWaitFor(t *testing.T) {
+	m := newStateMachine(enums.ClientStatusWaiting)
+	// 已处于该状态时立即返回
+	if err := m.waitFor(enums.ClientStatusWaiting, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上下文取消时返回并移除等待者
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- m.waitFor(enums.ClientStatusConnected, ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	m.mu.Lock()
+	waiters := len(m.waiters)
+	m.mu.Unlock()
+	if waiters != 0 {
+		t.Fatalf("waiters = %v, want 0", waiters)
+	}
+
+	// 状态随后马上变化也不会错过
+	go func() { errs <- m.waitFor(enums.ClientStatusConnecting, context.Background()) }()
+	for {
+		m.mu.Lock()
+		waiters = len(m.waiters)
+		m.mu.Unlock()
+		if waiters == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = m.transition(enums.ClientStatusConnecting, "")
+	_ = m.transition(enums.ClientStatusError, "")
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitFor not woken")
+	}
+}
+
+// pipeHandler 测试使用的客户端消息处理器，收到握手响应后进入已连接状态
+type pipeHandler struct {
+	client *Client
+}
+
+func (h *pipeHandler) HandshakeReq() error {
+	return nil
+}
+
+func (h *pipeHandler) HeartbeatReq() error {
+	return nil
+}
+
+func (h *pipeHandler) RegisterCommands(registry *Registry) {
+	Register(registry, message.CommandType_CommandType_HandShakeResp, func(ctx context.Context, _session *Session, payload *message.MSG_HANDSHAKE_RESP) error {
+		if payload.GetCode() != 0 {
+			return h.client.Transition(enums.ClientStatusError, payload.GetMessage())
+		}
+		return h.client.Transition(enums.ClientStatusConnected, "握手成功")
+	})
+}
+
+func TestClientStateOverPipe(t *testing.T) {
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{
+		MsgExpireTime:     60,
+		MaxFrameSize:      1024 * 1024,
+		AllowLegacyFrame:  true,
+		HeartbeatInterval: 60,
+		HandshakeTimeout:  5,
+		WriteQueueSize:    16,
+		WriteQueuePolicy:  "block",
+		WriteTimeout:      5,
+	}}
+	t.Cleanup(func() { config.Cfg = old })
+
+	for _, tt := range []struct {
+		name string
+		code int32
+		want []enums.ClientStatusEM
+	}{
+		{"accepted", 0, []enums.ClientStatusEM{enums.ClientStatusConnecting, enums.ClientStatusConnected, enums.ClientStatusDisConnected}},
+		{"rejected", 1, []enums.ClientStatusEM{enums.ClientStatusConnecting, enums.ClientStatusError}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, cancel := NewClient("pipe", 0)
+			defer cancel()
+			client.RegisterHandler(&pipeHandler{client: client})
+			var mu sync.Mutex
+			var changes []enums.ClientStatusEM
+			client.OnStateChange(func(transition StateTransition) {
+				mu.Lock()
+				changes = append(changes, transition.To)
+				mu.Unlock()
+			})
+			clientConn, serverConn := net.Pipe()
+			client.Conn = clientConn
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				client.Run()
+			}()
+
+			ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancelWait()
+			if err := client.WaitFor(enums.ClientStatusConnecting, ctx); err != nil {
+				t.Fatal(err)
+			}
+			// 服务端回复握手响应
+			data, err := serializer.NewCodec().SerializeMessage(message.CommandType_CommandType_HandShakeResp, &message.MSG_HANDSHAKE_RESP{
+				Code:    proto.Int32(tt.code),
+				Message: proto.String(tt.name),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				// 丢弃客户端发出的消息
+				_, _ = io.Copy(io.Discard, serverConn)
+			}()
+			if _, err = serverConn.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err = client.WaitFor(tt.want[1], ctx); err != nil {
+				t.Fatal(err)
+			}
+			// 服务端关闭连接，未启用重连时客户端退出
+			_ = serverConn.Close()
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("client not stopped")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if fmt.Sprint(changes) != fmt.Sprint(tt.want) {
+				t.Fatalf("changes = %v, want %v", changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package socket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultWheelSlots 时间轮的槽数，超时时间超过一圈时记录剩余圈数
+const defaultWheelSlots = 512
+
+// TimingWheel 哈希时间轮，由一个协程驱动，添加、删除和到期处理的复杂度均为 O(1)，
+// 用于代替为每个连接单独启动定时器协程
+type TimingWheel[K comparable] struct {
+	mu       sync.Mutex
+	tick     time.Duration
+	slots    []map[K]*wheelTimer
+	timers   map[K]*wheelTimer
+	cursor   int
+	onExpire func(key K)
+}
+
+// wheelTimer 时间轮中的定时器
+type wheelTimer struct {
+	slot   int // 所在的槽
+	rounds int // 指针还需转过的圈数
+}
+
+// NewTimingWheel 创建时间轮，tick 为指针走一格的时间即超时精度，到期时在时间轮协程中调用 onExpire
+func NewTimingWheel[K comparable](tick time.Duration, onExpire func(key K)) *TimingWheel[K] {
+	if tick <= 0 {
+		tick = time.Second
+	}
+	slots := make([]map[K]*wheelTimer, defaultWheelSlots)
+	for i := range slots {
+		slots[i] = make(map[K]*wheelTimer)
+	}
+	return &TimingWheel[K]{
+		tick:     tick,
+		slots:    slots,
+		timers:   make(map[K]*wheelTimer),
+		onExpire: onExpire,
+	}
+}
+
+// Add 添加或重置定时器，timeout 后到期
+func (w *TimingWheel[K]) Add(key K, timeout time.Duration) {
+	// 向上取整，保证不会提前到期
+	ticks := int((timeout + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.timers[key]; ok {
+		delete(w.slots[timer.slot], key)
+	}
+	timer := &wheelTimer{
+		slot:   (w.cursor + ticks) % len(w.slots),
+		rounds: (ticks - 1) / len(w.slots),
+	}
+	w.slots[timer.slot][key] = timer
+	w.timers[key] = timer
+}
+
+// Remove 删除定时器
+func (w *TimingWheel[K]) Remove(key K) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.timers[key]; ok {
+		delete(w.slots[timer.slot], key)
+		delete(w.timers, key)
+	}
+}
+
+// Len 定时器数量
+func (w *TimingWheel[K]) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.timers)
+}
+
+// Run 驱动时间轮，阻塞直到 ctx 取消
+func (w *TimingWheel[K]) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, key := range w.advance() {
+				w.onExpire(key)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// advance 指针前进一格，返回到期的定时器
+func (w *TimingWheel[K]) advance() []K {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cursor = (w.cursor + 1) % len(w.slots)
+	var expired []K
+	for key, timer := range w.slots[w.cursor] {
+		if timer.rounds > 0 {
+			timer.rounds--
+			continue
+		}
+		delete(w.slots[w.cursor], key)
+		delete(w.timers, key)
+		expired = append(expired, key)
+	}
+	return expired
+}
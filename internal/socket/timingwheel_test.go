@@ -0,0 +1,221 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"slices"
+	"sync"
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+// advanceN 指针前进 n 格，返回按到期先后排列的定时器
+func advanceN[K comparable](w *TimingWheel[K], n int) []K {
+	var expired []K
+	for i := 0; i < n; i++ {
+		expired = append(expired, w.advance()...)
+	}
+	return expired
+}
+
+func TestTimingWheelExpire(t *testing.T) {
+	w := NewTimingWheel[string](time.Second, nil)
+	w.Add("a", 3*time.Second)
+	w.Add("b", 1500*time.Millisecond) // 向上取整为2格
+	w.Add("c", 0)                     // 至少1格
+	if w.Len() != 3 {
+		t.Fatalf("Len = %v, want 3", w.Len())
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []string{"c"}) {
+		t.Fatalf("tick 1 expired = %v", expired)
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []string{"b"}) {
+		t.Fatalf("tick 2 expired = %v", expired)
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []string{"a"}) {
+		t.Fatalf("tick 3 expired = %v", expired)
+	}
+	if w.Len() != 0 {
+		t.Fatalf("Len = %v, want 0", w.Len())
+	}
+	// 到期后不会再次触发
+	if expired := advanceN(w, defaultWheelSlots); len(expired) != 0 {
+		t.Fatalf("expired again: %v", expired)
+	}
+}
+
+func TestTimingWheelRounds(t *testing.T) {
+	w := NewTimingWheel[int](time.Second, nil)
+	// 超过一圈的定时器在指针转过足够圈数后才到期
+	ticks := defaultWheelSlots*2 + 5
+	w.Add(1, time.Duration(ticks)*time.Second)
+	w.Add(2, time.Duration(defaultWheelSlots)*time.Second)
+	if expired := advanceN(w, defaultWheelSlots-1); len(expired) != 0 {
+		t.Fatalf("expired early: %v", expired)
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []int{2}) {
+		t.Fatalf("expired = %v, want [2]", expired)
+	}
+	if expired := advanceN(w, ticks-defaultWheelSlots-1); len(expired) != 0 {
+		t.Fatalf("expired early: %v", expired)
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []int{1}) {
+		t.Fatalf("expired = %v, want [1]", expired)
+	}
+}
+
+func TestTimingWheelResetAndRemove(t *testing.T) {
+	w := NewTimingWheel[string](time.Second, nil)
+	w.Add("a", 2*time.Second)
+	w.Add("b", 2*time.Second)
+	// 重新添加时按新的超时时间计算
+	advanceN(w, 1)
+	w.Add("a", 3*time.Second)
+	w.Remove("b")
+	w.Remove("missing")
+	if w.Len() != 1 {
+		t.Fatalf("Len = %v, want 1", w.Len())
+	}
+	if expired := advanceN(w, 2); len(expired) != 0 {
+		t.Fatalf("expired = %v, want none", expired)
+	}
+	if expired := advanceN(w, 1); !slices.Equal(expired, []string{"a"}) {
+		t.Fatalf("expired = %v, want [a]", expired)
+	}
+}
+
+func TestTimingWheelRun(t *testing.T) {
+	expired := make(chan string, 4)
+	w := NewTimingWheel(10*time.Millisecond, func(key string) {
+		expired <- key
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	start := time.Now()
+	w.Add("a", 30*time.Millisecond)
+	select {
+	case key := <-expired:
+		if key != "a" {
+			t.Fatalf("expired = %v, want a", key)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Fatalf("expired after %v, too early", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timer not expired")
+	}
+	// 取消后停止驱动
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run not stopped")
+	}
+}
+
+// blockingConn 关闭时阻塞，模拟对端不再读取数据的连接
+type blockingConn struct {
+	fakeConn
+	release chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (c *blockingConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	<-c.release
+	return nil
+}
+
+func TestCheckHeartbeatDoesNotBlock(t *testing.T) {
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{HeartbeatTimeout: 60, HeartbeatCheckTime: 15}}
+	t.Cleanup(func() { config.Cfg = old })
+	server := NewServer("127.0.0.1", 0)
+	defer server.cancel()
+
+	conn := &blockingConn{
+		fakeConn: fakeConn{addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1}},
+		release:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	defer close(conn.release)
+	server.Sessions.Add(conn, Session{DiverId: "device-1", LastAliveTime: 1, Ctx: context.Background()})
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		server.checkHeartbeat(conn)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("checkHeartbeat blocked on closing the connection")
+	}
+	select {
+	case <-conn.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+	if _, ok := server.Sessions.Get(conn); ok {
+		t.Fatal("session not removed")
+	}
+}
+
+// benchSessions 基准测试的会话数
+const benchSessions = 50000
+
+// BenchmarkHeartbeatTimingWheel 所有会话的心跳检测由一个时间轮调度
+func BenchmarkHeartbeatTimingWheel(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		base := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		w := NewTimingWheel(time.Second, func(int) {})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.Run(ctx)
+		}()
+		for j := 0; j < benchSessions; j++ {
+			w.Add(j, 60*time.Second)
+		}
+		b.ReportMetric(float64(runtime.NumGoroutine()-base), "goroutines")
+		cancel()
+		<-done
+	}
+}
+
+// BenchmarkHeartbeatTicker 原有方式：每个会话启动一个协程和一个定时器检测心跳
+func BenchmarkHeartbeatTicker(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		base := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for j := 0; j < benchSessions; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(15 * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		b.ReportMetric(float64(runtime.NumGoroutine()-base), "goroutines")
+		cancel()
+		wg.Wait()
+	}
+}
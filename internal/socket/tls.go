@@ -0,0 +1,107 @@
+package socket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"tcpsocketv2/config"
+)
+
+// tlsLoader 加载并缓存TLS证书，配置热重载时重新加载，已建立的连接不受影响
+type tlsLoader struct {
+	mu         sync.RWMutex
+	cfg        config.TLS
+	cert       *tls.Certificate // 本端证书，未配置时为 nil
+	ca         *x509.CertPool   // 校验对端证书的CA，未配置时为 nil（客户端使用系统CA）
+	minVersion uint16
+}
+
+// newTLSLoader 创建TLS证书加载器
+func newTLSLoader(cfg config.TLS) (*tlsLoader, error) {
+	t := &tlsLoader{}
+	if err := t.reload(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload 重新加载证书，加载失败时保留原有证书
+func (t *tlsLoader) reload(cfg config.TLS) error {
+	minVersion, err := cfg.MinTLSVersion()
+	if err != nil {
+		return err
+	}
+	var cert *tls.Certificate
+	if cfg.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("加载TLS证书失败: %v", err)
+		}
+		cert = &pair
+	}
+	var ca *x509.CertPool
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("读取CA证书失败: %v", err)
+		}
+		ca = x509.NewCertPool()
+		if !ca.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA证书中没有有效的证书: %v", cfg.CAFile)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+	t.cert = cert
+	t.ca = ca
+	t.minVersion = minVersion
+	return nil
+}
+
+// serverConfig 服务端TLS配置，每次握手时使用最新加载的证书
+func (t *tlsLoader) serverConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			if t.cert == nil {
+				return nil, fmt.Errorf("服务端未配置TLS证书")
+			}
+			clientAuth := tls.NoClientCert
+			if t.cfg.RequireClientCert {
+				clientAuth = tls.RequireAndVerifyClientCert
+			} else if t.ca != nil {
+				clientAuth = tls.VerifyClientCertIfGiven
+			}
+			return &tls.Config{
+				Certificates: []tls.Certificate{*t.cert},
+				ClientCAs:    t.ca,
+				ClientAuth:   clientAuth,
+				MinVersion:   t.minVersion,
+			}, nil
+		},
+	}
+}
+
+// clientConfig 客户端TLS配置
+func (t *tlsLoader) clientConfig(address string) *tls.Config {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	serverName := t.cfg.ServerName
+	if serverName == "" {
+		serverName = address
+	}
+	tlsCfg := &tls.Config{
+		RootCAs:    t.ca,
+		ServerName: serverName,
+		MinVersion: t.minVersion,
+	}
+	if t.cert != nil {
+		tlsCfg.Certificates = []tls.Certificate{*t.cert}
+	}
+	return tlsCfg
+}
@@ -0,0 +1,447 @@
+package socket
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/auth"
+	"testing"
+	"time"
+)
+
+// testCA 测试使用的CA
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // CA证书文件
+}
+
+// newTestCA 生成自签名的CA证书并写入临时目录
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{dir: t.TempDir(), cert: cert, key: key}
+	ca.file = writePEM(t, filepath.Join(ca.dir, "ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+// issue 签发证书，返回证书文件和私钥文件
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = writePEM(t, filepath.Join(ca.dir, commonName+".pem"), "CERTIFICATE", der)
+	keyFile = writePEM(t, filepath.Join(ca.dir, commonName+".key"), "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+// writePEM 以PEM格式写入文件
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mustLoader 创建TLS证书加载器
+func mustLoader(t *testing.T, cfg config.TLS) *tlsLoader {
+	t.Helper()
+	loader, err := newTLSLoader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loader
+}
+
+// tlsServer 启动只完成TLS握手的测试服务端，每个连接的握手结果通过返回的通道传出
+func tlsServer(t *testing.T, loader *tlsLoader) (string, <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	results := make(chan error, 8)
+	go func() {
+		tlsListener := tls.NewListener(listener, loader.serverConfig())
+		for {
+			conn, acceptErr := tlsListener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			handshakeErr := conn.(*tls.Conn).Handshake()
+			if handshakeErr == nil {
+				// 握手成功后回写一个字节，客户端读到后确认服务端已接受
+				_, handshakeErr = conn.Write([]byte{1})
+			}
+			_ = conn.Close()
+			results <- handshakeErr
+		}
+	}()
+	return listener.Addr().String(), results
+}
+
+// dialTLS 使用客户端配置连接并读取服务端回写的字节
+func dialTLS(addr string, loader *tlsLoader) (*tls.ConnectionState, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, loader.clientConfig("127.0.0.1"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+	state := conn.ConnectionState()
+	return &state, nil
+}
+
+// handshakeResult 等待服务端的握手结果
+func handshakeResult(t *testing.T, results <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-results:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server handshake timed out")
+		return nil
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	serverLoader := mustLoader(t, config.TLS{CertFile: certFile, KeyFile: keyFile})
+	addr, results := tlsServer(t, serverLoader)
+
+	state, err := dialTLS(addr, mustLoader(t, config.TLS{CAFile: ca.file}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handshakeResult(t, results); err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	if state.Version < tls.VersionTLS12 || state.PeerCertificates[0].Subject.CommonName != "server" {
+		t.Fatalf("version = %x, peer = %v", state.Version, state.PeerCertificates[0].Subject)
+	}
+
+	// 不信任服务端证书的客户端无法建立连接
+	if _, err = dialTLS(addr, mustLoader(t, config.TLS{CAFile: newTestCA(t).file})); err == nil {
+		t.Fatal("dial with unknown CA should fail")
+	}
+	_ = handshakeResult(t, results)
+
+	// 最低版本高于客户端支持的版本时握手失败
+	strict := mustLoader(t, config.TLS{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+	strictAddr, strictResults := tlsServer(t, strict)
+	client := mustLoader(t, config.TLS{CAFile: ca.file})
+	clientCfg := client.clientConfig("127.0.0.1")
+	clientCfg.MaxVersion = tls.VersionTLS12
+	if _, err = tls.Dial("tcp", strictAddr, clientCfg); err == nil {
+		t.Fatal("dial with TLS 1.2 should fail when server requires 1.3")
+	}
+	if err = handshakeResult(t, strictResults); err == nil {
+		t.Fatal("server accepted TLS 1.2")
+	}
+
+	// 重新加载失败时保留原有证书
+	if err = serverLoader.reload(config.TLS{CertFile: filepath.Join(ca.dir, "missing.pem"), KeyFile: keyFile}); err == nil {
+		t.Fatal("reload with missing cert should fail")
+	}
+	if _, err = dialTLS(addr, mustLoader(t, config.TLS{CAFile: ca.file})); err != nil {
+		t.Fatalf("dial after failed reload: %v", err)
+	}
+	_ = handshakeResult(t, results)
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	addr, results := tlsServer(t, mustLoader(t, config.TLS{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		CAFile:            ca.file,
+		RequireClientCert: true,
+	}))
+
+	// 没有客户端证书时服务端拒绝握手
+	if _, err := dialTLS(addr, mustLoader(t, config.TLS{CAFile: ca.file})); err == nil {
+		t.Fatal("dial without client cert should fail")
+	}
+	if err := handshakeResult(t, results); err == nil {
+		t.Fatal("server accepted client without cert")
+	}
+
+	// 其他CA签发的客户端证书同样被拒绝
+	other := newTestCA(t)
+	otherCert, otherKey := other.issue(t, "device-x", x509.ExtKeyUsageClientAuth)
+	if _, err := dialTLS(addr, mustLoader(t, config.TLS{CAFile: ca.file, CertFile: otherCert, KeyFile: otherKey})); err == nil {
+		t.Fatal("dial with untrusted client cert should fail")
+	}
+	if err := handshakeResult(t, results); err == nil {
+		t.Fatal("server accepted untrusted client cert")
+	}
+
+	clientCert, clientKey := ca.issue(t, "device-1", x509.ExtKeyUsageClientAuth)
+	if _, err := dialTLS(addr, mustLoader(t, config.TLS{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey})); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshakeResult(t, results); err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+}
+
+func TestMutualTLSPeerIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "device-1", x509.ExtKeyUsageClientAuth)
+	serverLoader := mustLoader(t, config.TLS{CertFile: certFile, KeyFile: keyFile, CAFile: ca.file, RequireClientCert: true})
+	serverConn, clientConn := net.Pipe()
+	server := tls.Server(serverConn, serverLoader.serverConfig())
+	client := tls.Client(clientConn, mustLoader(t, config.TLS{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey}).clientConfig("127.0.0.1"))
+	defer server.Close()
+	defer client.Close()
+	errs := make(chan error, 1)
+	go func() { errs <- client.Handshake() }()
+	if err := server.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	// 服务端以客户端证书主题作为设备身份
+	if identity, ok := auth.PeerIdentity(server); !ok || identity != "device-1" {
+		t.Fatalf("identity = %q, %v", identity, ok)
+	}
+}
+
+// writeTestConfig 写入热重载测试使用的配置文件
+func writeTestConfig(t *testing.T, path, certFile, keyFile string) {
+	t.Helper()
+	content := "tls:\n" +
+		"  enable: true\n" +
+		"  cert_file: " + certFile + "\n" +
+		"  key_file: " + keyFile + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSHotReload(t *testing.T) {
+	ca := newTestCA(t)
+	cert1, key1 := ca.issue(t, "server-1", x509.ExtKeyUsageServerAuth)
+	cert2, key2 := ca.issue(t, "server-2", x509.ExtKeyUsageServerAuth)
+
+	// 从临时目录加载配置文件并开启热重载
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(dir, "config", "test.config.yaml")
+	writeTestConfig(t, cfgFile, cert1, key1)
+	t.Setenv("TCPSOCKET_ENV", "test")
+	old := config.Cfg
+	t.Cleanup(func() { config.Cfg = old })
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	config.Init()
+	if err = os.Chdir(pwd); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer("127.0.0.1", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+	var addr string
+	for deadline := time.Now().Add(5 * time.Second); addr == "" && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		server.mu.Lock()
+		if server.listener != nil {
+			addr = server.listener.Addr().String()
+		}
+		server.mu.Unlock()
+	}
+	if addr == "" {
+		t.Fatal("server not listening")
+	}
+
+	client := mustLoader(t, config.TLS{CAFile: ca.file})
+	peer := func() string {
+		conn, dialErr := tls.Dial("tcp", addr, client.clientConfig("127.0.0.1"))
+		if dialErr != nil {
+			t.Fatal(dialErr)
+		}
+		defer conn.Close()
+		if dialErr = conn.Handshake(); dialErr != nil {
+			t.Fatal(dialErr)
+		}
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if name := peer(); name != "server-1" {
+		t.Fatalf("peer = %v, want server-1", name)
+	}
+	// 已建立的连接不受重新加载影响
+	established, err := tls.Dial("tcp", addr, client.clientConfig("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer established.Close()
+
+	// 修改配置文件后，新连接使用新证书
+	reloaded := make(chan struct{}, 1)
+	unregister := config.OnReload(func(newCfg *config.Config) {
+		// 写入过程中可能先读到不完整的文件，只关心写入完成后的那次重载
+		if newCfg.TLS.CertFile != cert2 {
+			return
+		}
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+	defer unregister()
+	writeTestConfig(t, cfgFile, cert2, key2)
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded")
+	}
+	if name := peer(); name != "server-2" {
+		t.Fatalf("peer = %v, want server-2", name)
+	}
+	if name := established.ConnectionState().PeerCertificates[0].Subject.CommonName; name != "server-1" {
+		t.Fatalf("established peer = %v, want server-1", name)
+	}
+}
+
+func TestDialerUsesTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	addr, results := tlsServer(t, mustLoader(t, config.TLS{CertFile: certFile, KeyFile: keyFile}))
+	cfg := &config.Config{
+		SrvInfo: config.ServerInfo{DialTimeout: 3},
+		TLS:     config.TLS{Enable: true, CAFile: ca.file},
+	}
+
+	// 启用TLS时拨号即完成TLS握手，超时时间同样生效
+	dialer, err := newDialer(cfg, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsDialer, ok := dialer.(*tls.Dialer)
+	if !ok || tlsDialer.NetDialer.Timeout != 3*time.Second {
+		t.Fatalf("dialer = %T, want tls dialer with timeout", dialer)
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if err = handshakeResult(t, results); err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+
+	// 只接受TCP连接的服务端无法通过探测
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	go func() {
+		for {
+			c, acceptErr := plain.Accept()
+			if acceptErr != nil {
+				return
+			}
+			_ = c.Close()
+		}
+	}()
+	if conn, err = dialer.DialContext(context.Background(), "tcp", plain.Addr().String()); err == nil {
+		_ = conn.Close()
+		t.Fatal("dial plain TCP server with TLS should fail")
+	}
+
+	// 不信任服务端证书时同样失败
+	cfg.TLS.CAFile = newTestCA(t).file
+	if dialer, err = newDialer(cfg, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dialer.DialContext(context.Background(), "tcp", addr); err == nil {
+		t.Fatal("dial with unknown CA should fail")
+	}
+	_ = handshakeResult(t, results)
+
+	// 未启用TLS时使用普通拨号器
+	cfg.TLS.Enable = false
+	if dialer, err = newDialer(cfg, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if netDialer, ok := dialer.(*net.Dialer); !ok || netDialer.Timeout != 3*time.Second {
+		t.Fatalf("dialer = %T, want net dialer with timeout", dialer)
+	}
+}
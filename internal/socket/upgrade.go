@@ -0,0 +1,144 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"time"
+)
+
+const (
+	// envListenerFd 新进程继承的监听socket文件描述符
+	envListenerFd = "TCPSOCKET_LISTENER_FD"
+	// envReadyFd 新进程开始监听后通过该文件描述符通知旧进程
+	envReadyFd = "TCPSOCKET_READY_FD"
+	// upgradeReadyTimeout 等待新进程开始监听的最长时间
+	upgradeReadyTimeout = 30 * time.Second
+)
+
+// inheritedListener 获取热升级时旧进程移交的监听socket，不是由热升级启动时返回 false
+func inheritedListener() (net.Listener, bool, error) {
+	value := os.Getenv(envListenerFd)
+	if value == "" {
+		return nil, false, nil
+	}
+	_ = os.Unsetenv(envListenerFd)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("%v 取值非法: %v", envListenerFd, value)
+	}
+	file := os.NewFile(uintptr(fd), "listener")
+	defer file.Close()
+	// FileListener 会复制文件描述符，原文件可以关闭
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, false, err
+	}
+	return listener, true, nil
+}
+
+// notifyUpgradeReady 新进程开始监听后通知旧进程
+func notifyUpgradeReady() error {
+	value := os.Getenv(envReadyFd)
+	if value == "" {
+		return nil
+	}
+	_ = os.Unsetenv(envReadyFd)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%v 取值非法: %v", envReadyFd, value)
+	}
+	file := os.NewFile(uintptr(fd), "ready")
+	defer file.Close()
+	_, err = file.Write([]byte{1})
+	return err
+}
+
+// Upgrade 热升级：以相同参数启动新的可执行文件并移交监听socket，新进程开始监听后，
+// 旧进程停止接受连接并通知已连接的客户端分散重连到新进程，关闭完成后 Serve 返回 ErrServerClosed
+//
+// 只移交监听socket，不移交已建立的连接和会话：旧进程仍会向每个客户端发送 Goodbye，
+// 客户端在 srvInfo.restart_spread 内随机等待后重连新进程。升级期间新连接不会被拒绝，
+// 但已连接的客户端会断开重连一次，这是有意的取舍，并非零停机升级。
+func (s *Server) Upgrade() error {
+	l := logger.Get()
+	s.mu.Lock()
+	if s.closing || s.upgrading || s.tcpListener == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("服务端未在监听或正在关闭，无法热升级")
+	}
+	s.upgrading = true
+	tcpListener := s.tcpListener
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.upgrading = false
+		s.mu.Unlock()
+	}()
+
+	// File 返回监听socket的副本，旧进程继续使用原socket直到新进程就绪
+	listenerFile, err := tcpListener.File()
+	if err != nil {
+		return fmt.Errorf("获取监听socket失败: %v", err)
+	}
+	defer listenerFile.Close()
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("创建通知管道失败: %v", err)
+	}
+	defer readyReader.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		_ = readyWriter.Close()
+		return fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ExtraFiles 中的文件在新进程中的描述符从3开始
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	cmd.Env = append(os.Environ(), envListenerFd+"=3", envReadyFd+"=4")
+	err = cmd.Start()
+	// 管道写端只保留在新进程中，新进程异常退出时读端能收到EOF
+	_ = readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("启动新进程失败: %v", err)
+	}
+	pid := cmd.Process.Pid
+	l.Info(fmt.Sprintf("热升级: 已启动新进程 %v，等待其开始监听", pid))
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, readErr := readyReader.Read(buf)
+		ready <- readErr
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(upgradeReadyTimeout):
+		err = errors.New("等待超时")
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_, _ = cmd.Process.Wait()
+		return fmt.Errorf("新进程 %v 未能开始监听: %v", pid, err)
+	}
+	// 新进程独立运行，旧进程退出后由系统接管
+	_ = cmd.Process.Release()
+	l.Info(fmt.Sprintf("热升级: 新进程 %v 已开始监听，旧进程开始关闭", pid))
+
+	cfg := config.Get()
+	go func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.SrvInfo.ShutdownTimeout*time.Second)
+		defer cancel()
+		_ = s.shutdown(shutdownCtx, enums.GoodbyeCode_Restart, "服务端升级", cfg.SrvInfo.RestartSpread*time.Second)
+	}()
+	return nil
+}
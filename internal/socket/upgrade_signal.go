@@ -0,0 +1,35 @@
+//go:build !windows
+
+package socket
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"tcpsocketv2/common/logger"
+)
+
+// UpgradeOnSignal 收到 SIGUSR2 时热升级，ctx 取消后停止监听信号
+func (s *Server) UpgradeOnSignal(ctx context.Context) {
+	l := logger.Get()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				l.Info("收到 SIGUSR2 信号，开始热升级")
+				if err := s.Upgrade(); err != nil {
+					l.Error(fmt.Sprintf("热升级失败，继续使用当前进程: %v", err))
+					continue
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+package socket
+
+import "context"
+
+// UpgradeOnSignal Windows 不支持 SIGUSR2 和文件描述符继承，不提供热升级
+func (s *Server) UpgradeOnSignal(ctx context.Context) {}
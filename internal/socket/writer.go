@@ -0,0 +1,273 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"time"
+)
+
+// ErrWriteQueueFull 写队列已满且策略为断开连接
+var ErrWriteQueueFull = errors.New("write queue full")
+
+// 写队列满时的处理策略
+const (
+	QueuePolicyBlock      = "block"       // 阻塞调用方直到有空位
+	QueuePolicyDropOldest = "drop_oldest" // 丢弃最早的消息
+	QueuePolicyDisconnect = "disconnect"  // 断开连接
+)
+
+// outbound 写队列中的一项，closeWrite 为 true 时表示在之前的消息发送完后关闭写方向
+type outbound struct {
+	data       []byte
+	closeWrite bool
+}
+
+// queuedConn 带写队列的连接：Write 只把完整的一帧放入有界队列，由唯一的写协程按顺序发送，
+// 多个协程并发写入不会交错，对端处理缓慢时也不会阻塞调用方（策略为 block 时除外）
+type queuedConn struct {
+	net.Conn
+	queue   chan outbound
+	policy  string
+	timeout time.Duration
+	metrics *Metrics
+	depth   atomic.Int64 // 当前队列深度
+
+	closed    chan struct{} // Close 调用后关闭
+	done      chan struct{} // 写协程退出后关闭
+	closeOnce sync.Once
+	errMu     sync.Mutex
+	err       error // 写协程遇到的第一个错误，之后的写入都返回该错误
+}
+
+// newQueuedConn 为连接创建写队列并启动写协程，已经包装过的连接直接返回
+func newQueuedConn(conn net.Conn, metrics *Metrics) net.Conn {
+	if _, ok := conn.(*queuedConn); ok {
+		return conn
+	}
+	cfg := config.Get()
+	size := cfg.Msg.WriteQueueSize
+	if size <= 0 {
+		size = 1
+	}
+	c := &queuedConn{
+		Conn:    conn,
+		queue:   make(chan outbound, size),
+		policy:  cfg.Msg.WriteQueuePolicy,
+		timeout: cfg.Msg.WriteTimeout * time.Second,
+		metrics: metrics,
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// NetConn 返回被包装的连接
+func (c *queuedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// QueueDepth 当前写队列深度
+func (c *queuedConn) QueueDepth() int {
+	return int(c.depth.Load())
+}
+
+// Write 将一帧消息放入写队列，成功入队即返回，发送失败的错误在之后的写入中返回
+func (c *queuedConn) Write(p []byte) (int, error) {
+	// 调用方可能复用缓冲区，入队前复制一份
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := c.enqueue(outbound{data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CloseWrite 在队列中已有的消息发送完后关闭写方向
+func (c *queuedConn) CloseWrite() error {
+	return c.enqueue(outbound{closeWrite: true})
+}
+
+// enqueue 放入写队列，队列满时按策略处理
+func (c *queuedConn) enqueue(item outbound) error {
+	if err := c.failure(); err != nil {
+		return err
+	}
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+	}
+	if c.trySend(item) {
+		return nil
+	}
+
+	switch c.policy {
+	case QueuePolicyDropOldest:
+		for !c.trySend(item) {
+			// 队列仍然是满的，丢弃最早的一条再重试
+			select {
+			case <-c.queue:
+				c.popped()
+				c.metrics.DroppedFrames.Add(1)
+			default:
+			}
+		}
+		return nil
+	case QueuePolicyDisconnect:
+		c.metrics.OverflowDisconnects.Add(1)
+		logger.Get().Warn(fmt.Sprintf("写队列已满，断开连接: %v", c.RemoteAddr()))
+		c.fail(ErrWriteQueueFull)
+		_ = c.Conn.Close()
+		return ErrWriteQueueFull
+	default:
+		// 阻塞直到有空位；写协程遇到错误或写超时会关闭连接，不会永久阻塞
+		c.pushed()
+		select {
+		case c.queue <- item:
+			return nil
+		case <-c.closed:
+			c.popped()
+			return net.ErrClosed
+		case <-c.done:
+			c.popped()
+			if err := c.failure(); err != nil {
+				return err
+			}
+			return net.ErrClosed
+		}
+	}
+}
+
+// trySend 不阻塞地放入写队列，队列已满时返回 false
+func (c *queuedConn) trySend(item outbound) bool {
+	// 先计数再入队，避免写协程先出队导致深度统计偏差
+	c.pushed()
+	select {
+	case c.queue <- item:
+		return true
+	default:
+		c.popped()
+		return false
+	}
+}
+
+// pushed 入队前更新队列深度
+func (c *queuedConn) pushed() {
+	depth := c.depth.Add(1)
+	c.metrics.QueueDepth.Add(1)
+	c.metrics.observeQueueDepth(depth)
+}
+
+// popped 出队后更新队列深度
+func (c *queuedConn) popped() {
+	c.depth.Add(-1)
+	c.metrics.QueueDepth.Add(-1)
+}
+
+// writeLoop 写协程，按顺序发送队列中的消息，Close 后在写超时时间内尽量发完剩余消息
+func (c *queuedConn) writeLoop() {
+	defer close(c.done)
+	for {
+		select {
+		case item := <-c.queue:
+			c.popped()
+			c.write(item, time.Now().Add(c.timeout))
+		case <-c.closed:
+			deadline := time.Now().Add(c.timeout)
+			for {
+				select {
+				case item := <-c.queue:
+					c.popped()
+					c.write(item, deadline)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write 发送一项，出错后关闭连接使读操作返回，之后的消息全部丢弃
+func (c *queuedConn) write(item outbound, deadline time.Time) {
+	if c.failure() != nil {
+		return
+	}
+	if c.timeout > 0 {
+		_ = c.Conn.SetWriteDeadline(deadline)
+	}
+	var err error
+	if item.closeWrite {
+		if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+			err = closer.CloseWrite()
+		}
+	} else {
+		_, err = c.Conn.Write(item.data)
+	}
+	if err == nil {
+		return
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.metrics.WriteTimeouts.Add(1)
+		logger.Get().Warn(fmt.Sprintf("写超时，关闭连接: %v", c.RemoteAddr()))
+	} else if !errors.Is(err, net.ErrClosed) {
+		c.metrics.WriteErrors.Add(1)
+		logger.Get().Warn(fmt.Sprintf("写入失败，关闭连接: %v, Error: %v", c.RemoteAddr(), err))
+	}
+	c.fail(err)
+	_ = c.Conn.Close()
+}
+
+// fail 记录第一个写错误
+func (c *queuedConn) fail(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// failure 写协程遇到的错误
+func (c *queuedConn) failure() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// Close 在写超时时间内发送完队列中剩余的消息后关闭连接
+func (c *queuedConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		<-c.done
+		c.discard()
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// discard 丢弃关闭期间入队、不会再发送的消息
+func (c *queuedConn) discard() {
+	for {
+		select {
+		case <-c.queue:
+			c.popped()
+		default:
+			return
+		}
+	}
+}
+
+// forceClose 立即关闭连接，不等待写队列中的消息发送完
+func forceClose(conn net.Conn) error {
+	if c, ok := conn.(*queuedConn); ok {
+		_ = c.Conn.Close()
+	}
+	return conn.Close()
+}
@@ -0,0 +1,145 @@
+package socket
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"tcpsocketv2/config"
+	"testing"
+	"time"
+)
+
+// stalledConn 对端暂不读取的连接，写队列的写协程会阻塞在第一条消息上
+func stalledConn(t *testing.T, size int, policy string, timeout time.Duration) (*queuedConn, net.Conn, *Metrics) {
+	t.Helper()
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{WriteQueueSize: size, WriteQueuePolicy: policy, WriteTimeout: timeout}}
+	local, peer := net.Pipe()
+	metrics := &Metrics{}
+	conn := newQueuedConn(local, metrics).(*queuedConn)
+	// 先关闭连接让写协程退出，之后再恢复配置
+	t.Cleanup(func() {
+		_ = peer.Close()
+		_ = conn.Close()
+		config.Cfg = old
+	})
+	return conn, peer, metrics
+}
+
+// fillQueue 写入第一条消息并等待写协程取走，之后写入的消息都留在队列中
+func fillQueue(t *testing.T, conn *queuedConn, frames ...byte) {
+	t.Helper()
+	if _, err := conn.Write([]byte{frames[0]}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); conn.QueueDepth() != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("first frame not taken by writer")
+		}
+	}
+	for _, frame := range frames[1:] {
+		if _, err := conn.Write([]byte{frame}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFrames 从对端读取 n 个单字节的消息
+func readFrames(t *testing.T, peer net.Conn, n int) []byte {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	frames := make([]byte, n)
+	if _, err := io.ReadFull(peer, frames); err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestWriteQueueBlock(t *testing.T) {
+	conn, peer, metrics := stalledConn(t, 2, QueuePolicyBlock, 0)
+	fillQueue(t, conn, 1, 2, 3)
+	if conn.QueueDepth() != 2 || metrics.QueueDepth.Load() != 2 {
+		t.Fatalf("depth = %v, metrics = %v, want 2", conn.QueueDepth(), metrics.QueueDepth.Load())
+	}
+
+	// 队列已满时阻塞调用方，而不是丢弃消息
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte{4})
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("write returned while queue full: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 对端开始读取后按顺序收到全部消息
+	if got := readFrames(t, peer, 4); string(got) != string([]byte{1, 2, 3, 4}) {
+		t.Fatalf("frames = %v, want 1 2 3 4", got)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if metrics.MaxQueueDepth.Load() != 3 || metrics.DroppedFrames.Load() != 0 {
+		t.Fatalf("max depth = %v, dropped = %v", metrics.MaxQueueDepth.Load(), metrics.DroppedFrames.Load())
+	}
+	if metrics.QueueDepth.Load() != 0 {
+		t.Fatalf("queue depth = %v after drain", metrics.QueueDepth.Load())
+	}
+}
+
+func TestWriteQueueDropOldest(t *testing.T) {
+	conn, peer, metrics := stalledConn(t, 2, QueuePolicyDropOldest, 0)
+	// 队列满后每写入一条丢弃最早的一条，调用方不阻塞
+	fillQueue(t, conn, 1, 2, 3, 4, 5)
+	if metrics.DroppedFrames.Load() != 2 || conn.QueueDepth() != 2 {
+		t.Fatalf("dropped = %v, depth = %v, want 2, 2", metrics.DroppedFrames.Load(), conn.QueueDepth())
+	}
+	if got := readFrames(t, peer, 3); string(got) != string([]byte{1, 4, 5}) {
+		t.Fatalf("frames = %v, want 1 4 5", got)
+	}
+	if metrics.QueueDepth.Load() != 0 {
+		t.Fatalf("queue depth = %v after drain", metrics.QueueDepth.Load())
+	}
+}
+
+func TestWriteQueueDisconnect(t *testing.T) {
+	conn, peer, metrics := stalledConn(t, 1, QueuePolicyDisconnect, 0)
+	fillQueue(t, conn, 1, 2)
+	// 队列满时断开连接，之后的写入都返回同一错误
+	if _, err := conn.Write([]byte{3}); !errors.Is(err, ErrWriteQueueFull) {
+		t.Fatalf("err = %v, want %v", err, ErrWriteQueueFull)
+	}
+	if _, err := conn.Write([]byte{4}); !errors.Is(err, ErrWriteQueueFull) {
+		t.Fatalf("err after disconnect = %v, want %v", err, ErrWriteQueueFull)
+	}
+	if metrics.OverflowDisconnects.Load() != 1 {
+		t.Fatalf("overflow disconnects = %v, want 1", metrics.OverflowDisconnects.Load())
+	}
+	// 对端读到连接关闭
+	_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(peer); err != nil {
+		t.Fatalf("peer read = %v, want EOF", err)
+	}
+}
+
+func TestWriteQueueTimeout(t *testing.T) {
+	conn, _, metrics := stalledConn(t, 4, QueuePolicyBlock, 1)
+	if _, err := conn.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	// 对端一直不读取，写超时后关闭连接，之后的写入返回超时错误
+	for deadline := time.Now().Add(5 * time.Second); metrics.WriteTimeouts.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("write did not time out")
+		}
+	}
+	if _, err := conn.Write([]byte{2}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if metrics.WriteErrors.Load() != 0 {
+		t.Fatalf("write errors = %v, timeouts are counted separately", metrics.WriteErrors.Load())
+	}
+}
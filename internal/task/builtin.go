@@ -0,0 +1,140 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shirou/gopsutil/v3/mem"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	message "tcpsocketv2/pb"
+	"tcpsocketv2/pkg/utils"
+	"time"
+)
+
+// registerBuiltins 注册内置任务
+func (e *Executor) registerBuiltins() {
+	e.Register(message.TaskType_TaskType_Diagnostics, e.diagnostics)
+	e.Register(message.TaskType_TaskType_Inventory, inventory)
+	e.Register(message.TaskType_TaskType_RotateLog, rotateLog)
+	e.Register(message.TaskType_TaskType_Action, runAction)
+}
+
+// diagnostics 采集客户端的运行状态，以 JSON 格式输出
+func (e *Executor) diagnostics(_ context.Context, _ *Task, output io.Writer) (int, error) {
+	cpu, memPercent := utils.GetPerformance()
+	return 0, writeJSON(output, map[string]any{
+		"time":          time.Now().Format(time.RFC3339),
+		"os":            utils.GetOS(),
+		"arch":          runtime.GOARCH,
+		"go_version":    runtime.Version(),
+		"goroutines":    runtime.NumGoroutine(),
+		"cpu_percent":   cpu,
+		"mem_percent":   memPercent,
+		"status":        e.Client.Status().String(),
+		"server":        net.JoinHostPort(e.Client.Address, strconv.Itoa(e.Client.Port)),
+		"metrics":       e.Client.Metrics.Snapshot(),
+		"state_history": e.Client.StateHistory(),
+	})
+}
+
+// netInterface 网络接口信息
+type netInterface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac"`
+	Addrs []string `json:"addrs"`
+}
+
+// inventory 采集设备的资产信息，以 JSON 格式输出，单项采集失败时跳过该项
+func inventory(_ context.Context, _ *Task, output io.Writer) (int, error) {
+	info := map[string]any{
+		"os":      utils.GetOS(),
+		"arch":    runtime.GOARCH,
+		"num_cpu": runtime.NumCPU(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		info["hostname"] = hostname
+	}
+	if fqdn, err := utils.GetFQDN(); err == nil {
+		info["fqdn"] = fqdn
+	}
+	if uuid, err := utils.GetDeviceUUID(); err == nil {
+		info["device_uuid"] = uuid
+	}
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		info["mem_total"] = memInfo.Total
+	}
+	if ifaces, err := net.Interfaces(); err == nil {
+		var list []netInterface
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			item := netInterface{Name: iface.Name, MAC: iface.HardwareAddr.String()}
+			if addresses, addrErr := iface.Addrs(); addrErr == nil {
+				for _, addr := range addresses {
+					item.Addrs = append(item.Addrs, addr.String())
+				}
+			}
+			list = append(list, item)
+		}
+		info["interfaces"] = list
+	}
+	return 0, writeJSON(output, info)
+}
+
+// rotateLog 立即切割客户端的日志文件
+func rotateLog(_ context.Context, _ *Task, output io.Writer) (int, error) {
+	if err := logger.Rotate(); err != nil {
+		return -1, fmt.Errorf("切割日志失败: %v", err)
+	}
+	_, err := fmt.Fprintln(output, "日志已切割")
+	return 0, err
+}
+
+// runAction 执行 task.actions 中允许的本地操作，参数 name 为操作名称；
+// 只执行配置中的命令，任务的其他参数不会拼接到命令中，通过环境变量 TCPSOCKET_TASK_ID 传递任务ID
+func runAction(ctx context.Context, task *Task, output io.Writer) (int, error) {
+	name := task.Args["name"]
+	command, ok := config.Get().Task.ActionCommand(name)
+	if !ok {
+		return -1, fmt.Errorf("操作不在允许列表中: %v", name)
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return -1, fmt.Errorf("操作 %v 的命令为空", name)
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Env = append(os.Environ(), "TCPSOCKET_TASK_ID="+task.Id)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// 子进程继承了输出管道时，命令退出后最多再等待1秒
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("执行操作 %v 失败: %v", name, err)
+	}
+	return 0, nil
+}
+
+// writeJSON 以 JSON 格式输出
+func writeJSON(output io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化输出失败: %v", err)
+	}
+	_, err = output.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// ErrNoDevice 没有匹配选择器的在线设备
+var ErrNoDevice = errors.New("no device matched")
+
+// resultGrace 超过执行超时时间后继续等待任务结果的时间，之后按超时处理
+const resultGrace = 10 * time.Second
+
+// Dispatcher 服务端的任务下发器：向在线设备下发任务，接收客户端回传的输出和结果并按任务ID保存
+type Dispatcher struct {
+	Server *socket.Server // 与调用方共享同一个服务端实例
+	Store  *Store         // 任务记录
+}
+
+// NewDispatcher 创建任务下发器，并在服务端注册任务输出和结果的处理函数
+func NewDispatcher(server *socket.Server) *Dispatcher {
+	d := &Dispatcher{Server: server, Store: NewStore()}
+	socket.Register(server.Commands, message.CommandType_CommandType_TaskOutput, d.handleOutput)
+	socket.Register(server.Commands, message.CommandType_CommandType_TaskResult, d.handleResult)
+	// 连接断开时尚未结束的任务再也收不到结果
+	server.Sessions.OnEvent(func(event socket.SessionEvent, _session socket.Session) {
+		if event == socket.SessionRemoved {
+			d.Store.lost(_session.Conn)
+		}
+	})
+	return d
+}
+
+// Dispatch 向选择器匹配的所有在线设备下发任务，等待各设备接受后返回任务记录，
+// 被拒绝或下发失败的设备对应的任务状态为 Rejected；没有匹配的设备时返回 ErrNoDevice
+func (d *Dispatcher) Dispatch(ctx context.Context, selector Selector, spec Spec) ([]Record, error) {
+	var sessions []socket.Session
+	d.Server.Sessions.Range(func(_session socket.Session) bool {
+		if selector.Match(_session) {
+			sessions = append(sessions, _session)
+		}
+		return true
+	})
+	if len(sessions) == 0 {
+		return nil, ErrNoDevice
+	}
+	records := make([]Record, len(sessions))
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			records[i], _ = d.DispatchTo(ctx, &sessions[i], spec)
+		}(i)
+	}
+	wg.Wait()
+	return records, nil
+}
+
+// DispatchTo 向指定会话下发任务并等待客户端接受，返回任务记录；客户端拒绝或下发失败时同时返回错误原因
+func (d *Dispatcher) DispatchTo(ctx context.Context, _session *socket.Session, spec Spec) (Record, error) {
+	l := logger.FromCtx(_session.Ctx)
+	cfg := config.Get().Task
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = cfg.Timeout * time.Second
+	}
+	id, err := newTaskId()
+	if err != nil {
+		return Record{}, err
+	}
+	d.Store.create(Record{
+		Id:        id,
+		DeviceId:  _session.DiverId,
+		Type:      spec.Type,
+		Args:      maps.Clone(spec.Args),
+		Status:    enums.TaskStatus_Dispatched,
+		CreatedAt: time.Now(),
+	}, _session.Conn, cfg.MaxRecords)
+
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	_, err = d.Server.Call(ctx, _session, message.CommandType_CommandType_Task, &message.MSG_TASK{
+		TaskId:  &id,
+		Type:    spec.Type.Enum(),
+		Args:    spec.Args,
+		Timeout: &seconds,
+	})
+	if err != nil {
+		l.Warn(fmt.Sprintf("下发任务失败, 任务ID: %v, 类型: %v, 设备: %v, Error: %v", id, spec.Type, _session.DiverId, err))
+		_ = d.Store.finish(id, nil, enums.TaskStatus_Rejected, -1, err.Error())
+		record, _ := d.Store.Get(id)
+		return record, fmt.Errorf("下发任务失败: %w", err)
+	}
+	d.Store.accepted(id)
+	l.Info(fmt.Sprintf("任务已下发, 任务ID: %v, 类型: %v, 设备: %v", id, spec.Type, _session.DiverId))
+	// 客户端执行超时后仍未回传结果（如处理函数不响应取消）时按超时处理
+	time.AfterFunc(timeout+resultGrace, func() {
+		_ = d.Store.finish(id, nil, enums.TaskStatus_TimedOut, -1, "超过执行超时时间仍未收到任务结果")
+	})
+	record, _ := d.Store.Get(id)
+	return record, nil
+}
+
+// handleOutput 收到客户端回传的任务输出
+func (d *Dispatcher) handleOutput(ctx context.Context, _session *socket.Session, payload *message.MSG_TASK_OUTPUT) error {
+	err := d.Store.appendOutput(payload.GetTaskId(), _session.Conn, payload.GetSeq(), payload.GetData(), config.Get().Task.MaxOutput)
+	if err != nil {
+		logger.FromCtx(ctx).Warn(fmt.Sprintf("丢弃未知任务的输出, 任务ID: %v, 对端: %v", payload.GetTaskId(), _session.RemoteAddr))
+	}
+	return nil
+}
+
+// handleResult 收到客户端回传的任务结果
+func (d *Dispatcher) handleResult(ctx context.Context, _session *socket.Session, payload *message.MSG_TASK_RESULT) error {
+	l := logger.FromCtx(ctx)
+	status := enums.TaskStatus(payload.GetStatus())
+	if !status.Finished() {
+		status = enums.TaskStatus_Failed
+	}
+	if err := d.Store.finish(payload.GetTaskId(), _session.Conn, status, payload.GetExitCode(), payload.GetError()); err != nil {
+		l.Warn(fmt.Sprintf("丢弃未知任务的结果, 任务ID: %v, 对端: %v", payload.GetTaskId(), _session.RemoteAddr))
+		return nil
+	}
+	l.Info(fmt.Sprintf("任务结束, 任务ID: %v, 状态: %v, 退出码: %v, 设备: %v", payload.GetTaskId(), status, payload.GetExitCode(), _session.DiverId))
+	return nil
+}
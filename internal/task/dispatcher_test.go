@@ -0,0 +1,256 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/handler"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+// initConfig 从临时目录加载测试配置，未配置的项使用默认值
+func initConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config", "test.config.yaml"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TCPSOCKET_ENV", "test")
+	old := config.Cfg
+	t.Cleanup(func() { config.Cfg = old })
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(pwd) }()
+	config.Init()
+}
+
+// startDispatcher 在本地随机端口启动带任务下发器的服务端，测试结束时关闭
+func startDispatcher(t *testing.T) (*Dispatcher, int) {
+	t.Helper()
+	// 服务端和客户端的协程都会读取日志，先完成初始化
+	logger.Get()
+	server := socket.NewServer("127.0.0.1", 0)
+	handler.NewServerMsgHandler(server)
+	d := NewDispatcher(server)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		_ = server.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if addr := server.Addr(); addr != nil {
+			return d, addr.(*net.TCPAddr).Port
+		}
+	}
+	t.Fatal("server not listening")
+	return nil, 0
+}
+
+// startClient 启动客户端并等待握手完成，返回客户端和停止客户端的函数，测试结束时也会停止
+func startClient(t *testing.T, port int) (*socket.Client, func()) {
+	t.Helper()
+	client, cancel := socket.NewClient("127.0.0.1", port)
+	handler.NewClientMsgHandler(client)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.Run()
+	}()
+	stop := func() {
+		cancel()
+		<-stopped
+	}
+	t.Cleanup(stop)
+	ctx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	if err := client.WaitFor(enums.ClientStatusConnected, ctx); err != nil {
+		t.Fatal(err)
+	}
+	return client, stop
+}
+
+// onlySession 等待服务端只有一个会话并返回
+func onlySession(t *testing.T, d *Dispatcher) socket.Session {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if sessions := d.Server.Sessions.Snapshot(); len(sessions) == 1 {
+			return sessions[0]
+		}
+	}
+	t.Fatal("session not created")
+	return socket.Session{}
+}
+
+// waitRecord 等待任务结束
+func waitRecord(t *testing.T, d *Dispatcher, id string) Record {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	record, err := d.Store.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("wait task %v: %v", id, err)
+	}
+	return record
+}
+
+// blockingHandler 阻塞直到 release 关闭或任务被取消的任务处理函数，开始执行时通知 started
+func blockingHandler(started chan<- string, release <-chan struct{}) Handler {
+	return func(ctx context.Context, task *Task, output io.Writer) (int, error) {
+		started <- task.Id
+		select {
+		case <-release:
+			return 0, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func TestDispatchToResult(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	d, port := startDispatcher(t)
+	client, _ := startClient(t, port)
+	executor := NewExecutor(client)
+	executor.Register(message.TaskType_TaskType_Action, func(ctx context.Context, task *Task, output io.Writer) (int, error) {
+		_, _ = fmt.Fprintf(output, "action %v", task.Args["name"])
+		if task.Args["name"] == "fail" {
+			return 3, nil
+		}
+		if task.Args["name"] == "error" {
+			return 0, errors.New("action error")
+		}
+		return 0, nil
+	})
+	_session := onlySession(t, d)
+
+	tests := []struct {
+		name     string
+		status   enums.TaskStatus
+		exitCode int32
+		errMsg   string
+	}{
+		{name: "ok", status: enums.TaskStatus_Succeeded},
+		{name: "fail", status: enums.TaskStatus_Failed, exitCode: 3},
+		{name: "error", status: enums.TaskStatus_Failed, exitCode: -1, errMsg: "action error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := d.DispatchTo(context.Background(), &_session, Spec{
+				Type: message.TaskType_TaskType_Action,
+				Args: map[string]string{"name": tt.name},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 任务很快结束时返回的记录可能已经带有结果
+			if record.Status == enums.TaskStatus_Dispatched || record.Status == enums.TaskStatus_Rejected || record.DeviceId != _session.DiverId {
+				t.Fatalf("dispatched record = %+v, want accepted by %v", record, _session.DiverId)
+			}
+			// 客户端回传的输出和结果按任务ID保存
+			record = waitRecord(t, d, record.Id)
+			if record.Status != tt.status || record.ExitCode != tt.exitCode || record.Error != tt.errMsg {
+				t.Fatalf("record = %v, %v, %q, want %v, %v, %q", record.Status, record.ExitCode, record.Error, tt.status, tt.exitCode, tt.errMsg)
+			}
+			if want := "action " + tt.name; string(record.Output) != want || record.Truncated {
+				t.Fatalf("output = %q, truncated = %v, want %q", record.Output, record.Truncated, want)
+			}
+		})
+	}
+}
+
+func TestDispatchToTimeout(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	d, port := startDispatcher(t)
+	client, _ := startClient(t, port)
+	// 客户端处理任务指令时一直不回复，服务端等待接受超时
+	release := make(chan struct{})
+	socket.Register(client.Commands, message.CommandType_CommandType_Task, func(ctx context.Context, _session *socket.Session, payload *message.MSG_TASK) error {
+		<-release
+		return nil
+	})
+	// 先于停止客户端执行，读协程才能退出
+	t.Cleanup(func() { close(release) })
+	_session := onlySession(t, d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	record, err := d.DispatchTo(ctx, &_session, Spec{Type: message.TaskType_TaskType_Diagnostics})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if record.Status != enums.TaskStatus_Rejected || record.Error == "" || record.FinishedAt.IsZero() {
+		t.Fatalf("record = %+v, want rejected", record)
+	}
+	if stored, ok := d.Store.Get(record.Id); !ok || stored.Status != enums.TaskStatus_Rejected {
+		t.Fatalf("stored record = %+v, want rejected", stored)
+	}
+	if timeouts := d.Server.Metrics.CallTimeouts.Load(); timeouts != 1 {
+		t.Fatalf("call timeouts = %v, want 1", timeouts)
+	}
+}
+
+func TestDispatchRejectedByClient(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	d, port := startDispatcher(t)
+	client, _ := startClient(t, port)
+	NewExecutor(client)
+	_session := onlySession(t, d)
+
+	// 客户端不支持的任务类型回复错误，任务直接结束
+	record, err := d.DispatchTo(context.Background(), &_session, Spec{Type: message.TaskType_TaskType_Unknown})
+	var remoteErr *socket.RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("err = %v, want *socket.RemoteError", err)
+	}
+	if record.Status != enums.TaskStatus_Rejected || record.ExitCode != -1 {
+		t.Fatalf("record = %+v, want rejected", record)
+	}
+}
+
+func TestStoreLostWhenSessionRemoved(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	d, port := startDispatcher(t)
+	client, stop := startClient(t, port)
+	executor := NewExecutor(client)
+	started := make(chan string, 1)
+	executor.Register(message.TaskType_TaskType_Action, blockingHandler(started, make(chan struct{})))
+	_session := onlySession(t, d)
+	record, err := d.DispatchTo(context.Background(), &_session, Spec{Type: message.TaskType_TaskType_Action})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// 客户端断开后会话被移除，尚未结束的任务标记为丢失
+	stop()
+	record = waitRecord(t, d, record.Id)
+	if record.Status != enums.TaskStatus_Lost || record.ExitCode != -1 {
+		t.Fatalf("record = %+v, want lost", record)
+	}
+	if d.Server.Sessions.Len() != 0 {
+		t.Fatalf("sessions = %v, want 0", d.Server.Sessions.Len())
+	}
+}
@@ -0,0 +1,168 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"runtime/debug"
+	"sync"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// outputChunkSize 单个输出片段的最大长度（字节）
+const outputChunkSize = 16 * 1024
+
+// Task 客户端收到的任务
+type Task struct {
+	Id   string            // 任务ID
+	Type message.TaskType  // 任务类型
+	Args map[string]string // 任务参数
+}
+
+// Handler 任务处理函数，执行过程中的输出写入 output 并实时回传给服务端，返回错误或退出码不为0时任务失败；
+// ctx 在执行超时、连接断开或客户端退出时取消
+type Handler func(ctx context.Context, task *Task, output io.Writer) (exitCode int, err error)
+
+// Executor 客户端的任务执行器：接受服务端下发的任务，在后台执行已注册的处理函数并回传输出和结果
+type Executor struct {
+	Client *socket.Client // 与调用方共享同一个客户端实例
+
+	mu       sync.Mutex
+	handlers map[message.TaskType]Handler
+	running  int // 正在执行的任务数
+}
+
+// NewExecutor 创建任务执行器，注册内置任务并在客户端注册任务指令的处理函数
+func NewExecutor(client *socket.Client) *Executor {
+	e := &Executor{
+		Client:   client,
+		handlers: make(map[message.TaskType]Handler),
+	}
+	e.registerBuiltins()
+	socket.RegisterCall(client.Commands, message.CommandType_CommandType_Task, e.handleTask)
+	return e
+}
+
+// Register 注册任务类型的处理函数，重复注册时覆盖原有的处理函数
+func (e *Executor) Register(taskType message.TaskType, handler Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers[taskType] = handler
+}
+
+// handleTask 收到服务端下发的任务，不支持的任务类型或正在执行的任务过多时拒绝，否则在后台执行并立即回复已接受
+func (e *Executor) handleTask(ctx context.Context, _session *socket.Session, payload *message.MSG_TASK) (*message.MSG_TASK_ACK, error) {
+	cfg := config.Get().Task
+	e.mu.Lock()
+	handler, ok := e.handlers[payload.GetType()]
+	if !ok {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("不支持的任务类型: %v", payload.GetType())
+	}
+	if cfg.MaxConcurrent > 0 && e.running >= cfg.MaxConcurrent {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("正在执行的任务数超过限制: %v", cfg.MaxConcurrent)
+	}
+	e.running++
+	e.mu.Unlock()
+
+	timeout := time.Duration(payload.GetTimeout()) * time.Second
+	if timeout <= 0 {
+		timeout = cfg.Timeout * time.Second
+	}
+	task := &Task{
+		Id:   payload.GetTaskId(),
+		Type: payload.GetType(),
+		Args: payload.GetArgs(),
+	}
+	logger.FromCtx(ctx).Info(fmt.Sprintf("开始执行任务, 任务ID: %v, 类型: %v, 超时时间: %v", task.Id, task.Type, timeout))
+	go e.run(*_session, task, handler, timeout)
+	return &message.MSG_TASK_ACK{TaskId: proto.String(task.Id)}, nil
+}
+
+// run 执行任务并回传结果，任务在连接的上下文中执行，连接断开后取消且不再回传
+func (e *Executor) run(_session socket.Session, task *Task, handler Handler, timeout time.Duration) {
+	defer func() {
+		e.mu.Lock()
+		e.running--
+		e.mu.Unlock()
+	}()
+	l := logger.FromCtx(_session.Ctx)
+	ctx, cancel := context.WithTimeout(_session.Ctx, timeout)
+	defer cancel()
+	output := &outputWriter{ctx: _session.Ctx, session: &_session, taskId: task.Id}
+	exitCode, err := e.execute(ctx, handler, task, output)
+
+	status := enums.TaskStatus_Succeeded
+	errMsg := ""
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status, errMsg = enums.TaskStatus_TimedOut, fmt.Sprintf("执行超时: %v", timeout)
+	case ctx.Err() != nil:
+		l.Warn(fmt.Sprintf("连接已断开，任务取消, 任务ID: %v", task.Id))
+		return
+	case err != nil:
+		status, errMsg = enums.TaskStatus_Failed, err.Error()
+		if exitCode == 0 {
+			exitCode = -1
+		}
+	case exitCode != 0:
+		status = enums.TaskStatus_Failed
+	}
+	l.Info(fmt.Sprintf("任务结束, 任务ID: %v, 状态: %v, 退出码: %v", task.Id, status, exitCode))
+	err = send(_session.Ctx, &_session, message.CommandType_CommandType_TaskResult, &message.MSG_TASK_RESULT{
+		TaskId:   proto.String(task.Id),
+		Status:   proto.Int32(int32(status)),
+		ExitCode: proto.Int32(int32(exitCode)),
+		Error:    proto.String(errMsg),
+	})
+	if err != nil {
+		l.Error(fmt.Sprintf("回传任务结果失败, 任务ID: %v, Error: %v", task.Id, err))
+	}
+}
+
+// execute 调用任务处理函数，发生 panic 时任务失败，不影响客户端的其他协程
+func (e *Executor) execute(ctx context.Context, handler Handler, task *Task, output io.Writer) (exitCode int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			e.Client.Metrics.Panics.Add(1)
+			logger.FromCtx(ctx).Error(fmt.Sprintf("执行任务时发生panic, 任务ID: %v, panic: %v\n%s", task.Id, p, debug.Stack()))
+			exitCode, err = -1, fmt.Errorf("执行任务时发生panic: %v", p)
+		}
+	}()
+	return handler(ctx, task, output)
+}
+
+// outputWriter 将任务输出按片段回传给服务端，并发写入时按顺序发送
+type outputWriter struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	session *socket.Session
+	taskId  string
+	seq     int64
+}
+
+// Write 将输出拆分为不超过 outputChunkSize 的片段发送
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for offset := 0; offset < len(p); offset += outputChunkSize {
+		w.seq++
+		err := send(w.ctx, w.session, message.CommandType_CommandType_TaskOutput, &message.MSG_TASK_OUTPUT{
+			TaskId: proto.String(w.taskId),
+			Seq:    proto.Int64(w.seq),
+			Data:   p[offset:min(offset+outputChunkSize, len(p))],
+		})
+		if err != nil {
+			return offset, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+	"time"
+)
+
+func TestExecutorRejectsOverLimit(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\ntask:\n  max_concurrent: 1\n")
+	d, port := startDispatcher(t)
+	client, _ := startClient(t, port)
+	executor := NewExecutor(client)
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	executor.Register(message.TaskType_TaskType_Action, blockingHandler(started, release))
+	_session := onlySession(t, d)
+	spec := Spec{Type: message.TaskType_TaskType_Action}
+	first, err := d.DispatchTo(context.Background(), &_session, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// 正在执行的任务数达到上限时拒绝新任务
+	rejected, err := d.DispatchTo(context.Background(), &_session, spec)
+	var remoteErr *socket.RemoteError
+	if !errors.As(err, &remoteErr) || !strings.Contains(remoteErr.Message, "超过限制") {
+		t.Fatalf("err = %v, want rejection over limit", err)
+	}
+	if rejected.Status != enums.TaskStatus_Rejected {
+		t.Fatalf("record = %+v, want rejected", rejected)
+	}
+
+	// 任务结束释放名额后可以再次下发
+	close(release)
+	if record := waitRecord(t, d, first.Id); record.Status != enums.TaskStatus_Succeeded {
+		t.Fatalf("first task = %v, want succeeded", record.Status)
+	}
+	// 结果回传后执行器才减少计数，需要重试
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		record, dispatchErr := d.DispatchTo(context.Background(), &_session, spec)
+		if dispatchErr == nil {
+			<-started
+			if record = waitRecord(t, d, record.Id); record.Status != enums.TaskStatus_Succeeded {
+				t.Fatalf("task after release = %v, want succeeded", record.Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task still rejected after release: %v", dispatchErr)
+		}
+	}
+}
+
+func TestExecutorTaskTimeout(t *testing.T) {
+	initConfig(t, "reconnect:\n  enable: false\n")
+	d, port := startDispatcher(t)
+	client, _ := startClient(t, port)
+	executor := NewExecutor(client)
+	started := make(chan string, 2)
+	executor.Register(message.TaskType_TaskType_Action, blockingHandler(started, make(chan struct{})))
+	_session := onlySession(t, d)
+
+	// 每个任务使用下发时指定的超时时间，超时后处理函数被取消并回传超时结果
+	start := time.Now()
+	record, err := d.DispatchTo(context.Background(), &_session, Spec{Type: message.TaskType_TaskType_Action, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record = waitRecord(t, d, record.Id)
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Fatalf("task finished after %v, want about 1s", elapsed)
+	}
+	if record.Status != enums.TaskStatus_TimedOut || !strings.Contains(record.Error, "执行超时") {
+		t.Fatalf("record = %v, %q, want timed out", record.Status, record.Error)
+	}
+}
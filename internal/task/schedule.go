@@ -0,0 +1,71 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"tcpsocketv2/common/enums"
+	"tcpsocketv2/common/logger"
+	"tcpsocketv2/config"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// ParseType 解析配置中的任务类型，忽略大小写和下划线，如 rotate_log 对应 TaskType_RotateLog
+func ParseType(name string) (message.TaskType, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for typeName, value := range message.TaskType_value {
+		taskType := message.TaskType(value)
+		if taskType == message.TaskType_TaskType_Unknown {
+			continue
+		}
+		if strings.ToLower(strings.TrimPrefix(typeName, "TaskType_")) == normalized {
+			return taskType, nil
+		}
+	}
+	return message.TaskType_TaskType_Unknown, fmt.Errorf("未知的任务类型: %v", name)
+}
+
+// Schedule 按 task.schedules 定时向在线设备下发任务，直到 ctx 取消；任务类型非法时不启动任何定时任务并返回错误
+func (d *Dispatcher) Schedule(ctx context.Context, schedules []config.TaskSchedule) error {
+	specs := make([]Spec, len(schedules))
+	for i, schedule := range schedules {
+		taskType, err := ParseType(schedule.Type)
+		if err != nil {
+			return fmt.Errorf("task.schedules[%d]: %v", i, err)
+		}
+		specs[i] = Spec{Type: taskType, Args: schedule.Args, Timeout: schedule.Timeout * time.Second}
+	}
+	for i, schedule := range schedules {
+		go d.runSchedule(ctx, Selector{DeviceIds: schedule.DeviceIds}, specs[i], schedule.Interval*time.Second)
+	}
+	return nil
+}
+
+// runSchedule 每隔 interval 下发一次任务，上一次下发尚未结束时跳过本次
+func (d *Dispatcher) runSchedule(ctx context.Context, selector Selector, spec Spec, interval time.Duration) {
+	l := logger.FromCtx(ctx)
+	l.Info(fmt.Sprintf("启动定时任务, 类型: %v, 间隔: %v", spec.Type, interval))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			records, err := d.Dispatch(ctx, selector, spec)
+			if errors.Is(err, ErrNoDevice) {
+				l.Debug(fmt.Sprintf("定时任务没有匹配的在线设备, 类型: %v", spec.Type))
+				continue
+			}
+			rejected := 0
+			for _, record := range records {
+				if record.Status == enums.TaskStatus_Rejected {
+					rejected++
+				}
+			}
+			l.Info(fmt.Sprintf("定时任务已下发, 类型: %v, 设备数: %v, 下发失败: %v", spec.Type, len(records), rejected))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package task
+
+import (
+	"context"
+	"tcpsocketv2/config"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"testing"
+)
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		name string
+		want message.TaskType
+		ok   bool
+	}{
+		{"diagnostics", message.TaskType_TaskType_Diagnostics, true},
+		{"Inventory", message.TaskType_TaskType_Inventory, true},
+		{"rotate_log", message.TaskType_TaskType_RotateLog, true},
+		{"RotateLog", message.TaskType_TaskType_RotateLog, true},
+		{"action", message.TaskType_TaskType_Action, true},
+		{"unknown", message.TaskType_TaskType_Unknown, false},
+		{"reboot", message.TaskType_TaskType_Unknown, false},
+		{"", message.TaskType_TaskType_Unknown, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseType(tt.name)
+		if tt.ok != (err == nil) || got != tt.want {
+			t.Fatalf("ParseType(%q) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestScheduleRejectsUnknownType(t *testing.T) {
+	old := config.Cfg
+	config.Cfg = &config.Config{Msg: config.Msg{HeartbeatCheckTime: 15}}
+	t.Cleanup(func() { config.Cfg = old })
+	d := NewDispatcher(socket.NewServer("127.0.0.1", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 任意一项类型非法时整体失败，不会只启动部分定时任务
+	err := d.Schedule(ctx, []config.TaskSchedule{
+		{Type: "inventory", Interval: 60},
+		{Type: "reboot", Interval: 60},
+	})
+	if err == nil {
+		t.Fatal("schedule with unknown task type started")
+	}
+}
@@ -0,0 +1,193 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net"
+	"sync"
+	"tcpsocketv2/common/enums"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// ErrTaskNotFound 任务不存在或已被淘汰
+var ErrTaskNotFound = errors.New("task not found")
+
+// Record 服务端保存的任务记录
+type Record struct {
+	Id         string            // 任务ID
+	DeviceId   string            // 执行任务的设备ID
+	Type       message.TaskType  // 任务类型
+	Args       map[string]string // 任务参数
+	Status     enums.TaskStatus  // 任务状态
+	ExitCode   int32             // 退出码
+	Error      string            // 错误信息
+	Output     []byte            // 任务输出，超过 task.max_output 的部分被丢弃
+	Truncated  bool              // 输出是否不完整（超过长度限制或有片段丢失）
+	CreatedAt  time.Time         // 下发时间
+	FinishedAt time.Time         // 结束时间
+}
+
+// entry 任务记录及其内部状态
+type entry struct {
+	record  Record
+	conn    net.Conn      // 执行任务的连接，只接受该连接发来的输出和结果
+	lastSeq int64         // 最后收到的输出片段序号
+	done    chan struct{} // 任务结束后关闭
+}
+
+// Store 按任务ID保存任务记录，并发安全
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   []string // 按下发顺序排列的任务ID，淘汰时使用
+}
+
+// NewStore 创建任务记录存储
+func NewStore() *Store {
+	return &Store{entries: make(map[string]*entry)}
+}
+
+// create 记录新下发的任务，超过 maxRecords 时淘汰最早结束的任务
+func (s *Store) create(record Record, conn net.Conn, maxRecords int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for maxRecords > 0 && len(s.entries) >= maxRecords {
+		if !s.evict() {
+			break
+		}
+	}
+	s.entries[record.Id] = &entry{record: record, conn: conn, done: make(chan struct{})}
+	s.order = append(s.order, record.Id)
+}
+
+// evict 淘汰最早结束的任务，没有已结束的任务时返回 false
+func (s *Store) evict() bool {
+	for i, id := range s.order {
+		if e, ok := s.entries[id]; !ok || e.record.Status.Finished() {
+			delete(s.entries, id)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// accepted 客户端已接受任务
+func (s *Store) accepted(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[id]; ok && e.record.Status == enums.TaskStatus_Dispatched {
+		e.record.Status = enums.TaskStatus_Running
+	}
+}
+
+// appendOutput 追加任务输出，片段序号不连续时标记输出不完整
+func (s *Store) appendOutput(id string, conn net.Conn, seq int64, data []byte, maxOutput int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok || e.conn != conn {
+		return ErrTaskNotFound
+	}
+	if e.record.Status.Finished() {
+		return nil
+	}
+	if seq != e.lastSeq+1 {
+		e.record.Truncated = true
+	}
+	e.lastSeq = seq
+	if maxOutput > 0 && len(e.record.Output)+len(data) > maxOutput {
+		data = data[:max(0, maxOutput-len(e.record.Output))]
+		e.record.Truncated = true
+	}
+	e.record.Output = append(e.record.Output, data...)
+	return nil
+}
+
+// finish 任务结束，conn 不为空时只接受执行任务的连接发来的结果，已结束的任务不再修改
+func (s *Store) finish(id string, conn net.Conn, status enums.TaskStatus, exitCode int32, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok || (conn != nil && e.conn != conn) {
+		return ErrTaskNotFound
+	}
+	if e.record.Status.Finished() {
+		return nil
+	}
+	e.record.Status = status
+	e.record.ExitCode = exitCode
+	e.record.Error = errMsg
+	e.record.FinishedAt = time.Now()
+	close(e.done)
+	return nil
+}
+
+// lost 连接断开，该连接上尚未结束的任务全部标记为丢失
+func (s *Store) lost(conn net.Conn) {
+	s.mu.Lock()
+	var ids []string
+	for id, e := range s.entries {
+		if e.conn == conn && !e.record.Status.Finished() {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		_ = s.finish(id, conn, enums.TaskStatus_Lost, -1, "结果送达前连接已断开")
+	}
+}
+
+// Get 获取任务记录的副本
+func (s *Store) Get(id string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return Record{}, false
+	}
+	return e.snapshot(), true
+}
+
+// List 按下发顺序获取所有任务记录的副本
+func (s *Store) List() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]Record, 0, len(s.entries))
+	for _, id := range s.order {
+		if e, ok := s.entries[id]; ok {
+			records = append(records, e.snapshot())
+		}
+	}
+	return records
+}
+
+// Wait 阻塞直到任务结束或 ctx 取消，返回任务记录的副本
+func (s *Store) Wait(ctx context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	s.mu.Unlock()
+	if !ok {
+		return Record{}, ErrTaskNotFound
+	}
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return Record{}, ctx.Err()
+	}
+	record, ok := s.Get(id)
+	if !ok {
+		return Record{}, ErrTaskNotFound
+	}
+	return record, nil
+}
+
+// snapshot 任务记录的副本，调用方须持有锁
+func (e *entry) snapshot() Record {
+	record := e.record
+	record.Args = maps.Clone(e.record.Args)
+	record.Output = append([]byte(nil), e.record.Output...)
+	return record
+}
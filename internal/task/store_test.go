@@ -0,0 +1,121 @@
+package task
+
+import (
+	"context"
+	"net"
+	"tcpsocketv2/common/enums"
+	"testing"
+	"time"
+)
+
+// pipeConns 两个不同的连接，用于区分任务所属的连接
+func pipeConns(t *testing.T) (net.Conn, net.Conn) {
+	first, firstPeer := net.Pipe()
+	second, secondPeer := net.Pipe()
+	t.Cleanup(func() {
+		for _, conn := range []net.Conn{first, firstPeer, second, secondPeer} {
+			_ = conn.Close()
+		}
+	})
+	return first, second
+}
+
+func TestStoreLost(t *testing.T) {
+	s := NewStore()
+	conn, other := pipeConns(t)
+	s.create(Record{Id: "running", Status: enums.TaskStatus_Dispatched}, conn, 0)
+	s.accepted("running")
+	s.create(Record{Id: "finished", Status: enums.TaskStatus_Dispatched}, conn, 0)
+	if err := s.finish("finished", conn, enums.TaskStatus_Succeeded, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.create(Record{Id: "other", Status: enums.TaskStatus_Dispatched}, other, 0)
+
+	// 只有该连接上尚未结束的任务标记为丢失
+	s.lost(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	record, err := s.Wait(ctx, "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != enums.TaskStatus_Lost || record.ExitCode != -1 || record.FinishedAt.IsZero() {
+		t.Fatalf("running task = %+v, want lost", record)
+	}
+	if record, _ = s.Get("finished"); record.Status != enums.TaskStatus_Succeeded {
+		t.Fatalf("finished task = %v, want succeeded", record.Status)
+	}
+	if record, _ = s.Get("other"); record.Status != enums.TaskStatus_Dispatched {
+		t.Fatalf("task of other conn = %v, want dispatched", record.Status)
+	}
+
+	// 丢失后迟到的结果不再修改任务状态
+	if err = s.finish("running", conn, enums.TaskStatus_Succeeded, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ = s.Get("running"); record.Status != enums.TaskStatus_Lost {
+		t.Fatalf("late result changed status to %v", record.Status)
+	}
+}
+
+func TestStoreAcceptsOnlyOwnConn(t *testing.T) {
+	s := NewStore()
+	conn, other := pipeConns(t)
+	s.create(Record{Id: "task", Status: enums.TaskStatus_Running}, conn, 0)
+	// 其他连接发来的输出和结果按未知任务处理
+	if err := s.appendOutput("task", other, 1, []byte("x"), 0); err != ErrTaskNotFound {
+		t.Fatalf("output from other conn = %v, want %v", err, ErrTaskNotFound)
+	}
+	if err := s.finish("task", other, enums.TaskStatus_Succeeded, 0, ""); err != ErrTaskNotFound {
+		t.Fatalf("result from other conn = %v, want %v", err, ErrTaskNotFound)
+	}
+	if err := s.finish("missing", conn, enums.TaskStatus_Succeeded, 0, ""); err != ErrTaskNotFound {
+		t.Fatalf("result of missing task = %v, want %v", err, ErrTaskNotFound)
+	}
+	if record, _ := s.Get("task"); record.Status != enums.TaskStatus_Running || len(record.Output) != 0 {
+		t.Fatalf("task = %+v, want untouched", record)
+	}
+}
+
+func TestStoreOutput(t *testing.T) {
+	s := NewStore()
+	conn, _ := pipeConns(t)
+	s.create(Record{Id: "task", Status: enums.TaskStatus_Running}, conn, 0)
+	for seq, data := range []string{"abc", "def"} {
+		if err := s.appendOutput("task", conn, int64(seq+1), []byte(data), 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超过长度限制的部分被丢弃
+	record, _ := s.Get("task")
+	if string(record.Output) != "abcde" || !record.Truncated {
+		t.Fatalf("output = %q, truncated = %v, want abcde, true", record.Output, record.Truncated)
+	}
+
+	// 片段序号不连续时标记输出不完整
+	s.create(Record{Id: "gap", Status: enums.TaskStatus_Running}, conn, 0)
+	_ = s.appendOutput("gap", conn, 1, []byte("a"), 0)
+	_ = s.appendOutput("gap", conn, 3, []byte("c"), 0)
+	if record, _ = s.Get("gap"); string(record.Output) != "ac" || !record.Truncated {
+		t.Fatalf("output = %q, truncated = %v, want ac, true", record.Output, record.Truncated)
+	}
+}
+
+func TestStoreEvictsFinished(t *testing.T) {
+	s := NewStore()
+	conn, _ := pipeConns(t)
+	s.create(Record{Id: "first", Status: enums.TaskStatus_Running}, conn, 2)
+	s.create(Record{Id: "second", Status: enums.TaskStatus_Running}, conn, 2)
+	_ = s.finish("second", conn, enums.TaskStatus_Succeeded, 0, "")
+	// 超过记录数限制时淘汰已结束的任务，未结束的任务保留
+	s.create(Record{Id: "third", Status: enums.TaskStatus_Running}, conn, 2)
+	if _, ok := s.Get("second"); ok {
+		t.Fatal("finished task not evicted")
+	}
+	if _, ok := s.Get("first"); !ok {
+		t.Fatal("running task evicted")
+	}
+	if records := s.List(); len(records) != 2 || records[0].Id != "first" || records[1].Id != "third" {
+		t.Fatalf("records = %+v, want first, third", records)
+	}
+}
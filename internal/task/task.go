@@ -0,0 +1,69 @@
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"tcpsocketv2/internal/serializer"
+	"tcpsocketv2/internal/socket"
+	message "tcpsocketv2/pb"
+	"time"
+)
+
+// Spec 下发的任务
+type Spec struct {
+	Type    message.TaskType  // 任务类型
+	Args    map[string]string // 任务参数，含义由任务类型决定
+	Timeout time.Duration     // 执行超时时间，0 表示使用 task.timeout
+}
+
+// Selector 按设备ID和会话标签选择在线设备，各条件同时满足才算匹配，所有条件为空时匹配所有在线设备
+type Selector struct {
+	DeviceIds []string          // 设备ID，满足其一即可
+	Labels    map[string]string // 认证后的会话标签，须全部匹配
+}
+
+// Match 判断会话是否匹配
+func (s Selector) Match(_session socket.Session) bool {
+	if len(s.DeviceIds) > 0 {
+		matched := false
+		for _, deviceId := range s.DeviceIds {
+			if deviceId == _session.DiverId {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, value := range s.Labels {
+		if _session.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// newTaskId 生成随机的任务ID
+func newTaskId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成任务ID失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// send 在会话所属的连接上发送消息
+func send(ctx context.Context, _session *socket.Session, command message.CommandType, payload proto.Message) error {
+	pkg, err := serializer.CodecFromCtx(ctx).SerializeMessage(command, payload)
+	if err != nil {
+		return fmt.Errorf("序列化消息异常: %v", err)
+	}
+	if _, err = _session.Conn.Write(pkg); err != nil {
+		return fmt.Errorf("发送消息失败: %v", err)
+	}
+	return nil
+}
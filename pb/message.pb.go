@@ -34,21 +34,53 @@ const (
 	CommandType_CommandType_HandShakeResp CommandType = 2
 	// 心跳
 	CommandType_CommandType_Heartbeat CommandType = 3
+	// 认证质询
+	CommandType_CommandType_AuthChallenge CommandType = 4
+	// 认证应答
+	CommandType_CommandType_AuthResp CommandType = 5
+	// 优雅断开
+	CommandType_CommandType_Goodbye CommandType = 6
+	// 错误回复
+	CommandType_CommandType_Error CommandType = 7
+	// 下发任务（服务端 -> 客户端）
+	CommandType_CommandType_Task CommandType = 8
+	// 任务输出（客户端 -> 服务端）
+	CommandType_CommandType_TaskOutput CommandType = 9
+	// 任务结果（客户端 -> 服务端）
+	CommandType_CommandType_TaskResult CommandType = 10
+	// 心跳响应（服务端 -> 客户端），握手时协商了 heartbeat_ack 特性才会发送
+	CommandType_CommandType_HeartbeatAck CommandType = 11
 )
 
 // Enum value maps for CommandType.
 var (
 	CommandType_name = map[int32]string{
-		0: "CommandType_Unknow",
-		1: "CommandType_HandShakeReq",
-		2: "CommandType_HandShakeResp",
-		3: "CommandType_Heartbeat",
+		0:  "CommandType_Unknow",
+		1:  "CommandType_HandShakeReq",
+		2:  "CommandType_HandShakeResp",
+		3:  "CommandType_Heartbeat",
+		4:  "CommandType_AuthChallenge",
+		5:  "CommandType_AuthResp",
+		6:  "CommandType_Goodbye",
+		7:  "CommandType_Error",
+		8:  "CommandType_Task",
+		9:  "CommandType_TaskOutput",
+		10: "CommandType_TaskResult",
+		11: "CommandType_HeartbeatAck",
 	}
 	CommandType_value = map[string]int32{
 		"CommandType_Unknow":        0,
 		"CommandType_HandShakeReq":  1,
 		"CommandType_HandShakeResp": 2,
 		"CommandType_Heartbeat":     3,
+		"CommandType_AuthChallenge": 4,
+		"CommandType_AuthResp":      5,
+		"CommandType_Goodbye":       6,
+		"CommandType_Error":         7,
+		"CommandType_Task":          8,
+		"CommandType_TaskOutput":    9,
+		"CommandType_TaskResult":    10,
+		"CommandType_HeartbeatAck":  11,
 	}
 )
 
@@ -89,12 +121,85 @@ func (CommandType) EnumDescriptor() ([]byte, []int) {
 	return file_message_proto_rawDescGZIP(), []int{0}
 }
 
+// 任务类型
+type TaskType int32
+
+const (
+	// 未知任务
+	TaskType_TaskType_Unknown TaskType = 0
+	// 采集诊断信息
+	TaskType_TaskType_Diagnostics TaskType = 1
+	// 刷新资产信息
+	TaskType_TaskType_Inventory TaskType = 2
+	// 切割日志
+	TaskType_TaskType_RotateLog TaskType = 3
+	// 执行允许列表中的本地操作
+	TaskType_TaskType_Action TaskType = 4
+)
+
+// Enum value maps for TaskType.
+var (
+	TaskType_name = map[int32]string{
+		0: "TaskType_Unknown",
+		1: "TaskType_Diagnostics",
+		2: "TaskType_Inventory",
+		3: "TaskType_RotateLog",
+		4: "TaskType_Action",
+	}
+	TaskType_value = map[string]int32{
+		"TaskType_Unknown":     0,
+		"TaskType_Diagnostics": 1,
+		"TaskType_Inventory":   2,
+		"TaskType_RotateLog":   3,
+		"TaskType_Action":      4,
+	}
+)
+
+func (x TaskType) Enum() *TaskType {
+	p := new(TaskType)
+	*p = x
+	return p
+}
+
+func (x TaskType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TaskType) Descriptor() protoreflect.EnumDescriptor {
+	return file_message_proto_enumTypes[1].Descriptor()
+}
+
+func (TaskType) Type() protoreflect.EnumType {
+	return &file_message_proto_enumTypes[1]
+}
+
+func (x TaskType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *TaskType) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = TaskType(num)
+	return nil
+}
+
+// Deprecated: Use TaskType.Descriptor instead.
+func (TaskType) EnumDescriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{1}
+}
+
 // 通用消息体
 type MSG_BODY struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Command       *CommandType           `protobuf:"varint,1,req,name=command,enum=pb.CommandType" json:"command,omitempty"`
 	Payload       *anypb.Any             `protobuf:"bytes,2,req,name=payload" json:"payload,omitempty"`
 	Timestamp     *int64                 `protobuf:"varint,3,req,name=timestamp" json:"timestamp,omitempty"`
+	RequestId     *uint64                `protobuf:"varint,4,opt,name=requestId" json:"requestId,omitempty"` // 请求ID，需要对端回复时设置，不需要回复的消息为0
+	ReplyTo       *uint64                `protobuf:"varint,5,opt,name=replyTo" json:"replyTo,omitempty"`     // 回复的请求ID，不是回复时为0
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -150,11 +255,28 @@ func (x *MSG_BODY) GetTimestamp() int64 {
 	return 0
 }
 
+func (x *MSG_BODY) GetRequestId() uint64 {
+	if x != nil && x.RequestId != nil {
+		return *x.RequestId
+	}
+	return 0
+}
+
+func (x *MSG_BODY) GetReplyTo() uint64 {
+	if x != nil && x.ReplyTo != nil {
+		return *x.ReplyTo
+	}
+	return 0
+}
+
 // 握手消息
 type MSG_HANDSHAKE_REQ struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Version       *string                `protobuf:"bytes,1,req,name=version" json:"version,omitempty"`   // 协议版本号
-	DeviceId      *string                `protobuf:"bytes,2,req,name=deviceId" json:"deviceId,omitempty"` // 设备ID（暂时用FQDN代替）
+	Version       *string                `protobuf:"bytes,1,req,name=version" json:"version,omitempty"`           // 协议版本号
+	DeviceId      *string                `protobuf:"bytes,2,req,name=deviceId" json:"deviceId,omitempty"`         // 设备ID（暂时用FQDN代替）
+	Features      []string               `protobuf:"bytes,3,rep,name=features" json:"features,omitempty"`         // 客户端支持的协议特性（如 crc32c）
+	Compressions  []string               `protobuf:"bytes,4,rep,name=compressions" json:"compressions,omitempty"` // 客户端支持的压缩算法，按优先级排序
+	Token         *string                `protobuf:"bytes,5,opt,name=token" json:"token,omitempty"`               // 认证令牌
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -203,11 +325,34 @@ func (x *MSG_HANDSHAKE_REQ) GetDeviceId() string {
 	return ""
 }
 
+func (x *MSG_HANDSHAKE_REQ) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *MSG_HANDSHAKE_REQ) GetCompressions() []string {
+	if x != nil {
+		return x.Compressions
+	}
+	return nil
+}
+
+func (x *MSG_HANDSHAKE_REQ) GetToken() string {
+	if x != nil && x.Token != nil {
+		return *x.Token
+	}
+	return ""
+}
+
 // 握手响应
 type MSG_HANDSHAKE_RESP struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Code          *int32                 `protobuf:"varint,1,req,name=code" json:"code,omitempty"`      // 响应码（0=成功）
-	Message       *string                `protobuf:"bytes,2,req,name=message" json:"message,omitempty"` // 错误信息
+	Code          *int32                 `protobuf:"varint,1,req,name=code" json:"code,omitempty"`              // 响应码（0=成功）
+	Message       *string                `protobuf:"bytes,2,req,name=message" json:"message,omitempty"`         // 错误信息
+	Features      []string               `protobuf:"bytes,3,rep,name=features" json:"features,omitempty"`       // 服务端启用的协议特性
+	Compression   *string                `protobuf:"bytes,4,opt,name=compression" json:"compression,omitempty"` // 服务端选定的压缩算法，为空表示不压缩
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -256,6 +401,20 @@ func (x *MSG_HANDSHAKE_RESP) GetMessage() string {
 	return ""
 }
 
+func (x *MSG_HANDSHAKE_RESP) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *MSG_HANDSHAKE_RESP) GetCompression() string {
+	if x != nil && x.Compression != nil {
+		return *x.Compression
+	}
+	return ""
+}
+
 // 心跳消息
 type MSG_HEARTBEAT struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -317,30 +476,586 @@ func (x *MSG_HEARTBEAT) GetMem() float64 {
 	return 0
 }
 
+// 心跳响应，客户端据此判断连接是否仍然可用
+type MSG_HEARTBEAT_ACK struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *int64                 `protobuf:"varint,1,req,name=timestamp" json:"timestamp,omitempty"` // 服务端收到心跳的时间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_HEARTBEAT_ACK) Reset() {
+	*x = MSG_HEARTBEAT_ACK{}
+	mi := &file_message_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_HEARTBEAT_ACK) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_HEARTBEAT_ACK) ProtoMessage() {}
+
+func (x *MSG_HEARTBEAT_ACK) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_HEARTBEAT_ACK.ProtoReflect.Descriptor instead.
+func (*MSG_HEARTBEAT_ACK) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MSG_HEARTBEAT_ACK) GetTimestamp() int64 {
+	if x != nil && x.Timestamp != nil {
+		return *x.Timestamp
+	}
+	return 0
+}
+
+// 认证质询（服务端 -> 客户端）
+type MSG_AUTH_CHALLENGE struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nonce         []byte                 `protobuf:"bytes,1,req,name=nonce" json:"nonce,omitempty"` // 服务端生成的随机数
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_AUTH_CHALLENGE) Reset() {
+	*x = MSG_AUTH_CHALLENGE{}
+	mi := &file_message_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_AUTH_CHALLENGE) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_AUTH_CHALLENGE) ProtoMessage() {}
+
+func (x *MSG_AUTH_CHALLENGE) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_AUTH_CHALLENGE.ProtoReflect.Descriptor instead.
+func (*MSG_AUTH_CHALLENGE) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *MSG_AUTH_CHALLENGE) GetNonce() []byte {
+	if x != nil {
+		return x.Nonce
+	}
+	return nil
+}
+
+// 认证应答（客户端 -> 服务端）
+type MSG_AUTH_RESP struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proof         []byte                 `protobuf:"bytes,1,req,name=proof" json:"proof,omitempty"` // HMAC-SHA256(密钥, nonce + deviceId)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_AUTH_RESP) Reset() {
+	*x = MSG_AUTH_RESP{}
+	mi := &file_message_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_AUTH_RESP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_AUTH_RESP) ProtoMessage() {}
+
+func (x *MSG_AUTH_RESP) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_AUTH_RESP.ProtoReflect.Descriptor instead.
+func (*MSG_AUTH_RESP) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MSG_AUTH_RESP) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+// 优雅断开（双向），发送方随后不再发送消息
+type MSG_GOODBYE struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Code           *int32                 `protobuf:"varint,1,req,name=code" json:"code,omitempty"`                     // 断开原因码
+	Message        *string                `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`                // 断开原因
+	ReconnectAfter *int64                 `protobuf:"varint,3,opt,name=reconnectAfter" json:"reconnectAfter,omitempty"` // 建议对端多少秒后再重连，0 表示不限制
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MSG_GOODBYE) Reset() {
+	*x = MSG_GOODBYE{}
+	mi := &file_message_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_GOODBYE) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_GOODBYE) ProtoMessage() {}
+
+func (x *MSG_GOODBYE) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_GOODBYE.ProtoReflect.Descriptor instead.
+func (*MSG_GOODBYE) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *MSG_GOODBYE) GetCode() int32 {
+	if x != nil && x.Code != nil {
+		return *x.Code
+	}
+	return 0
+}
+
+func (x *MSG_GOODBYE) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
+func (x *MSG_GOODBYE) GetReconnectAfter() int64 {
+	if x != nil && x.ReconnectAfter != nil {
+		return *x.ReconnectAfter
+	}
+	return 0
+}
+
+// 错误回复（双向），如收到未注册的指令
+type MSG_ERROR struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          *int32                 `protobuf:"varint,1,req,name=code" json:"code,omitempty"`                           // 错误码
+	Message       *string                `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`                      // 错误信息
+	Command       *CommandType           `protobuf:"varint,3,opt,name=command,enum=pb.CommandType" json:"command,omitempty"` // 出错的指令
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_ERROR) Reset() {
+	*x = MSG_ERROR{}
+	mi := &file_message_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_ERROR) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_ERROR) ProtoMessage() {}
+
+func (x *MSG_ERROR) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_ERROR.ProtoReflect.Descriptor instead.
+func (*MSG_ERROR) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *MSG_ERROR) GetCode() int32 {
+	if x != nil && x.Code != nil {
+		return *x.Code
+	}
+	return 0
+}
+
+func (x *MSG_ERROR) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
+func (x *MSG_ERROR) GetCommand() CommandType {
+	if x != nil && x.Command != nil {
+		return *x.Command
+	}
+	return CommandType_CommandType_Unknow
+}
+
+// 下发任务，客户端接受后回复 MSG_TASK_ACK，执行过程中发送 MSG_TASK_OUTPUT，结束后发送 MSG_TASK_RESULT
+type MSG_TASK struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        *string                `protobuf:"bytes,1,req,name=taskId" json:"taskId,omitempty"`                                                                       // 任务ID
+	Type          *TaskType              `protobuf:"varint,2,req,name=type,enum=pb.TaskType" json:"type,omitempty"`                                                         // 任务类型
+	Args          map[string]string      `protobuf:"bytes,3,rep,name=args" json:"args,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 任务参数
+	Timeout       *int64                 `protobuf:"varint,4,opt,name=timeout" json:"timeout,omitempty"`                                                                    // 执行超时时间（秒），0 表示使用客户端的默认值
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_TASK) Reset() {
+	*x = MSG_TASK{}
+	mi := &file_message_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_TASK) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_TASK) ProtoMessage() {}
+
+func (x *MSG_TASK) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_TASK.ProtoReflect.Descriptor instead.
+func (*MSG_TASK) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MSG_TASK) GetTaskId() string {
+	if x != nil && x.TaskId != nil {
+		return *x.TaskId
+	}
+	return ""
+}
+
+func (x *MSG_TASK) GetType() TaskType {
+	if x != nil && x.Type != nil {
+		return *x.Type
+	}
+	return TaskType_TaskType_Unknown
+}
+
+func (x *MSG_TASK) GetArgs() map[string]string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *MSG_TASK) GetTimeout() int64 {
+	if x != nil && x.Timeout != nil {
+		return *x.Timeout
+	}
+	return 0
+}
+
+// 客户端已接受任务
+type MSG_TASK_ACK struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        *string                `protobuf:"bytes,1,req,name=taskId" json:"taskId,omitempty"` // 任务ID
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_TASK_ACK) Reset() {
+	*x = MSG_TASK_ACK{}
+	mi := &file_message_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_TASK_ACK) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_TASK_ACK) ProtoMessage() {}
+
+func (x *MSG_TASK_ACK) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_TASK_ACK.ProtoReflect.Descriptor instead.
+func (*MSG_TASK_ACK) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *MSG_TASK_ACK) GetTaskId() string {
+	if x != nil && x.TaskId != nil {
+		return *x.TaskId
+	}
+	return ""
+}
+
+// 任务输出
+type MSG_TASK_OUTPUT struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        *string                `protobuf:"bytes,1,req,name=taskId" json:"taskId,omitempty"` // 任务ID
+	Seq           *int64                 `protobuf:"varint,2,req,name=seq" json:"seq,omitempty"`      // 输出片段的序号，从1开始
+	Data          []byte                 `protobuf:"bytes,3,req,name=data" json:"data,omitempty"`     // 输出内容
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_TASK_OUTPUT) Reset() {
+	*x = MSG_TASK_OUTPUT{}
+	mi := &file_message_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_TASK_OUTPUT) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_TASK_OUTPUT) ProtoMessage() {}
+
+func (x *MSG_TASK_OUTPUT) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_TASK_OUTPUT.ProtoReflect.Descriptor instead.
+func (*MSG_TASK_OUTPUT) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *MSG_TASK_OUTPUT) GetTaskId() string {
+	if x != nil && x.TaskId != nil {
+		return *x.TaskId
+	}
+	return ""
+}
+
+func (x *MSG_TASK_OUTPUT) GetSeq() int64 {
+	if x != nil && x.Seq != nil {
+		return *x.Seq
+	}
+	return 0
+}
+
+func (x *MSG_TASK_OUTPUT) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// 任务结果
+type MSG_TASK_RESULT struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        *string                `protobuf:"bytes,1,req,name=taskId" json:"taskId,omitempty"`      // 任务ID
+	Status        *int32                 `protobuf:"varint,2,req,name=status" json:"status,omitempty"`     // 任务状态
+	ExitCode      *int32                 `protobuf:"varint,3,req,name=exitCode" json:"exitCode,omitempty"` // 退出码
+	Error         *string                `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`        // 错误信息
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSG_TASK_RESULT) Reset() {
+	*x = MSG_TASK_RESULT{}
+	mi := &file_message_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSG_TASK_RESULT) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSG_TASK_RESULT) ProtoMessage() {}
+
+func (x *MSG_TASK_RESULT) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSG_TASK_RESULT.ProtoReflect.Descriptor instead.
+func (*MSG_TASK_RESULT) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MSG_TASK_RESULT) GetTaskId() string {
+	if x != nil && x.TaskId != nil {
+		return *x.TaskId
+	}
+	return ""
+}
+
+func (x *MSG_TASK_RESULT) GetStatus() int32 {
+	if x != nil && x.Status != nil {
+		return *x.Status
+	}
+	return 0
+}
+
+func (x *MSG_TASK_RESULT) GetExitCode() int32 {
+	if x != nil && x.ExitCode != nil {
+		return *x.ExitCode
+	}
+	return 0
+}
+
+func (x *MSG_TASK_RESULT) GetError() string {
+	if x != nil && x.Error != nil {
+		return *x.Error
+	}
+	return ""
+}
+
 var File_message_proto protoreflect.FileDescriptor
 
 const file_message_proto_rawDesc = "" +
 	"\n" +
-	"\rmessage.proto\x12\x02pb\x1a\x19google/protobuf/any.proto\"\x83\x01\n" +
+	"\rmessage.proto\x12\x02pb\x1a\x19google/protobuf/any.proto\"\xbb\x01\n" +
 	"\bMSG_BODY\x12)\n" +
 	"\acommand\x18\x01 \x02(\x0e2\x0f.pb.CommandTypeR\acommand\x12.\n" +
 	"\apayload\x18\x02 \x02(\v2\x14.google.protobuf.AnyR\apayload\x12\x1c\n" +
-	"\ttimestamp\x18\x03 \x02(\x03R\ttimestamp\"I\n" +
+	"\ttimestamp\x18\x03 \x02(\x03R\ttimestamp\x12\x1c\n" +
+	"\trequestId\x18\x04 \x01(\x04R\trequestId\x12\x18\n" +
+	"\areplyTo\x18\x05 \x01(\x04R\areplyTo\"\x9f\x01\n" +
 	"\x11MSG_HANDSHAKE_REQ\x12\x18\n" +
 	"\aversion\x18\x01 \x02(\tR\aversion\x12\x1a\n" +
-	"\bdeviceId\x18\x02 \x02(\tR\bdeviceId\"B\n" +
+	"\bdeviceId\x18\x02 \x02(\tR\bdeviceId\x12\x1a\n" +
+	"\bfeatures\x18\x03 \x03(\tR\bfeatures\x12\"\n" +
+	"\fcompressions\x18\x04 \x03(\tR\fcompressions\x12\x14\n" +
+	"\x05token\x18\x05 \x01(\tR\x05token\"\x80\x01\n" +
 	"\x12MSG_HANDSHAKE_RESP\x12\x12\n" +
 	"\x04code\x18\x01 \x02(\x05R\x04code\x12\x18\n" +
-	"\amessage\x18\x02 \x02(\tR\amessage\"C\n" +
+	"\amessage\x18\x02 \x02(\tR\amessage\x12\x1a\n" +
+	"\bfeatures\x18\x03 \x03(\tR\bfeatures\x12 \n" +
+	"\vcompression\x18\x04 \x01(\tR\vcompression\"C\n" +
 	"\rMSG_HEARTBEAT\x12\x0e\n" +
 	"\x02os\x18\x01 \x02(\tR\x02os\x12\x10\n" +
 	"\x03cpu\x18\x02 \x02(\x01R\x03cpu\x12\x10\n" +
-	"\x03mem\x18\x03 \x02(\x01R\x03mem*}\n" +
+	"\x03mem\x18\x03 \x02(\x01R\x03mem\"1\n" +
+	"\x11MSG_HEARTBEAT_ACK\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x02(\x03R\ttimestamp\"*\n" +
+	"\x12MSG_AUTH_CHALLENGE\x12\x14\n" +
+	"\x05nonce\x18\x01 \x02(\fR\x05nonce\"%\n" +
+	"\rMSG_AUTH_RESP\x12\x14\n" +
+	"\x05proof\x18\x01 \x02(\fR\x05proof\"c\n" +
+	"\vMSG_GOODBYE\x12\x12\n" +
+	"\x04code\x18\x01 \x02(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12&\n" +
+	"\x0ereconnectAfter\x18\x03 \x01(\x03R\x0ereconnectAfter\"d\n" +
+	"\tMSG_ERROR\x12\x12\n" +
+	"\x04code\x18\x01 \x02(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12)\n" +
+	"\acommand\x18\x03 \x01(\x0e2\x0f.pb.CommandTypeR\acommand\"\xc3\x01\n" +
+	"\bMSG_TASK\x12\x16\n" +
+	"\x06taskId\x18\x01 \x02(\tR\x06taskId\x12 \n" +
+	"\x04type\x18\x02 \x02(\x0e2\f.pb.TaskTypeR\x04type\x12*\n" +
+	"\x04args\x18\x03 \x03(\v2\x16.pb.MSG_TASK.ArgsEntryR\x04args\x12\x18\n" +
+	"\atimeout\x18\x04 \x01(\x03R\atimeout\x1a7\n" +
+	"\tArgsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"&\n" +
+	"\fMSG_TASK_ACK\x12\x16\n" +
+	"\x06taskId\x18\x01 \x02(\tR\x06taskId\"O\n" +
+	"\x0fMSG_TASK_OUTPUT\x12\x16\n" +
+	"\x06taskId\x18\x01 \x02(\tR\x06taskId\x12\x10\n" +
+	"\x03seq\x18\x02 \x02(\x03R\x03seq\x12\x12\n" +
+	"\x04data\x18\x03 \x02(\fR\x04data\"s\n" +
+	"\x0fMSG_TASK_RESULT\x12\x16\n" +
+	"\x06taskId\x18\x01 \x02(\tR\x06taskId\x12\x16\n" +
+	"\x06status\x18\x02 \x02(\x05R\x06status\x12\x1a\n" +
+	"\bexitCode\x18\x03 \x02(\x05R\bexitCode\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error*\xd2\x02\n" +
 	"\vCommandType\x12\x16\n" +
 	"\x12CommandType_Unknow\x10\x00\x12\x1c\n" +
 	"\x18CommandType_HandShakeReq\x10\x01\x12\x1d\n" +
 	"\x19CommandType_HandShakeResp\x10\x02\x12\x19\n" +
-	"\x15CommandType_Heartbeat\x10\x03B\fZ\n" +
+	"\x15CommandType_Heartbeat\x10\x03\x12\x1d\n" +
+	"\x19CommandType_AuthChallenge\x10\x04\x12\x18\n" +
+	"\x14CommandType_AuthResp\x10\x05\x12\x17\n" +
+	"\x13CommandType_Goodbye\x10\x06\x12\x15\n" +
+	"\x11CommandType_Error\x10\a\x12\x14\n" +
+	"\x10CommandType_Task\x10\b\x12\x1a\n" +
+	"\x16CommandType_TaskOutput\x10\t\x12\x1a\n" +
+	"\x16CommandType_TaskResult\x10\n" +
+	"\x12\x1c\n" +
+	"\x18CommandType_HeartbeatAck\x10\v*\x7f\n" +
+	"\bTaskType\x12\x14\n" +
+	"\x10TaskType_Unknown\x10\x00\x12\x18\n" +
+	"\x14TaskType_Diagnostics\x10\x01\x12\x16\n" +
+	"\x12TaskType_Inventory\x10\x02\x12\x16\n" +
+	"\x12TaskType_RotateLog\x10\x03\x12\x13\n" +
+	"\x0fTaskType_Action\x10\x04B\fZ\n" +
 	"./;message"
 
 var (
@@ -355,24 +1070,38 @@ func file_message_proto_rawDescGZIP() []byte {
 	return file_message_proto_rawDescData
 }
 
-var file_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_message_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_message_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_message_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_message_proto_goTypes = []any{
 	(CommandType)(0),           // 0: pb.CommandType
-	(*MSG_BODY)(nil),           // 1: pb.MSG_BODY
-	(*MSG_HANDSHAKE_REQ)(nil),  // 2: pb.MSG_HANDSHAKE_REQ
-	(*MSG_HANDSHAKE_RESP)(nil), // 3: pb.MSG_HANDSHAKE_RESP
-	(*MSG_HEARTBEAT)(nil),      // 4: pb.MSG_HEARTBEAT
-	(*anypb.Any)(nil),          // 5: google.protobuf.Any
+	(TaskType)(0),              // 1: pb.TaskType
+	(*MSG_BODY)(nil),           // 2: pb.MSG_BODY
+	(*MSG_HANDSHAKE_REQ)(nil),  // 3: pb.MSG_HANDSHAKE_REQ
+	(*MSG_HANDSHAKE_RESP)(nil), // 4: pb.MSG_HANDSHAKE_RESP
+	(*MSG_HEARTBEAT)(nil),      // 5: pb.MSG_HEARTBEAT
+	(*MSG_HEARTBEAT_ACK)(nil),  // 6: pb.MSG_HEARTBEAT_ACK
+	(*MSG_AUTH_CHALLENGE)(nil), // 7: pb.MSG_AUTH_CHALLENGE
+	(*MSG_AUTH_RESP)(nil),      // 8: pb.MSG_AUTH_RESP
+	(*MSG_GOODBYE)(nil),        // 9: pb.MSG_GOODBYE
+	(*MSG_ERROR)(nil),          // 10: pb.MSG_ERROR
+	(*MSG_TASK)(nil),           // 11: pb.MSG_TASK
+	(*MSG_TASK_ACK)(nil),       // 12: pb.MSG_TASK_ACK
+	(*MSG_TASK_OUTPUT)(nil),    // 13: pb.MSG_TASK_OUTPUT
+	(*MSG_TASK_RESULT)(nil),    // 14: pb.MSG_TASK_RESULT
+	nil,                        // 15: pb.MSG_TASK.ArgsEntry
+	(*anypb.Any)(nil),          // 16: google.protobuf.Any
 }
 var file_message_proto_depIdxs = []int32{
-	0, // 0: pb.MSG_BODY.command:type_name -> pb.CommandType
-	5, // 1: pb.MSG_BODY.payload:type_name -> google.protobuf.Any
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: pb.MSG_BODY.command:type_name -> pb.CommandType
+	16, // 1: pb.MSG_BODY.payload:type_name -> google.protobuf.Any
+	0,  // 2: pb.MSG_ERROR.command:type_name -> pb.CommandType
+	1,  // 3: pb.MSG_TASK.type:type_name -> pb.TaskType
+	15, // 4: pb.MSG_TASK.args:type_name -> pb.MSG_TASK.ArgsEntry
+	5,  // [5:5] is the sub-list for method output_type
+	5,  // [5:5] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_message_proto_init() }
@@ -385,8 +1114,8 @@ func file_message_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_message_proto_rawDesc), len(file_message_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   4,
+			NumEnums:      2,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   0,
 		},